@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Cache holds short-lived string values under string keys. Values expire after the expiration the cache was opened
+// with.
+type Cache interface {
+	// Get returns a value and whether it was found.
+	Get(ctx context.Context, key string) (string, bool, error)
+	Set(ctx context.Context, key string, value string) error
+	// Take gets a value and deletes it in one step, so only one caller across every instance receives it.
+	Take(ctx context.Context, key string) (string, bool, error)
+	Delete(ctx context.Context, key string) error
+	// Count reports how many values have not expired yet.
+	Count(ctx context.Context) (int, error)
+}
+
+// Backend opens named caches that share one connection or one snapshot directory.
+type Backend interface {
+	Open(name string, expiration time.Duration) Cache
+	// Close releases the backend. The memory backend saves its caches first so they survive a restart.
+	Close() error
+}
+
+// Default is the backend the shared caches were opened on, set by main from CACHE_DRIVER.
+var Default Backend
+
+// New creates the backend for a CACHE_DRIVER value: "memory" to keep caches in this process, saved to CACHE_DIR on
+// shutdown, or "redis" to share them between instances through REDIS_URL. An empty driver means "memory".
+func New(driver string) (Backend, error) {
+	switch strings.ToLower(driver) {
+	case "", "memory":
+		return NewMemory(envOr("CACHE_DIR", "/var/lib/cache")), nil
+	case "redis":
+		return NewRedis(os.Getenv("REDIS_URL"))
+	default:
+		return nil, fmt.Errorf("unknown cache driver %q", driver)
+	}
+}
+
+func envOr(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+const testExpiration = 100 * time.Millisecond
+
+// testBackend runs the behaviour every backend shares. expire moves the backend past testExpiration.
+func testBackend(t *testing.T, backend Backend, expire func()) {
+	ctx := context.Background()
+
+	t.Run("get and set", func(t *testing.T) {
+		values := backend.Open("get", time.Hour)
+		if _, found, err := values.Get(ctx, "missing"); err != nil || found {
+			t.Fatalf("Get(missing) = %v, %v, want not found", found, err)
+		}
+
+		mustSet(t, values, "key", "first")
+		mustSet(t, values, "key", "second")
+		if value, found, err := values.Get(ctx, "key"); err != nil || !found || value != "second" {
+			t.Fatalf("Get = %q, %v, %v, want second", value, found, err)
+		}
+	})
+
+	t.Run("caches are separate", func(t *testing.T) {
+		first := backend.Open("first", time.Hour)
+		second := backend.Open("second", time.Hour)
+		mustSet(t, first, "key", "value")
+
+		if _, found, err := second.Get(ctx, "key"); err != nil || found {
+			t.Fatalf("Get from another cache = %v, %v, want not found", found, err)
+		}
+		if count, err := second.Count(ctx); err != nil || count != 0 {
+			t.Fatalf("Count of another cache = %d, %v, want 0", count, err)
+		}
+	})
+
+	t.Run("take", func(t *testing.T) {
+		values := backend.Open("take", time.Hour)
+		mustSet(t, values, "key", "value")
+
+		if value, found, err := values.Take(ctx, "key"); err != nil || !found || value != "value" {
+			t.Fatalf("Take = %q, %v, %v, want value", value, found, err)
+		}
+		if _, found, err := values.Take(ctx, "key"); err != nil || found {
+			t.Fatalf("second Take = %v, %v, want not found", found, err)
+		}
+		if _, found, err := values.Get(ctx, "key"); err != nil || found {
+			t.Fatalf("Get after Take = %v, %v, want not found", found, err)
+		}
+		if count, err := values.Count(ctx); err != nil || count != 0 {
+			t.Fatalf("Count after Take = %d, %v, want 0", count, err)
+		}
+	})
+
+	t.Run("count and delete", func(t *testing.T) {
+		values := backend.Open("count", time.Hour)
+		mustSet(t, values, "a", "1")
+		mustSet(t, values, "b", "2")
+		mustSet(t, values, "b", "3")
+		if count, err := values.Count(ctx); err != nil || count != 2 {
+			t.Fatalf("Count = %d, %v, want 2", count, err)
+		}
+
+		if err := values.Delete(ctx, "a"); err != nil {
+			t.Fatal(err)
+		}
+		if _, found, err := values.Get(ctx, "a"); err != nil || found {
+			t.Fatalf("Get after Delete = %v, %v, want not found", found, err)
+		}
+		if count, err := values.Count(ctx); err != nil || count != 1 {
+			t.Fatalf("Count after Delete = %d, %v, want 1", count, err)
+		}
+	})
+
+	t.Run("expiry", func(t *testing.T) {
+		values := backend.Open("expiry", testExpiration)
+		mustSet(t, values, "key", "value")
+		expire()
+
+		if _, found, err := values.Get(ctx, "key"); err != nil || found {
+			t.Fatalf("Get after expiry = %v, %v, want not found", found, err)
+		}
+		if _, found, err := values.Take(ctx, "key"); err != nil || found {
+			t.Fatalf("Take after expiry = %v, %v, want not found", found, err)
+		}
+		if count, err := values.Count(ctx); err != nil || count != 0 {
+			t.Fatalf("Count after expiry = %d, %v, want 0", count, err)
+		}
+
+		mustSet(t, values, "fresh", "value")
+		if count, err := values.Count(ctx); err != nil || count != 1 {
+			t.Fatalf("Count after setting again = %d, %v, want 1", count, err)
+		}
+	})
+}
+
+func mustSet(t *testing.T, values Cache, key string, value string) {
+	t.Helper()
+
+	if err := values.Set(context.Background(), key, value); err != nil {
+		t.Fatalf("Set(%s) = %v", key, err)
+	}
+}
@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"github.com/patrickmn/go-cache"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Memory keeps caches in process memory, so every instance has its own. Caches are saved to dir on Close and
+// loaded again when next opened.
+type Memory struct {
+	dir    string
+	mu     sync.Mutex
+	caches map[string]*memoryCache
+}
+
+func NewMemory(dir string) *Memory {
+	return &Memory{dir: dir, caches: make(map[string]*memoryCache)}
+}
+
+func (m *Memory) Open(name string, expiration time.Duration) Cache {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	opened := &memoryCache{items: m.load(name, expiration)}
+	m.caches[name] = opened
+	return opened
+}
+
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+	for name, opened := range m.caches {
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(opened.items.Items()); err != nil {
+			log.Printf("Unable to save %s cache: \n%s", name, err.Error())
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(m.dir, name), buf.Bytes(), 0o644); err != nil {
+			log.Printf("Unable to save %s cache: \n%s", name, err.Error())
+			continue
+		}
+		log.Printf("Saved %s cache\n", name)
+	}
+	return nil
+}
+
+// load restores a cache saved by Close, starting empty when there is none or it cannot be read.
+func (m *Memory) load(name string, expiration time.Duration) *cache.Cache {
+	file, err := os.ReadFile(filepath.Join(m.dir, name))
+	if err != nil {
+		return cache.New(expiration, time.Minute)
+	}
+
+	values := make(map[string]cache.Item)
+	if err := gob.NewDecoder(bytes.NewBuffer(file)).Decode(&values); err != nil {
+		return cache.New(expiration, time.Minute)
+	}
+
+	return cache.NewFrom(expiration, time.Minute, values)
+}
+
+type memoryCache struct {
+	items *cache.Cache
+	// take makes reading and deleting in Take a single step
+	take sync.Mutex
+}
+
+func (m *memoryCache) Get(ctx context.Context, key string) (string, bool, error) {
+	value, found := m.items.Get(key)
+	if !found {
+		return "", false, nil
+	}
+	text, ok := value.(string)
+	return text, ok, nil
+}
+
+func (m *memoryCache) Set(ctx context.Context, key string, value string) error {
+	m.items.SetDefault(key, value)
+	return nil
+}
+
+func (m *memoryCache) Take(ctx context.Context, key string) (string, bool, error) {
+	m.take.Lock()
+	defer m.take.Unlock()
+
+	value, found, err := m.Get(ctx, key)
+	if found {
+		m.items.Delete(key)
+	}
+	return value, found, err
+}
+
+func (m *memoryCache) Delete(ctx context.Context, key string) error {
+	m.items.Delete(key)
+	return nil
+}
+
+// Count leaves out expired values the janitor has not removed yet, which ItemCount would include.
+func (m *memoryCache) Count(ctx context.Context) (int, error) {
+	return len(m.items.Items()), nil
+}
@@ -0,0 +1,29 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemory(t *testing.T) {
+	testBackend(t, NewMemory(t.TempDir()), func() {
+		time.Sleep(2 * testExpiration)
+	})
+}
+
+func TestMemorySavesOnClose(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	backend := NewMemory(dir)
+	mustSet(t, backend.Open("saved", time.Hour), "key", "value")
+	if err := backend.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := NewMemory(dir).Open("saved", time.Hour)
+	if value, found, err := reopened.Get(ctx, "key"); err != nil || !found || value != "value" {
+		t.Fatalf("Get after reopening = %q, %v, %v, want value", value, found, err)
+	}
+}
@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"math"
+	"strconv"
+	"time"
+)
+
+const (
+	redisKeyPrefix   = "calenduh:"
+	redisPingTimeout = 5 * time.Second
+	redisIndexPrefix = redisKeyPrefix + "index:"
+)
+
+// Redis keeps caches in a Redis server shared by every instance. Each cache's keys are prefixed with its name.
+type Redis struct {
+	client *redis.Client
+}
+
+// NewRedis connects to a redis:// or rediss:// URL, failing early when the server cannot be reached.
+func NewRedis(url string) (*Redis, error) {
+	if url == "" {
+		return nil, errors.New("REDIS_URL is required for the redis cache")
+	}
+
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(options)
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisPingTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+
+	return &Redis{client: client}, nil
+}
+
+// Client is the underlying connection, for other features that keep their state in the same server.
+func (r *Redis) Client() *redis.Client {
+	return r.client
+}
+
+func (r *Redis) Open(name string, expiration time.Duration) Cache {
+	return &redisCache{
+		client:     r.client,
+		prefix:     redisKeyPrefix + name + ":",
+		index:      redisIndexPrefix + name,
+		expiration: expiration,
+	}
+}
+
+func (r *Redis) Close() error {
+	return r.client.Close()
+}
+
+// redisCache also keeps a sorted set of its keys scored by when they expire, so Count does not have to scan the
+// keyspace.
+type redisCache struct {
+	client     *redis.Client
+	prefix     string
+	index      string
+	expiration time.Duration
+}
+
+func (r *redisCache) Get(ctx context.Context, key string) (string, bool, error) {
+	return found(r.client.Get(ctx, r.prefix+key).Result())
+}
+
+func (r *redisCache) Set(ctx context.Context, key string, value string) error {
+	expiresAt := math.Inf(1)
+	if r.expiration > 0 {
+		expiresAt = float64(time.Now().Add(r.expiration).UnixMilli())
+	}
+
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, r.prefix+key, value, r.expiration)
+		pipe.ZAdd(ctx, r.index, redis.Z{Score: expiresAt, Member: key})
+		r.dropExpired(ctx, pipe)
+		return nil
+	})
+	return err
+}
+
+func (r *redisCache) Take(ctx context.Context, key string) (string, bool, error) {
+	var taken *redis.StringCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		taken = pipe.GetDel(ctx, r.prefix+key)
+		pipe.ZRem(ctx, r.index, key)
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return "", false, err
+	}
+	return found(taken.Result())
+}
+
+func (r *redisCache) Delete(ctx context.Context, key string) error {
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, r.prefix+key)
+		pipe.ZRem(ctx, r.index, key)
+		return nil
+	})
+	return err
+}
+
+func (r *redisCache) Count(ctx context.Context) (int, error) {
+	var count *redis.IntCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		r.dropExpired(ctx, pipe)
+		count = pipe.ZCard(ctx, r.index)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(count.Val()), nil
+}
+
+// dropExpired removes keys that have expired from the index, which Redis cannot expire on its own.
+func (r *redisCache) dropExpired(ctx context.Context, pipe redis.Pipeliner) {
+	pipe.ZRemRangeByScore(ctx, r.index, "-inf", strconv.FormatInt(time.Now().UnixMilli(), 10))
+}
+
+func found(value string, err error) (string, bool, error) {
+	if errors.Is(err, redis.Nil) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
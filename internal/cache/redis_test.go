@@ -0,0 +1,28 @@
+package cache
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"testing"
+	"time"
+)
+
+func TestRedis(t *testing.T) {
+	server := miniredis.RunT(t)
+	backend, err := NewRedis("redis://" + server.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = backend.Close() })
+
+	testBackend(t, backend, func() {
+		// Keys expire on the server's clock and the index on this one, so both move on
+		time.Sleep(2 * testExpiration)
+		server.FastForward(2 * testExpiration)
+	})
+}
+
+func TestNewRedisRequiresURL(t *testing.T) {
+	if _, err := NewRedis(""); err == nil {
+		t.Fatal("NewRedis accepted an empty URL")
+	}
+}
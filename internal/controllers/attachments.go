@@ -0,0 +1,330 @@
+package controllers
+
+import (
+	"bytes"
+	"calenduh-backend/internal/database"
+	"calenduh-backend/internal/sqlc"
+	"calenduh-backend/internal/storage"
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	maxAttachmentBytes       = 25 << 20
+	maxAttachmentsPerEvent   = 20
+	maxAttachmentNameLength  = 255
+	icalAttachmentLinkExpiry = 7 * 24 * time.Hour
+)
+
+var errUnsupportedAttachment = errors.New("file type must be PDF, an image, plain text, CSV, Markdown, RTF or an office document")
+
+// attachmentType is the MIME type an attachment extension is stored as, and what http.DetectContentType must say
+// about the content for it to be accepted under that extension.
+type attachmentType struct {
+	ContentType string
+	Sniffed     string
+}
+
+var attachmentTypes = map[string]attachmentType{
+	".pdf":  {"application/pdf", "application/pdf"},
+	".png":  {"image/png", "image/png"},
+	".jpg":  {"image/jpeg", "image/jpeg"},
+	".jpeg": {"image/jpeg", "image/jpeg"},
+	".gif":  {"image/gif", "image/gif"},
+	".webp": {"image/webp", "image/webp"},
+	".txt":  {"text/plain", "text/plain"},
+	".csv":  {"text/csv", "text/plain"},
+	".md":   {"text/markdown", "text/plain"},
+	".rtf":  {"application/rtf", "text/plain"},
+	".doc":  {"application/msword", "application/octet-stream"},
+	".xls":  {"application/vnd.ms-excel", "application/octet-stream"},
+	".ppt":  {"application/vnd.ms-powerpoint", "application/octet-stream"},
+	".docx": {"application/vnd.openxmlformats-officedocument.wordprocessingml.document", "application/zip"},
+	".xlsx": {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "application/zip"},
+	".pptx": {"application/vnd.openxmlformats-officedocument.presentationml.presentation", "application/zip"},
+	".odt":  {"application/vnd.oasis.opendocument.text", "application/zip"},
+	".ods":  {"application/vnd.oasis.opendocument.spreadsheet", "application/zip"},
+	".odp":  {"application/vnd.oasis.opendocument.presentation", "application/zip"},
+}
+
+// EventAttachmentResponse is an attachment with a signed link that downloads it under its filename.
+type EventAttachmentResponse struct {
+	sqlc.EventAttachment
+	URL string `json:"url"`
+}
+
+// icalAttachment is an attachment as linked from an ATTACH property.
+type icalAttachment struct {
+	URL         string
+	ContentType string
+	Filename    string
+}
+
+// GetEventAttachments
+// @Summary List an event's attachments
+// @Description Lists the files attached to an event, oldest first unless sorted by filename or size_bytes, each with a signed download link that expires after a few minutes. Anyone who can see the event's calendar can list them.
+func GetEventAttachments(c *gin.Context) {
+	calendar, err := database.Db.Queries.GetCalendarById(c, c.Param("calendar_id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "calendar not found"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	visible, err := CanViewCalendar(c, calendar)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !visible {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	event, err := database.Db.Queries.GetEventById(c, c.Param("event_id"))
+	if err == nil && event.CalendarID != calendar.CalendarID {
+		err = pgx.ErrNoRows
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "event not found"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	attachments, err := database.Db.Queries.GetEventAttachments(c, event.EventID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := make([]EventAttachmentResponse, 0, len(attachments))
+	for _, attachment := range attachments {
+		url, err := attachmentURL(c, attachment, ImageURLExpiry)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		response = append(response, EventAttachmentResponse{EventAttachment: attachment, URL: url})
+	}
+
+	RespondList(c, response, ListOptions[EventAttachmentResponse]{Sorts: AttachmentSorts, DefaultSort: "created_at"})
+}
+
+// CreateEventAttachment
+// @Summary Attach a file to an event
+// @Description Stores the "file" form field as an attachment of at most 25 MB, counted against the uploader's quota. Events can have up to 20 attachments.
+func CreateEventAttachment(c *gin.Context) {
+	user := *ParseUser(c)
+
+	event, ok := parseEditableEvent(c)
+	if !ok {
+		return
+	}
+
+	count, err := database.Db.Queries.CountEventAttachments(c, event.EventID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if count >= maxAttachmentsPerEvent {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "events can have at most 20 attachments"})
+		return
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if header.Size > maxAttachmentBytes {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file must be at most 25 MB"})
+		return
+	}
+
+	filename := cleanAttachmentFilename(header.Filename)
+	if filename == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "file must have a name"})
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxAttachmentBytes+1))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(data) > maxAttachmentBytes {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file must be at most 25 MB"})
+		return
+	}
+
+	contentType, err := attachmentContentType(filename, data)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		return
+	}
+
+	params := sqlc.CreateEventAttachmentParams{
+		AttachmentID: gonanoid.Must(),
+		EventID:      event.EventID,
+		UserID:       &user.UserID,
+		Filename:     filename,
+		ContentType:  contentType,
+		SizeBytes:    int64(len(data)),
+	}
+	params.ObjectKey = "attachments/" + params.AttachmentID + strings.ToLower(path.Ext(filename))
+
+	if err := storage.Default.Put(c, params.ObjectKey, bytes.NewReader(data), contentType); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var attachment sqlc.EventAttachment
+	used, err := reserveQuota(c, user.UserID, params.SizeBytes, func(queries *sqlc.Queries) error {
+		var err error
+		attachment, err = queries.CreateEventAttachment(c, params)
+		return err
+	})
+	if err != nil {
+		_ = deleteFile(c, params.ObjectKey)
+		switch {
+		case errors.Is(err, errQuotaExceeded):
+			respondQuotaExceeded(c, used)
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	url, err := attachmentURL(c, attachment, ImageURLExpiry)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, EventAttachmentResponse{EventAttachment: attachment, URL: url})
+}
+
+// DeleteEventAttachment
+// @Summary Remove an attachment from an event
+// @Description Deletes the attachment and its stored file. Anyone who can edit the event's calendar can remove any attachment.
+func DeleteEventAttachment(c *gin.Context) {
+	event, ok := parseEditableEvent(c)
+	if !ok {
+		return
+	}
+
+	attachment, err := database.Db.Queries.GetEventAttachment(c, sqlc.GetEventAttachmentParams{
+		AttachmentID: c.Param("attachment_id"),
+		EventID:      event.EventID,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "attachment not found"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if err := deleteFile(c, attachment.ObjectKey); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to delete file from storage"})
+		return
+	}
+
+	if err := database.Db.Queries.DeleteEventAttachment(c, attachment.AttachmentID); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, attachment)
+}
+
+// calendarICalAttachments links every attachment in a calendar for its iCal feed, keyed by event. Calendar apps keep
+// the links they are given, so they last as long as S3 allows instead of a few minutes.
+func calendarICalAttachments(ctx context.Context, calendarId string) (map[string][]icalAttachment, error) {
+	attachments, err := database.Db.Queries.GetCalendarEventAttachments(ctx, calendarId)
+	if err != nil {
+		return nil, err
+	}
+
+	links := make(map[string][]icalAttachment)
+	for _, attachment := range attachments {
+		url, err := attachmentURL(ctx, attachment, icalAttachmentLinkExpiry)
+		if err != nil {
+			return nil, err
+		}
+		links[attachment.EventID] = append(links[attachment.EventID], icalAttachment{
+			URL:         url,
+			ContentType: attachment.ContentType,
+			Filename:    attachment.Filename,
+		})
+	}
+	return links, nil
+}
+
+func attachmentURL(ctx context.Context, attachment sqlc.EventAttachment, expiry time.Duration) (string, error) {
+	return storage.Default.URL(ctx, attachment.ObjectKey, storage.URLOptions{
+		Expiry:   expiry,
+		Filename: attachment.Filename,
+	})
+}
+
+// attachmentContentType picks the MIME type for an attachment from its extension, rejecting content that does not
+// look like that kind of file.
+func attachmentContentType(filename string, data []byte) (string, error) {
+	kind, ok := attachmentTypes[strings.ToLower(path.Ext(filename))]
+	if !ok || !strings.HasPrefix(http.DetectContentType(data), kind.Sniffed) {
+		return "", errUnsupportedAttachment
+	}
+	return kind.ContentType, nil
+}
+
+// cleanAttachmentFilename keeps the last path element of a client supplied filename, without control characters and
+// cut to a length every filesystem accepts.
+func cleanAttachmentFilename(filename string) string {
+	filename = path.Base(strings.ReplaceAll(filename, "\\", "/"))
+	filename = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, filename))
+	if filename == "." || filename == "/" {
+		return ""
+	}
+
+	if len(filename) > maxAttachmentNameLength {
+		extension := path.Ext(filename)
+		if len(extension) >= maxAttachmentNameLength {
+			return ""
+		}
+		base := strings.TrimSuffix(filename, extension)
+		filename = strings.ToValidUTF8(base[:maxAttachmentNameLength-len(extension)], "") + extension
+	}
+	return filename
+}
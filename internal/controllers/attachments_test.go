@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestCleanAttachmentFilename(t *testing.T) {
+	long := strings.Repeat("a", 300)
+
+	tests := []struct {
+		name     string
+		filename string
+		want     string
+	}{
+		{"plain", "report.pdf", "report.pdf"},
+		{"spaces kept inside", "  my report.pdf  ", "my report.pdf"},
+		{"unix path", "/home/user/report.pdf", "report.pdf"},
+		{"windows path", `C:\Users\user\report.pdf`, "report.pdf"},
+		{"traversal", "../../etc/passwd", "passwd"},
+		{"windows traversal", `..\..\secret.txt`, "secret.txt"},
+		{"control characters", "re\x00po\nrt\t.pdf", "report.pdf"},
+		{"trailing slash", "folder/", "folder"},
+		{"only a slash", "/", ""},
+		{"empty", "", ""},
+		{"dot", ".", ""},
+		{"long name keeps extension", long + ".pdf", long[:maxAttachmentNameLength-len(".pdf")] + ".pdf"},
+		{"long extension", "a." + long, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := cleanAttachmentFilename(test.filename); got != test.want {
+				t.Fatalf("cleanAttachmentFilename(%q) = %q, want %q", test.filename, got, test.want)
+			}
+		})
+	}
+}
+
+func TestCleanAttachmentFilenameKeepsUTF8(t *testing.T) {
+	// Cutting a long name must not split a multi-byte character
+	filename := strings.Repeat("é", 200) + ".txt"
+
+	got := cleanAttachmentFilename(filename)
+	if len(got) > maxAttachmentNameLength {
+		t.Fatalf("length = %d, want at most %d", len(got), maxAttachmentNameLength)
+	}
+	if !utf8.ValidString(got) || !strings.HasSuffix(got, ".txt") {
+		t.Fatalf("cleanAttachmentFilename = %q, want valid UTF-8 ending in .txt", got)
+	}
+}
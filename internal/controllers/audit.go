@@ -0,0 +1,217 @@
+package controllers
+
+import (
+	"calenduh-backend/internal/database"
+	"calenduh-backend/internal/sqlc"
+	"context"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	AuditLogin              = "auth.login"
+	AuditLoginFailed        = "auth.login_failed"
+	AuditLogout             = "auth.logout"
+	AuditInvalidSession     = "auth.invalid_session"
+	AuditGroupJoin          = "group.join"
+	AuditGroupJoinRequest   = "group.join_request"
+	AuditGroupJoinApprove   = "group.join_approve"
+	AuditGroupJoinDeny      = "group.join_deny"
+	AuditGroupJoinCancel    = "group.join_cancel"
+	AuditGroupInvite        = "group.invite"
+	AuditGroupInviteCancel  = "group.invite_cancel"
+	AuditGroupInviteDecline = "group.invite_decline"
+	AuditGroupLeave         = "group.leave"
+	AuditGroupDelete        = "group.delete"
+	AuditGroupRestore       = "group.restore"
+	AuditInviteCreate       = "invite.create"
+	AuditInviteRevoke       = "invite.revoke"
+	AuditInviteRotate       = "invite.rotate"
+	AuditCalendarDelete     = "calendar.delete"
+	AuditCalendarRestore    = "calendar.restore"
+	AuditEventDelete        = "event.delete"
+	AuditEventRestore       = "event.restore"
+	AuditEventPrune         = "event.prune"
+	AuditUserDelete         = "user.delete"
+	AuditUserDeleteRequest  = "user.delete_request"
+	AuditUserDeleteCancel   = "user.delete_cancel"
+	AuditUserExport         = "user.export"
+	AuditSubscriptionDelete = "subscription.delete"
+	AuditListSessions       = "admin.list_sessions"
+	AuditDeleteAllUsers     = "admin.delete_all_users"
+	AuditDeleteAllCalendars = "admin.delete_all_calendars"
+	AuditDeleteAllEvents    = "admin.delete_all_events"
+	AuditCollectOrphans     = "admin.collect_orphans"
+)
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 500
+)
+
+// AuditEntry is an audit log row with its metadata left as raw JSON.
+type AuditEntry struct {
+	AuditID    int64           `json:"audit_id"`
+	ActorID    *string         `json:"actor_id"`
+	Action     string          `json:"action"`
+	TargetType *string         `json:"target_type"`
+	TargetID   *string         `json:"target_id"`
+	IP         string          `json:"ip"`
+	UserAgent  string          `json:"user_agent"`
+	Metadata   json.RawMessage `json:"metadata,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// RecordAudit writes an audit log entry for the current request, attributing it to the logged-in user if there is one.
+// Failures are logged rather than returned so auditing never breaks the action being audited.
+func RecordAudit(c *gin.Context, action string, targetType string, targetId string, metadata gin.H) {
+	var actorId *string
+	if v, found := c.Get("user"); found {
+		if user, ok := v.(*sqlc.User); ok {
+			actorId = &user.UserID
+		}
+	}
+
+	recordAudit(c, actorId, action, targetType, targetId, metadata)
+}
+
+// RecordAuditAs writes an audit log entry for an actor who is not yet attached to the request, such as during login.
+func RecordAuditAs(c *gin.Context, actorId string, action string, targetType string, targetId string, metadata gin.H) {
+	recordAudit(c, &actorId, action, targetType, targetId, metadata)
+}
+
+// RecordSystemAudit writes an audit log entry for an action taken by a background job rather than a request.
+func RecordSystemAudit(ctx context.Context, actorId *string, action string, targetType string, targetId string, metadata gin.H) {
+	writeAudit(ctx, sqlc.CreateAuditEntryParams{ActorID: actorId, Action: action}, targetType, targetId, metadata)
+}
+
+func recordAudit(c *gin.Context, actorId *string, action string, targetType string, targetId string, metadata gin.H) {
+	writeAudit(c, sqlc.CreateAuditEntryParams{
+		ActorID:   actorId,
+		Action:    action,
+		Ip:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}, targetType, targetId, metadata)
+}
+
+func writeAudit(ctx context.Context, params sqlc.CreateAuditEntryParams, targetType string, targetId string, metadata gin.H) {
+	if targetType != "" {
+		params.TargetType = &targetType
+	}
+	if targetId != "" {
+		params.TargetID = &targetId
+	}
+	if metadata != nil {
+		data, err := json.Marshal(metadata)
+		if err != nil {
+			log.Printf("unable to encode audit metadata for %s: %s\n", params.Action, err.Error())
+		}
+		params.Metadata = data
+	}
+
+	// The request's own transaction may have been rolled back, so write outside of it
+	if err := database.Db.Queries.CreateAuditEntry(ctx, params); err != nil {
+		log.Printf("unable to record audit entry %s: %s\n", params.Action, err.Error())
+	}
+}
+
+// GetAuditLog
+// @Summary Search the audit log
+// @Description Lists audit log entries newest first, filtered by actor_id, action, target_type and target_id. Page with before.
+func GetAuditLog(c *gin.Context) {
+	before, limit, ok := parseAuditPage(c)
+	if !ok {
+		return
+	}
+
+	entries, err := database.Db.Queries.GetAuditLog(c, sqlc.GetAuditLogParams{
+		ActorID:    optionalQuery(c, "actor_id"),
+		Action:     optionalQuery(c, "action"),
+		TargetType: optionalQuery(c, "target_type"),
+		TargetID:   optionalQuery(c, "target_id"),
+		Before:     before,
+		MaxResults: limit,
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, toAuditEntries(entries))
+}
+
+// GetMyAuditLog
+// @Summary Get account activity
+// @Description Lists audit log entries performed by or against the logged-in user, newest first. Page with before.
+func GetMyAuditLog(c *gin.Context) {
+	user := *ParseUser(c)
+	before, limit, ok := parseAuditPage(c)
+	if !ok {
+		return
+	}
+
+	entries, err := database.Db.Queries.GetUserAuditLog(c, sqlc.GetUserAuditLogParams{
+		UserID:     user.UserID,
+		Before:     before,
+		MaxResults: limit,
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, toAuditEntries(entries))
+}
+
+func parseAuditPage(c *gin.Context) (*int64, int32, bool) {
+	var before *int64
+	if value := c.Query("before"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "before must be an audit_id"})
+			return nil, 0, false
+		}
+		before = &id
+	}
+
+	limit := defaultAuditLimit
+	if value := c.Query("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > maxAuditLimit {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxAuditLimit)})
+			return nil, 0, false
+		}
+	}
+
+	return before, int32(limit), true
+}
+
+func optionalQuery(c *gin.Context, key string) *string {
+	if value := c.Query(key); value != "" {
+		return &value
+	}
+	return nil
+}
+
+func toAuditEntries(entries []sqlc.AuditLog) []AuditEntry {
+	response := make([]AuditEntry, 0, len(entries))
+	for _, entry := range entries {
+		response = append(response, AuditEntry{
+			AuditID:    entry.AuditID,
+			ActorID:    entry.ActorID,
+			Action:     entry.Action,
+			TargetType: entry.TargetType,
+			TargetID:   entry.TargetID,
+			IP:         entry.Ip,
+			UserAgent:  entry.UserAgent,
+			Metadata:   entry.Metadata,
+			CreatedAt:  entry.CreatedAt,
+		})
+	}
+
+	return response
+}
@@ -5,6 +5,7 @@ import (
 	"calenduh-backend/internal/sqlc"
 	"calenduh-backend/internal/util"
 	"crypto/rsa"
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -15,9 +16,11 @@ import (
 	"github.com/jackc/pgx/v5"
 	gonanoid "github.com/matoous/go-nanoid/v2"
 	"io"
+	"log"
 	"math/big"
 	"net/http"
 	"net/url"
+	"os"
 	"strings"
 	"time"
 )
@@ -87,6 +90,9 @@ func Authorize(c *gin.Context) {
 
 	session, err := database.Db.Queries.GetSessionById(c, sessionId)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			recordInvalidSession(c)
+		}
 		c.Next()
 		return
 	}
@@ -97,11 +103,37 @@ func Authorize(c *gin.Context) {
 		return
 	}
 
+	// ActiveUsers holds when each user was last seen, which group member lists report as presence
+	if err := util.TrackUser(c, user.UserID); err != nil {
+		log.Printf("unable to track user activity: %s\n", err.Error())
+	}
+
 	c.Set("user", &user)
+	c.Set("session_id", session.SessionID)
 	c.Next()
 	return
 }
 
+// recordInvalidSession audits a request with an unknown session at most once per IP address every fifteen minutes,
+// so a client sending made-up sessions cannot write to the audit log on every request.
+func recordInvalidSession(c *gin.Context) {
+	ip := c.ClientIP()
+	_, found, err := util.InvalidSessions.Get(c, ip)
+	if err != nil {
+		log.Printf("unable to check invalid sessions: %s\n", err.Error())
+		return
+	}
+	if found {
+		return
+	}
+	if err := util.InvalidSessions.Set(c, ip, time.Now().Format(time.RFC3339)); err != nil {
+		log.Printf("unable to track invalid sessions: %s\n", err.Error())
+		return
+	}
+
+	RecordAudit(c, AuditInvalidSession, "", "", nil)
+}
+
 func LoggedIn(c *gin.Context) {
 	defer func() {
 		if err := recover(); err != nil {
@@ -120,6 +152,17 @@ func LoggedIn(c *gin.Context) {
 	c.Set("groups", &groups)
 }
 
+// Admin is middleware that only lets through requests carrying the API_KEY in the X-API-Key header.
+// Admin access is disabled entirely while API_KEY is empty.
+func Admin(c *gin.Context) {
+	apiKey := os.Getenv("API_KEY")
+	provided := c.GetHeader("X-API-Key")
+	if apiKey == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(apiKey)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "not an admin"})
+		return
+	}
+}
+
 // AppleLogin
 // @Summary Apple Login
 // @Description Handles the login from Apple SignIn and creates a session.
@@ -134,6 +177,8 @@ func AppleLogin(c *gin.Context) {
 
 		token, err := verifyToken(appleLoginBody.IdentityToken)
 		if err != nil {
+			// The user ID is unverified until the token is, so the attempt is not recorded against it
+			RecordAudit(c, AuditLoginFailed, "", "", gin.H{"provider": "apple"})
 			c.AbortWithStatusJSON(http.StatusBadRequest, err)
 			return nil
 		}
@@ -147,8 +192,10 @@ func AppleLogin(c *gin.Context) {
 
 		user, err := queries.GetUserById(c, appleLoginBody.UserId)
 
+		newUser := false
 		if err != nil { // User does not exist yet
 			if errors.Is(err, pgx.ErrNoRows) {
+				newUser = true
 				username := strings.Split(email, "@")[0]
 
 				user, err = database.Db.Queries.CreateUser(c, sqlc.CreateUserParams{
@@ -175,6 +222,8 @@ func AppleLogin(c *gin.Context) {
 			return err
 		}
 
+		RecordAuditAs(c, user.UserID, AuditLogin, "user", user.UserID, gin.H{"provider": "apple", "new_user": newUser})
+
 		c.PureJSON(http.StatusOK, gin.H{
 			"sessionId": session.SessionID,
 		})
@@ -201,7 +250,11 @@ func GoogleLogin(c *gin.Context) {
 	scope := "https://www.googleapis.com/auth/userinfo.email"
 	accessType := "offline"
 	prompt := "select_account"
-	state = util.CreateNonce(state, localRedirectUri)
+	state, err := util.CreateNonce(c, state, localRedirectUri)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "unable to create login state: " + err.Error()})
+		return
+	}
 	params := fmt.Sprintf(
 		"?response_type=%s&client_id=%s&scope=%s&access_type=%s&prompt=%s&redirect_uri=%s&state=%s",
 		responseType,
@@ -220,7 +273,7 @@ func GoogleAuth(c *gin.Context) {
 	if err := database.Transaction(c, func(queries *sqlc.Queries) error {
 		state := c.Query("state")
 		code := c.Query("code")
-		validated, redirectUri := util.ValidateNonce(state)
+		validated, redirectUri := util.ValidateNonce(c, state)
 		if !validated {
 			message := gin.H{"message": "invalid state"}
 			c.AbortWithStatusJSON(http.StatusBadRequest, message)
@@ -233,6 +286,7 @@ func GoogleAuth(c *gin.Context) {
 			return nil
 		}
 
+		provider := "google"
 		client := resty.New()
 		googleTokenUrl := util.GetEnv("GOOGLE_OAUTH_TOKEN_URL")
 
@@ -250,6 +304,7 @@ func GoogleAuth(c *gin.Context) {
 		}
 
 		if resp.StatusCode() != http.StatusOK {
+			RecordAudit(c, AuditLoginFailed, "", "", gin.H{"provider": provider})
 			message := gin.H{"message": "invalid code"}
 			c.AbortWithStatusJSON(http.StatusBadRequest, message)
 			return nil
@@ -285,8 +340,10 @@ func GoogleAuth(c *gin.Context) {
 
 		user, err := database.Db.Queries.GetUserById(c, googleUser.ID)
 
+		newUser := false
 		if err != nil {
 			if errors.Is(err, pgx.ErrNoRows) { // User does not exist yet
+				newUser = true
 				username := strings.Split(googleUser.Email, "@")[0]
 
 				user, err = database.Db.Queries.CreateUser(c, sqlc.CreateUserParams{
@@ -316,6 +373,8 @@ func GoogleAuth(c *gin.Context) {
 			return err
 		}
 
+		RecordAuditAs(c, user.UserID, AuditLogin, "user", user.UserID, gin.H{"provider": provider, "new_user": newUser})
+
 		c.SetCookie("sessionId", session.SessionID, tokenData.ExpiresIn, "/", c.Request.Host, false, true)
 		c.Redirect(http.StatusTemporaryRedirect, *redirectUri+"?state="+state+"&sessionId="+session.SessionID)
 		return nil
@@ -341,7 +400,11 @@ func DiscordLogin(c *gin.Context) {
 	scope := "identify email"
 	accessType := "offline"
 	prompt := "none"
-	state = util.CreateNonce(state, localRedirectUri)
+	state, err := util.CreateNonce(c, state, localRedirectUri)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "unable to create login state: " + err.Error()})
+		return
+	}
 	params := fmt.Sprintf(
 		"?response_type=%s&client_id=%s&scope=%s&access_type=%s&prompt=%s&redirect_uri=%s&state=%s",
 		responseType,
@@ -360,7 +423,7 @@ func DiscordAuth(c *gin.Context) {
 	if err := database.Transaction(c, func(queries *sqlc.Queries) error {
 		state := c.Query("state")
 		code := c.Query("code")
-		validated, redirectUri := util.ValidateNonce(state)
+		validated, redirectUri := util.ValidateNonce(c, state)
 		if !validated {
 			message := gin.H{"message": "invalid state"}
 			c.AbortWithStatusJSON(http.StatusBadRequest, message)
@@ -373,6 +436,7 @@ func DiscordAuth(c *gin.Context) {
 			return nil
 		}
 
+		provider := "discord"
 		client := resty.New()
 		discordTokenUrl := util.GetEnv("DISCORD_OAUTH_TOKEN_URL")
 
@@ -390,6 +454,7 @@ func DiscordAuth(c *gin.Context) {
 		}
 
 		if resp.StatusCode() != http.StatusOK {
+			RecordAudit(c, AuditLoginFailed, "", "", gin.H{"provider": provider})
 			message := gin.H{"message": "invalid code"}
 			c.AbortWithStatusJSON(http.StatusBadRequest, message)
 			return nil
@@ -425,8 +490,10 @@ func DiscordAuth(c *gin.Context) {
 
 		user, err := database.Db.Queries.GetUserById(c, discordUser.ID)
 
+		newUser := false
 		if err != nil { // User does not exist yet
 			if errors.Is(err, pgx.ErrNoRows) {
+				newUser = true
 
 				user, err = database.Db.Queries.CreateUser(c, sqlc.CreateUserParams{
 					UserID:   discordUser.ID,
@@ -455,6 +522,8 @@ func DiscordAuth(c *gin.Context) {
 			return err
 		}
 
+		RecordAuditAs(c, user.UserID, AuditLogin, "user", user.UserID, gin.H{"provider": provider, "new_user": newUser})
+
 		c.SetCookie("sessionId", session.SessionID, tokenData.ExpiresIn, "/",
 			c.Request.Host, false, true)
 
@@ -485,12 +554,16 @@ func Logout(c *gin.Context) {
 		return
 	}
 
+	RecordAudit(c, AuditLogout, "", "", nil)
+
 	c.SetCookie("session_id", "", 0, "/", c.Request.Host, true, true)
 	c.Status(http.StatusOK)
 	return
 }
 
 func GetAllSessions(c *gin.Context) {
+	RecordAudit(c, AuditListSessions, "", "", nil)
+
 	sessions, err := database.Db.Queries.GetAllSessions(c)
 	if err != nil {
 		switch {
@@ -4,6 +4,7 @@ import (
 	"calenduh-backend/internal/database"
 	"calenduh-backend/internal/sqlc"
 	"calenduh-backend/internal/util"
+	"calenduh-backend/internal/webcal"
 	"errors"
 	"fmt"
 	"github.com/arran4/golang-ical"
@@ -20,6 +21,9 @@ import (
 	"time"
 )
 
+// defaultCalendarColor is used for calendars created without the user picking a color.
+const defaultCalendarColor = "#4285F4"
+
 func GetAllCalendars(c *gin.Context) {
 	calendars, err := database.Db.Queries.GetAllCalendars(c)
 	if err != nil {
@@ -32,22 +36,7 @@ func GetAllCalendars(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, calendars)
-}
-
-func GetAllPublicCalendars(c *gin.Context) {
-	calendars, err := database.Db.Queries.GetAllPublicCalendars(c)
-	if err != nil {
-		switch {
-		case errors.Is(err, pgx.ErrNoRows):
-			c.JSON(http.StatusOK, make([]sqlc.Calendar, 0))
-		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		}
-		return
-	}
-
-	c.JSON(http.StatusOK, calendars)
+	RespondList(c, calendars, ListOptions[sqlc.Calendar]{Sorts: CalendarSorts, DefaultSort: "title"})
 }
 
 func GetCalendar(c *gin.Context) {
@@ -74,11 +63,14 @@ func GetCalendar(c *gin.Context) {
 	}
 
 	if calendar.IsWebBased {
-		_, found := util.WebCalendars.Get(calendar.CalendarID)
+		_, found, err := util.WebCalendars.Get(c, calendar.CalendarID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 		if !found {
-			cal, err := ics.ParseCalendarFromUrl(*calendar.Url)
-			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			cal, ok := fetchWebCalendar(c, *calendar.Url)
+			if !ok {
 				return
 			}
 
@@ -92,7 +84,7 @@ func GetCalendar(c *gin.Context) {
 		}
 	}
 
-	c.JSON(http.StatusOK, calendar)
+	JSONWithETag(c, VersionETag(calendar.ChangeSeq), calendar)
 }
 
 func GetCalendarICal(c *gin.Context, calendarId string) {
@@ -126,6 +118,24 @@ func GetCalendarICal(c *gin.Context, calendarId string) {
 		return
 	}
 
+	attachments, err := calendarICalAttachments(c, calendar.CalendarID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	data := buildICal(calendar, events, attachments)
+	c.Header("Content-Type", "text/calendar; charset=utf-8")
+	c.Header("Content-Disposition", "attachment; filename=\"calendar.ics\"")
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate") // Prevent aggressive caching
+	c.Header("Pragma", "no-cache")
+	c.Header("Expires", "0")
+	c.String(http.StatusOK, data)
+}
+
+// buildICal serializes a calendar and its events as an iCalendar document. Attachments, keyed by event, become ATTACH
+// properties and may be nil.
+func buildICal(calendar sqlc.Calendar, events []sqlc.Event, attachments map[string][]icalAttachment) string {
 	cal := ics.NewCalendar()
 	cal.SetMethod(ics.MethodPublish)
 	cal.SetXWRCalID(calendar.CalendarID)
@@ -167,15 +177,14 @@ func GetCalendarICal(c *gin.Context, calendarId string) {
 				icalEvent.AddRrule(rrule)
 			}
 		}
+
+		for _, attachment := range attachments[event.EventID] {
+			icalEvent.AddAttachment(attachment.URL, ics.WithFmtType(attachment.ContentType),
+				&ics.KeyValues{Key: "FILENAME", Value: []string{attachment.Filename}})
+		}
 	}
 
-	data := cal.Serialize(ics.WithNewLine("\r\n"))
-	c.Header("Content-Type", "text/calendar; charset=utf-8")
-	c.Header("Content-Disposition", "attachment; filename=\"calendar.ics\"")
-	c.Header("Cache-Control", "no-cache, no-store, must-revalidate") // Prevent aggressive caching
-	c.Header("Pragma", "no-cache")
-	c.Header("Expires", "0")
-	c.String(http.StatusOK, data)
+	return cal.Serialize(ics.WithNewLine("\r\n"))
 }
 
 func GetUserCalendars(c *gin.Context) {
@@ -193,11 +202,14 @@ func GetUserCalendars(c *gin.Context) {
 
 	for i, calendar := range calendars {
 		if calendar.IsWebBased {
-			_, found := util.WebCalendars.Get(calendar.CalendarID)
+			_, found, err := util.WebCalendars.Get(c, calendar.CalendarID)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
 			if !found {
-				cal, err := ics.ParseCalendarFromUrl(*calendar.Url)
-				if err != nil {
-					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				cal, ok := fetchWebCalendar(c, *calendar.Url)
+				if !ok {
 					return
 				}
 
@@ -212,7 +224,7 @@ func GetUserCalendars(c *gin.Context) {
 		}
 	}
 
-	c.JSON(http.StatusOK, calendars)
+	RespondList(c, calendars, ListOptions[sqlc.Calendar]{Sorts: CalendarSorts, DefaultSort: "title"})
 }
 
 func GetGroupCalendars(c *gin.Context) {
@@ -230,7 +242,7 @@ func GetGroupCalendars(c *gin.Context) {
 				return
 			}
 
-			c.JSON(http.StatusOK, calendars)
+			RespondList(c, calendars, ListOptions[sqlc.Calendar]{Sorts: CalendarSorts, DefaultSort: "title"})
 			return
 		}
 	}
@@ -250,7 +262,7 @@ func GetAllGroupCalendars(c *gin.Context) {
 		calendars = append(calendars, groupCalendars...)
 	}
 
-	c.JSON(http.StatusOK, calendars)
+	RespondList(c, calendars, ListOptions[sqlc.Calendar]{Sorts: CalendarSorts, DefaultSort: "title"})
 }
 
 func GetSubscribedCalendars(c *gin.Context) {
@@ -266,7 +278,7 @@ func GetSubscribedCalendars(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, calendars)
+	RespondList(c, calendars, ListOptions[sqlc.Calendar]{Sorts: CalendarSorts, DefaultSort: "title"})
 }
 
 func CreateUserCalendar(c *gin.Context) {
@@ -281,8 +293,22 @@ func CreateUserCalendar(c *gin.Context) {
 	input.UserID = &user.UserID
 	input.GroupID = nil
 
-	calendar, err := database.Db.Queries.CreateCalendar(c, input)
-	if err != nil {
+	var err error
+	if input.Tags, err = normalizeTags(input.Tags); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid input: " + err.Error()})
+		return
+	}
+	if err := validateDescription(input.Description); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid input: " + err.Error()})
+		return
+	}
+
+	var calendar sqlc.Calendar
+	if err := database.TransactionAs(c, user.UserID, func(queries *sqlc.Queries) error {
+		var err error
+		calendar, err = queries.CreateCalendar(c, input)
+		return err
+	}); err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to create calendar" + err.Error()})
 		return
 	}
@@ -291,6 +317,7 @@ func CreateUserCalendar(c *gin.Context) {
 }
 
 func CreateGroupCalendar(c *gin.Context) {
+	user := *ParseUser(c)
 	groups := *ParseGroups(c)
 	groupId := c.Param("group_id")
 	if groupId == "" {
@@ -308,13 +335,30 @@ func CreateGroupCalendar(c *gin.Context) {
 	input.GroupID = &groupId
 	input.UserID = nil
 
+	var err error
+	if input.Tags, err = normalizeTags(input.Tags); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid input: " + err.Error()})
+		return
+	}
+	if err := validateDescription(input.Description); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid input: " + err.Error()})
+		return
+	}
+
 	if !CanEditGroup(*input.GroupID, groups) {
 		c.AbortWithStatus(http.StatusUnauthorized)
 		return
 	}
+	if !requireGroupPermission(c, groupId, findGroup(groupId, groups).MembersCanCreateCalendars, "create calendars") {
+		return
+	}
 
-	calendar, err := database.Db.Queries.CreateCalendar(c, input)
-	if err != nil {
+	var calendar sqlc.Calendar
+	if err := database.TransactionAs(c, user.UserID, func(queries *sqlc.Queries) error {
+		var err error
+		calendar, err = queries.CreateCalendar(c, input)
+		return err
+	}); err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to create calendar" + err.Error()})
 		return
 	}
@@ -340,6 +384,13 @@ func UpdateCalendar(c *gin.Context) {
 	input.CalendarID = calendarId
 	input.UserID = &user.UserID
 
+	version, err := ParseIfMatch(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+		return
+	}
+	input.Version = version
+
 	calendar, err := database.Db.Queries.GetCalendarById(c, input.CalendarID)
 	if err != nil {
 		switch {
@@ -356,9 +407,43 @@ func UpdateCalendar(c *gin.Context) {
 		return
 	}
 
-	calendar, err = database.Db.Queries.UpdateCalendar(c, input)
-	if err != nil {
+	// Moving a calendar into a group adds a calendar to it, which is held to the same rules as creating one there
+	if input.GroupID != nil && (calendar.GroupID == nil || *calendar.GroupID != *input.GroupID) {
+		groupId := *input.GroupID
+		if !CanEditGroup(groupId, groups) {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		if !requireGroupPermission(c, groupId, findGroup(groupId, groups).MembersCanCreateCalendars, "create calendars") {
+			return
+		}
+	}
+
+	// Moving a calendar out of a group hands it to the caller, so members need the same permission as to create one there
+	if calendar.GroupID != nil && (input.GroupID == nil || *input.GroupID != *calendar.GroupID) {
+		groupId := *calendar.GroupID
+		if !CanEditGroup(groupId, groups) {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		if !requireGroupPermission(c, groupId, findGroup(groupId, groups).MembersCanCreateCalendars, "remove calendars") {
+			return
+		}
+	}
+
+	if input.Version != nil && *input.Version != calendar.ChangeSeq {
+		c.Header("ETag", VersionETag(calendar.ChangeSeq))
+		c.AbortWithStatusJSON(http.StatusPreconditionFailed, gin.H{"error": errPreconditionFailed.Error()})
+		return
+	}
+
+	if err = database.TransactionAs(c, user.UserID, func(queries *sqlc.Queries) error {
+		calendar, err = queries.UpdateCalendar(c, input)
+		return err
+	}); err != nil {
 		switch {
+		case errors.Is(err, pgx.ErrNoRows) && input.Version != nil: // Modified since it was read above
+			c.AbortWithStatusJSON(http.StatusPreconditionFailed, gin.H{"error": errPreconditionFailed.Error()})
 		case errors.Is(err, pgx.ErrNoRows):
 			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "event not found"})
 		default:
@@ -367,9 +452,122 @@ func UpdateCalendar(c *gin.Context) {
 		return
 	}
 
+	c.Header("ETag", VersionETag(calendar.ChangeSeq))
+	c.JSON(http.StatusOK, calendar)
+}
+
+// PatchCalendar
+// @Summary Partially update a calendar
+// @Description Applies a JSON Merge Patch to a calendar's title, color and visibility.
+func PatchCalendar(c *gin.Context) {
+	user := *ParseUser(c)
+	groups := *ParseGroups(c)
+	calendarId := c.Param("calendar_id")
+	if calendarId == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "calendar_id is required"})
+		return
+	}
+
+	patch, err := BindMergePatch(c, "title", "color", "is_public", "description", "tags")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid input: " + err.Error()})
+		return
+	}
+
+	input, err := parseCalendarPatch(patch)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid input: " + err.Error()})
+		return
+	}
+
+	input.CalendarID = calendarId
+
+	version, err := ParseIfMatch(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+		return
+	}
+	input.Version = version
+
+	calendar, err := database.Db.Queries.GetCalendarById(c, input.CalendarID)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "calendar not found"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if !CanEditCalendar(calendar, user.UserID, groups) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	if input.Version != nil && *input.Version != calendar.ChangeSeq {
+		c.Header("ETag", VersionETag(calendar.ChangeSeq))
+		c.AbortWithStatusJSON(http.StatusPreconditionFailed, gin.H{"error": errPreconditionFailed.Error()})
+		return
+	}
+
+	if err = database.TransactionAs(c, user.UserID, func(queries *sqlc.Queries) error {
+		calendar, err = queries.PatchCalendar(c, input)
+		return err
+	}); err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows) && input.Version != nil: // Modified since it was read above
+			c.AbortWithStatusJSON(http.StatusPreconditionFailed, gin.H{"error": errPreconditionFailed.Error()})
+		case errors.Is(err, pgx.ErrNoRows):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "calendar not found"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.Header("ETag", VersionETag(calendar.ChangeSeq))
 	c.JSON(http.StatusOK, calendar)
 }
 
+func parseCalendarPatch(patch MergePatch) (sqlc.PatchCalendarParams, error) {
+	var input sqlc.PatchCalendarParams
+	var err error
+
+	if input.Title, err = PatchValue[string](patch, "title"); err != nil {
+		return input, err
+	}
+	if input.Color, err = PatchValue[string](patch, "color"); err != nil {
+		return input, err
+	}
+	if input.IsPublic, err = PatchValue[bool](patch, "is_public"); err != nil {
+		return input, err
+	}
+	if input.Description, input.SetDescription, err = PatchNullable[string](patch, "description"); err != nil {
+		return input, err
+	}
+
+	tags, setTags, err := PatchNullable[[]string](patch, "tags")
+	if err != nil {
+		return input, err
+	}
+	if setTags {
+		// Clearing tags leaves an empty list, which still overwrites the current tags
+		if tags == nil {
+			tags = &[]string{}
+		}
+		if input.Tags, err = normalizeTags(*tags); err != nil {
+			return input, err
+		}
+	}
+
+	return input, errors.Join(
+		validateRequired("title", input.Title),
+		validateColor(input.Color),
+		validateDescription(input.Description),
+	)
+}
+
 func DeleteCalendar(c *gin.Context) {
 	user := *ParseUser(c)
 	groups := *ParseGroups(c)
@@ -395,11 +593,17 @@ func DeleteCalendar(c *gin.Context) {
 		return
 	}
 
-	if err = database.Db.Queries.DeleteCalendar(c, calendarId); err != nil {
+	if err = database.TransactionAs(c, user.UserID, func(queries *sqlc.Queries) error {
+		if err := queries.TrashCalendarEvents(c, calendarId); err != nil {
+			return err
+		}
+		return queries.TrashCalendar(c, calendarId)
+	}); err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to delete calendar" + err.Error()})
 		return
 	}
 
+	RecordAudit(c, AuditCalendarDelete, "calendar", calendarId, gin.H{"title": calendar.Title})
 	c.JSON(http.StatusOK, gin.H{"status": "calendar deleted successfully"})
 }
 
@@ -410,6 +614,7 @@ func DeleteAllCalendars(c *gin.Context) {
 		return
 	}
 
+	RecordAudit(c, AuditDeleteAllCalendars, "", "", nil)
 	c.JSON(http.StatusOK, gin.H{"status": "all calendars deleted successfully"})
 }
 
@@ -427,6 +632,20 @@ func CanEditCalendar(calendar sqlc.Calendar, userId string, groups []sqlc.Group)
 	return false
 }
 
+// CanViewCalendar reports whether the user may see a calendar's events: it is public, they can edit it, or they are
+// subscribed with an invite that is still valid.
+func CanViewCalendar(c *gin.Context, calendar sqlc.Calendar) (bool, error) {
+	user := *ParseUser(c)
+	if calendar.IsPublic || CanEditCalendar(calendar, user.UserID, *ParseGroups(c)) {
+		return true, nil
+	}
+
+	return database.Db.Queries.HasValidSubscription(c, sqlc.HasValidSubscriptionParams{
+		UserID:     user.UserID,
+		CalendarID: calendar.CalendarID,
+	})
+}
+
 func ImportICal(c *gin.Context) {
 	file, _, err := c.Request.FormFile("file")
 	if err != nil {
@@ -472,9 +691,8 @@ func SubscribeICal(c *gin.Context) {
 		return
 	}
 
-	cal, err := ics.ParseCalendarFromUrl(params.Url)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	cal, ok := fetchWebCalendar(c, params.Url)
+	if !ok {
 		return
 	}
 
@@ -487,40 +705,54 @@ func SubscribeICal(c *gin.Context) {
 	c.PureJSON(http.StatusOK, calendar)
 }
 
+// fetchWebCalendar downloads a remote calendar, answering with why it could not when that fails. Problems with the
+// url itself are the client's; anything else is the remote server's.
+func fetchWebCalendar(c *gin.Context, url string) (*ics.Calendar, bool) {
+	cal, err := webcal.Fetch(c, url)
+	if err != nil {
+		switch {
+		case errors.Is(err, webcal.ErrInvalidURL), errors.Is(err, webcal.ErrBlockedAddress):
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.AbortWithStatusJSON(http.StatusBadGateway, gin.H{"error": "unable to fetch calendar: " + err.Error()})
+		}
+		return nil, false
+	}
+	return cal, true
+}
+
 func SaveICal(c *gin.Context, cal *ics.Calendar, isWebBased bool, url *string) (*sqlc.Calendar, error) {
 	user := *ParseUser(c)
-	var calName, calID string
+	var calName string
 
 	for _, prop := range cal.CalendarProperties {
-		switch prop.IANAToken {
-		case "X-WR-CALNAME":
+		if prop.IANAToken == "X-WR-CALNAME" {
 			calName = prop.Value
-		case "X-CALENDAR-ID":
-			calID = prop.Value
 		}
 	}
 	if calName == "" {
 		calName = "Imported Calendar"
 	}
-	if calID == "" {
-		// Generate or require a calendar ID
-		calID = uuid.New().String()
-	}
+	// X-CALENDAR-ID is ignored, since a file naming another user's calendar must not replace it
+	calID := uuid.New().String()
 
+	// The events themselves are saved below, so the cache only records that the calendar was refreshed recently
 	if isWebBased {
-		util.WebCalendars.Set(calID, cal, 0)
+		if err := util.WebCalendars.Set(c, calID, time.Now().Format(time.RFC3339)); err != nil {
+			return nil, err
+		}
 	}
 
-	_ = database.Db.Queries.DeleteCalendar(c, calID) // Delete old calendar if it exists somehow
 	calendar, err := database.Db.Queries.CreateCalendar(c, sqlc.CreateCalendarParams{
 		CalendarID: calID,
 		UserID:     &user.UserID,
 		Title:      calName,
-		Color:      "#4285F4",
+		Color:      defaultCalendarColor,
 		IsImported: !isWebBased,
 		IsWebBased: isWebBased,
 		IsPublic:   false,
 		Url:        url,
+		Tags:       []string{},
 	})
 	if err != nil {
 		return nil, err
@@ -602,10 +834,10 @@ func SaveICal(c *gin.Context, cal *ics.Calendar, isWebBased bool, url *string) (
 			priorityPtr = &val
 		}
 
-		eventID := e.GetProperty(ics.ComponentPropertyUniqueId).Value
+		// UIDs come from the file too and may name another user's event, so every imported event gets a new ID
+		eventID := uuid.New().String()
 		name := e.GetProperty(ics.ComponentPropertySummary).Value
 
-		_ = database.Db.Queries.DeleteEvent(c, eventID)
 		_, err = database.Db.Queries.CreateEvent(c, sqlc.CreateEventParams{
 			EventID:     eventID,
 			CalendarID:  calendar.CalendarID,
@@ -0,0 +1,293 @@
+package controllers
+
+import (
+	"calenduh-backend/internal/database"
+	"calenduh-backend/internal/sqlc"
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// AccountDeletionGrace is how long a requested account deletion waits before it is carried out. Zero deletes immediately.
+var AccountDeletionGrace = 14 * 24 * time.Hour
+
+// AccountDeletionResult reports what deleting an account did, including storage objects that could not be removed.
+type AccountDeletionResult struct {
+	Status             string   `json:"status"`
+	UserID             string   `json:"user_id"`
+	GroupsDeleted      []string `json:"groups_deleted"`
+	CalendarsHandedOff int64    `json:"calendars_handed_off"`
+	FilesDeleted       int      `json:"files_deleted"`
+	FilesFailed        []string `json:"files_failed"`
+}
+
+// DeleteMe
+// @Summary Delete self user
+// @Description Schedules the account for deletion after the grace period and signs out every other session. Cancel with DELETE /users/@me/deletion.
+func DeleteMe(c *gin.Context) {
+	user := *ParseUser(c)
+
+	if AccountDeletionGrace <= 0 {
+		result, err := deleteAccount(c, &user.UserID, user.UserID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		RecordAudit(c, AuditUserDelete, "user", user.UserID, gin.H{"files_failed": len(result.FilesFailed)})
+		c.PureJSON(http.StatusOK, result)
+		return
+	}
+
+	deletion, err := database.Db.Queries.GetAccountDeletion(c, user.UserID)
+	if err == nil {
+		c.JSON(http.StatusAccepted, deletion)
+		return
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := database.Transaction(c, func(queries *sqlc.Queries) error {
+		deletion, err = queries.ScheduleAccountDeletion(c, sqlc.ScheduleAccountDeletionParams{
+			UserID:      user.UserID,
+			DeleteAfter: time.Now().Add(AccountDeletionGrace),
+		})
+		if err != nil {
+			return err
+		}
+
+		// Keep the current session so the request can still be cancelled from this device
+		return queries.RevokeOtherSessions(c, sqlc.RevokeOtherSessionsParams{
+			UserID:        user.UserID,
+			KeepSessionID: c.GetString("session_id"),
+		})
+	}); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	RecordAudit(c, AuditUserDeleteRequest, "user", user.UserID, gin.H{"delete_after": deletion.DeleteAfter})
+	c.JSON(http.StatusAccepted, deletion)
+}
+
+// GetMyDeletion
+// @Summary Get pending account deletion
+// @Description Gets when the self user's account is scheduled to be deleted.
+func GetMyDeletion(c *gin.Context) {
+	user := *ParseUser(c)
+
+	deletion, err := database.Db.Queries.GetAccountDeletion(c, user.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "account is not scheduled for deletion"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, deletion)
+}
+
+// CancelMyDeletion
+// @Summary Cancel account deletion
+// @Description Cancels a pending deletion of the self user's account during the grace period.
+func CancelMyDeletion(c *gin.Context) {
+	user := *ParseUser(c)
+
+	cancelled, err := database.Db.Queries.CancelAccountDeletion(c, user.UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if cancelled == 0 {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "account is not scheduled for deletion"})
+		return
+	}
+
+	RecordAudit(c, AuditUserDeleteCancel, "user", user.UserID, nil)
+	c.PureJSON(http.StatusOK, gin.H{"status": "cancelled"})
+}
+
+// DeleteUser
+// @Summary Delete user by id
+// @Description Deletes a user immediately, skipping the grace period.
+func DeleteUser(c *gin.Context) {
+	userId := c.Param("user_id")
+	if userId == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+		return
+	}
+
+	result, err := deleteAccount(c, nil, userId)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	RecordAudit(c, AuditUserDelete, "user", userId, gin.H{"files_failed": len(result.FilesFailed)})
+	c.PureJSON(http.StatusOK, result)
+}
+
+// ProcessAccountDeletions deletes every account whose grace period has run out.
+// Accounts that fail stay scheduled and are retried on the next run.
+func ProcessAccountDeletions(ctx context.Context) error {
+	deletions, err := database.Db.Queries.GetDueAccountDeletions(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, deletion := range deletions {
+		result, err := deleteAccount(ctx, &deletion.UserID, deletion.UserID)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		RecordSystemAudit(ctx, &deletion.UserID, AuditUserDelete, "user", deletion.UserID, gin.H{
+			"requested_at": deletion.RequestedAt,
+			"files_failed": len(result.FilesFailed),
+		})
+	}
+
+	return errors.Join(errs...)
+}
+
+// deleteAccount removes a user along with their storage objects. Group calendars the user owns are handed to
+// their group, and groups the user is the only member of are deleted with everything in them, as nobody would be
+// left to restore them from the trash.
+func deleteAccount(ctx context.Context, actorId *string, userId string) (AccountDeletionResult, error) {
+	result := AccountDeletionResult{
+		Status:        "deleted",
+		UserID:        userId,
+		GroupsDeleted: make([]string, 0),
+		FilesFailed:   make([]string, 0),
+	}
+
+	user, err := database.Db.Queries.GetUserById(ctx, userId)
+	if err != nil {
+		return result, err
+	}
+
+	// Collect keys before the rows referencing them cascade away
+	keys, err := database.Db.Queries.GetUserEventImages(ctx, &userId)
+	if err != nil {
+		return result, err
+	}
+	if user.ProfilePicture != nil && *user.ProfilePicture != "" {
+		keys = append(keys, *user.ProfilePicture)
+	}
+
+	// Attachments and exports are the user's own objects with no upload behind them, so they are deleted directly
+	files, err := database.Db.Queries.GetUserEventAttachmentKeys(ctx, &userId)
+	if err != nil {
+		return result, err
+	}
+
+	exports, err := database.Db.Queries.GetExportsByUserId(ctx, userId)
+	if err != nil {
+		return result, err
+	}
+	for _, export := range exports {
+		if export.ObjectKey != nil {
+			files = append(files, *export.ObjectKey)
+		}
+	}
+
+	// The user's uploads lose their uploader along with the account, so note which they were first
+	uploadKeys, err := database.Db.Queries.GetUserUploadKeys(ctx, &userId)
+	if err != nil {
+		return result, err
+	}
+
+	groups, err := database.Db.Queries.GetGroupsByUserId(ctx, userId)
+	if err != nil {
+		return result, err
+	}
+
+	remove := func(queries *sqlc.Queries) error {
+		handedOff, err := queries.HandOffGroupCalendars(ctx, &userId)
+		if err != nil {
+			return err
+		}
+		result.CalendarsHandedOff = handedOff
+
+		for _, group := range groups {
+			members, err := queries.GetGroupMembers(ctx, group.GroupID)
+			if err != nil {
+				return err
+			}
+
+			if len(members) == 1 {
+				images, err := queries.GetGroupEventImages(ctx, &group.GroupID)
+				if err != nil {
+					return err
+				}
+				attachments, err := queries.GetGroupEventAttachmentKeys(ctx, &group.GroupID)
+				if err != nil {
+					return err
+				}
+
+				if err := queries.DeleteGroup(ctx, group.GroupID); err != nil {
+					return err
+				}
+				keys = append(keys, images...)
+				files = append(files, attachments...)
+				if group.Avatar != nil && *group.Avatar != "" {
+					keys = append(keys, *group.Avatar)
+				}
+				result.GroupsDeleted = append(result.GroupsDeleted, group.GroupID)
+			}
+		}
+
+		return queries.DeleteUser(ctx, userId)
+	}
+
+	if actorId != nil {
+		err = database.TransactionAs(ctx, *actorId, remove)
+	} else {
+		err = database.Transaction(ctx, remove)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	// The account is gone at this point, so report objects that could not be removed instead of failing. Images
+	// others uploaded to its groups stay with them
+	for _, key := range keys {
+		uploaded := slices.Contains(uploadKeys, key)
+		uploadedByDeleted := func(uploader *string) (bool, error) {
+			return uploader == nil && uploaded, nil
+		}
+		if err := deleteImage(ctx, key, uploadedByDeleted); err != nil {
+			log.Printf("unable to delete %s for deleted user %s: %s\n", key, userId, err.Error())
+			result.FilesFailed = append(result.FilesFailed, key)
+			continue
+		}
+		result.FilesDeleted++
+	}
+	for _, key := range files {
+		if err := deleteFile(ctx, key); err != nil {
+			log.Printf("unable to delete %s for deleted user %s: %s\n", key, userId, err.Error())
+			result.FilesFailed = append(result.FilesFailed, key)
+			continue
+		}
+		result.FilesDeleted++
+	}
+
+	return result, nil
+}
@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"calenduh-backend/internal/database"
+	"calenduh-backend/internal/sqlc"
+	"cmp"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// maxDirectoryResults bounds how many public calendars a directory search loads before paging.
+	maxDirectoryResults = 1000
+	maxDirectoryTags    = 50
+	// previewWindow and previewEvents bound the upcoming events shown in a calendar preview.
+	previewWindow = 30 * 24 * time.Hour
+	previewEvents = 20
+)
+
+// DirectoryOwner is the public profile of a calendar's owner.
+type DirectoryOwner struct {
+	UserID   string  `json:"user_id"`
+	Username string  `json:"username"`
+	Name     *string `json:"name"`
+}
+
+// DirectoryCalendar is a public calendar listed in the directory.
+type DirectoryCalendar struct {
+	sqlc.Calendar
+	Owner           DirectoryOwner `json:"owner"`
+	SubscriberCount int64          `json:"subscriber_count"`
+}
+
+// CalendarPreview is a public calendar with its next few events, shown before subscribing.
+type CalendarPreview struct {
+	DirectoryCalendar
+	UpcomingEvents []sqlc.Event `json:"upcoming_events"`
+}
+
+var DirectorySorts = map[string]ListSort[DirectoryCalendar]{
+	"relevance": {Compare: func(a, b DirectoryCalendar) int { return 0 }},
+	"popular": {
+		Compare: func(a, b DirectoryCalendar) int {
+			return cmp.Or(cmp.Compare(b.SubscriberCount, a.SubscriberCount), cmp.Compare(a.CalendarID, b.CalendarID))
+		},
+		Keys: []string{"subscriber_count", "calendar_id"},
+	},
+	"new": {
+		Compare: func(a, b DirectoryCalendar) int {
+			return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), cmp.Compare(a.CalendarID, b.CalendarID))
+		},
+		Keys: []string{"created_at", "calendar_id"},
+	},
+	"title": {
+		Compare: func(a, b DirectoryCalendar) int {
+			return cmp.Or(cmp.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title)), cmp.Compare(a.CalendarID, b.CalendarID))
+		},
+		Keys: []string{"title", "calendar_id"},
+	},
+}
+
+// GetAllPublicCalendars
+// @Summary Browse the public calendar directory
+// @Description Lists public calendars with their owner and subscriber count. Search with q, filter with tag and sort by popular (default), new, title or relevance.
+func GetAllPublicCalendars(c *gin.Context) {
+	params := sqlc.GetPublicDirectoryParams{
+		Query:      optionalQuery(c, "q"),
+		MaxResults: maxDirectoryResults,
+	}
+	if tag := strings.ToLower(strings.TrimSpace(c.Query("tag"))); tag != "" {
+		params.Tag = &tag
+	}
+
+	rows, err := database.Db.Queries.GetPublicDirectory(c, params)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	calendars := make([]DirectoryCalendar, 0, len(rows))
+	for _, row := range rows {
+		calendars = append(calendars, toDirectoryCalendar(row.Calendar, row.OwnerUsername, row.OwnerName, row.SubscriberCount))
+	}
+
+	defaultSort := "popular"
+	if params.Query != nil {
+		defaultSort = "relevance"
+	}
+
+	RespondList(c, calendars, ListOptions[DirectoryCalendar]{
+		Sorts:       DirectorySorts,
+		DefaultSort: defaultSort,
+		Truncated:   len(rows) == maxDirectoryResults,
+	})
+}
+
+// GetPublicCalendarTags
+// @Summary List directory tags
+// @Description Lists the tags used by public calendars, most common first.
+func GetPublicCalendarTags(c *gin.Context) {
+	tags, err := database.Db.Queries.GetPublicDirectoryTags(c, maxDirectoryTags)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if tags == nil {
+		tags = make([]sqlc.GetPublicDirectoryTagsRow, 0)
+	}
+
+	JSONWithContentETag(c, tags)
+}
+
+// GetPublicCalendarPreview
+// @Summary Preview a public calendar
+// @Description Gets a public calendar from the directory with its events over the next 30 days, so it can be checked before subscribing.
+func GetPublicCalendarPreview(c *gin.Context) {
+	calendarId := c.Param("calendar_id")
+	if calendarId == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "calendar_id is required"})
+		return
+	}
+
+	row, err := database.Db.Queries.GetPublicDirectoryCalendar(c, calendarId)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "calendar not found"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	start := time.Now()
+	end := start.Add(previewWindow)
+	events, err := database.Db.Queries.GetEventsByCalendarId(c, sqlc.GetEventsByCalendarIdParams{
+		CalendarID: calendarId,
+		EndTime:    end,
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	events, _, err = GenerateRecurrenceEvents(&events, &start, &end)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(events) > previewEvents {
+		events = events[:previewEvents]
+	}
+
+	JSONWithContentETag(c, CalendarPreview{
+		DirectoryCalendar: toDirectoryCalendar(row.Calendar, row.OwnerUsername, row.OwnerName, row.SubscriberCount),
+		UpcomingEvents:    events,
+	})
+}
+
+func toDirectoryCalendar(calendar sqlc.Calendar, username string, name *string, subscribers int64) DirectoryCalendar {
+	return DirectoryCalendar{
+		Calendar: calendar,
+		Owner: DirectoryOwner{
+			UserID:   *calendar.UserID,
+			Username: username,
+			Name:     name,
+		},
+		SubscriberCount: subscribers,
+	}
+}
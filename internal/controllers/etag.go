@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"calenduh-backend/internal/util"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var errPreconditionFailed = errors.New("resource has been modified")
+
+// VersionETag builds a strong ETag from a row's change sequence number.
+func VersionETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// ParseIfMatch reads the version a client expects to be modifying from the If-Match header.
+// A missing header or "*" returns nil so the update is unconditional.
+func ParseIfMatch(c *gin.Context) (*int64, error) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		return nil, nil
+	}
+
+	// Weak and unquoted tags never match under the strong comparison If-Match requires
+	if !strings.HasPrefix(header, `"`) || !strings.HasSuffix(header, `"`) {
+		return nil, errPreconditionFailed
+	}
+
+	version, err := strconv.ParseInt(strings.Trim(header, `"`), 10, 64)
+	if err != nil {
+		return nil, errPreconditionFailed
+	}
+
+	return &version, nil
+}
+
+// JSONWithETag responds with body and its ETag, or with 304 Not Modified when
+// the client's If-None-Match already holds that ETag.
+func JSONWithETag(c *gin.Context, etag string, body any) {
+	c.Header("ETag", etag)
+
+	if matchesNoneMatch(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.JSON(http.StatusOK, body)
+}
+
+// JSONWithContentETag responds like JSONWithETag, deriving a weak ETag from the serialized body.
+// Used for lists, which have no single version to report.
+func JSONWithContentETag(c *gin.Context, body any) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	etag := `W/"` + util.GetHash(string(data))[:32] + `"`
+	c.Header("ETag", etag)
+
+	if matchesNoneMatch(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+}
+
+// matchesNoneMatch reports whether an If-None-Match header contains etag using weak comparison.
+func matchesNoneMatch(header string, etag string) bool {
+	if header == "" {
+		return false
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -27,13 +27,13 @@ func GetAllEvents(c *gin.Context) {
 		return
 	}
 
-	events, err = GenerateRecurrenceEvents(&events, start, end)
+	events, truncated, err := GenerateRecurrenceEvents(&events, start, end)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, events)
+	RespondList(c, events, ListOptions[sqlc.Event]{Sorts: EventSorts, DefaultSort: "start_time", Truncated: truncated})
 }
 
 func GetUserEvents(c *gin.Context) {
@@ -74,13 +74,13 @@ func GetUserEvents(c *gin.Context) {
 		events = append(events, groupEvents...)
 	}
 
-	events, err = GenerateRecurrenceEvents(&events, start, end)
+	events, truncated, err := GenerateRecurrenceEvents(&events, start, end)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, events)
+	RespondList(c, events, ListOptions[sqlc.Event]{Sorts: EventSorts, DefaultSort: "start_time", Truncated: truncated})
 }
 
 func GetEvent(c *gin.Context) {
@@ -107,7 +107,7 @@ func GetEvent(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, event)
+	JSONWithETag(c, VersionETag(event.ChangeSeq), event)
 }
 
 func GetCalendarEvents(c *gin.Context) {
@@ -132,13 +132,13 @@ func GetCalendarEvents(c *gin.Context) {
 		return
 	}
 
-	events, err = GenerateRecurrenceEvents(&events, start, end)
+	events, truncated, err := GenerateRecurrenceEvents(&events, start, end)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, events)
+	RespondList(c, events, ListOptions[sqlc.Event]{Sorts: EventSorts, DefaultSort: "start_time", Truncated: truncated})
 }
 
 func CreateEvent(c *gin.Context) {
@@ -175,8 +175,15 @@ func CreateEvent(c *gin.Context) {
 		return
 	}
 
-	event, err := database.Db.Queries.CreateEvent(c, input)
-	if err != nil {
+	if !requireOwnedImage(c, user.UserID, input.Img, nil) {
+		return
+	}
+
+	var event sqlc.Event
+	if err = database.TransactionAs(c, user.UserID, func(queries *sqlc.Queries) error {
+		event, err = queries.CreateEvent(c, input)
+		return err
+	}); err != nil {
 		switch {
 		case errors.Is(err, pgx.ErrNoRows):
 			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "calendar not found"})
@@ -213,6 +220,111 @@ func UpdateEvent(c *gin.Context) {
 	input.CalendarID = calendarId
 	input.EventID = eventId
 
+	version, err := ParseIfMatch(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+		return
+	}
+	input.Version = version
+
+	calendar, err := database.Db.Queries.GetCalendarById(c, input.CalendarID)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "calendar not found"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if !CanEditCalendar(calendar, user.UserID, groups) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	existing, err := database.Db.Queries.GetEventById(c, input.EventID)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "event not found"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if input.Version != nil && *input.Version != existing.ChangeSeq {
+		c.Header("ETag", VersionETag(existing.ChangeSeq))
+		c.AbortWithStatusJSON(http.StatusPreconditionFailed, gin.H{"error": errPreconditionFailed.Error()})
+		return
+	}
+
+	if !requireOwnedImage(c, user.UserID, input.Img, existing.Img) {
+		return
+	}
+
+	var event sqlc.Event
+	if err = database.TransactionAs(c, user.UserID, func(queries *sqlc.Queries) error {
+		event, err = queries.UpdateEvent(c, input)
+		return err
+	}); err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows) && input.Version != nil: // Modified since it was read above
+			c.AbortWithStatusJSON(http.StatusPreconditionFailed, gin.H{"error": errPreconditionFailed.Error()})
+		case errors.Is(err, pgx.ErrNoRows):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "event not found"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.Header("ETag", VersionETag(event.ChangeSeq))
+	c.JSON(http.StatusOK, event)
+}
+
+// PatchEvent
+// @Summary Partially update an event
+// @Description Applies a JSON Merge Patch to an event, leaving omitted fields untouched and clearing fields set to null.
+func PatchEvent(c *gin.Context) {
+	user := *ParseUser(c)
+	groups := *ParseGroups(c)
+	calendarId := c.Param("calendar_id")
+	eventId := c.Param("event_id")
+
+	if calendarId == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "calendar_id is required"})
+		return
+	}
+	if eventId == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "event_id is required"})
+		return
+	}
+
+	patch, err := BindMergePatch(c, "name", "location", "description", "notification", "frequency", "priority",
+		"start_time", "end_time", "all_day", "first_notification", "second_notification", "img")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid input: " + err.Error()})
+		return
+	}
+
+	input, err := parseEventPatch(patch)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid input: " + err.Error()})
+		return
+	}
+
+	input.CalendarID = calendarId
+	input.EventID = eventId
+
+	version, err := ParseIfMatch(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+		return
+	}
+	input.Version = version
+
 	calendar, err := database.Db.Queries.GetCalendarById(c, input.CalendarID)
 	if err != nil {
 		switch {
@@ -229,7 +341,7 @@ func UpdateEvent(c *gin.Context) {
 		return
 	}
 
-	event, err := database.Db.Queries.UpdateEvent(c, input)
+	existing, err := database.Db.Queries.GetEventById(c, input.EventID)
 	if err != nil {
 		switch {
 		case errors.Is(err, pgx.ErrNoRows):
@@ -240,9 +352,109 @@ func UpdateEvent(c *gin.Context) {
 		return
 	}
 
+	if input.Version != nil && *input.Version != existing.ChangeSeq {
+		c.Header("ETag", VersionETag(existing.ChangeSeq))
+		c.AbortWithStatusJSON(http.StatusPreconditionFailed, gin.H{"error": errPreconditionFailed.Error()})
+		return
+	}
+
+	// The time range is validated against whichever end is not being patched
+	startTime, endTime := existing.StartTime, existing.EndTime
+	if input.SetStartTime {
+		startTime = input.StartTime
+	}
+	if input.SetEndTime {
+		endTime = input.EndTime
+	}
+	if endTime.Before(startTime) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid input: end_time cannot be before start_time"})
+		return
+	}
+
+	if input.SetImg && !requireOwnedImage(c, user.UserID, input.Img, existing.Img) {
+		return
+	}
+
+	var event sqlc.Event
+	if err = database.TransactionAs(c, user.UserID, func(queries *sqlc.Queries) error {
+		event, err = queries.PatchEvent(c, input)
+		return err
+	}); err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows) && input.Version != nil: // Modified since it was read above
+			c.AbortWithStatusJSON(http.StatusPreconditionFailed, gin.H{"error": errPreconditionFailed.Error()})
+		case errors.Is(err, pgx.ErrNoRows):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "event not found"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.Header("ETag", VersionETag(event.ChangeSeq))
 	c.JSON(http.StatusOK, event)
 }
 
+func parseEventPatch(patch MergePatch) (sqlc.PatchEventParams, error) {
+	var input sqlc.PatchEventParams
+	var err error
+
+	if input.Name, err = PatchValue[string](patch, "name"); err != nil {
+		return input, err
+	}
+	if input.Location, input.SetLocation, err = PatchNullable[string](patch, "location"); err != nil {
+		return input, err
+	}
+	if input.Description, input.SetDescription, err = PatchNullable[string](patch, "description"); err != nil {
+		return input, err
+	}
+	if input.Notification, input.SetNotification, err = PatchNullable[string](patch, "notification"); err != nil {
+		return input, err
+	}
+	if input.Frequency, input.SetFrequency, err = PatchNullable[string](patch, "frequency"); err != nil {
+		return input, err
+	}
+	if input.Priority, input.SetPriority, err = PatchNullable[int32](patch, "priority"); err != nil {
+		return input, err
+	}
+	if input.AllDay, err = PatchValue[bool](patch, "all_day"); err != nil {
+		return input, err
+	}
+	if input.FirstNotification, input.SetFirstNotification, err = PatchNullable[int32](patch, "first_notification"); err != nil {
+		return input, err
+	}
+	if input.SecondNotification, input.SetSecondNotification, err = PatchNullable[int32](patch, "second_notification"); err != nil {
+		return input, err
+	}
+	if input.Img, input.SetImg, err = PatchNullable[string](patch, "img"); err != nil {
+		return input, err
+	}
+
+	startTime, err := PatchValue[time.Time](patch, "start_time")
+	if err != nil {
+		return input, err
+	}
+	if startTime != nil {
+		input.StartTime, input.SetStartTime = *startTime, true
+	}
+
+	endTime, err := PatchValue[time.Time](patch, "end_time")
+	if err != nil {
+		return input, err
+	}
+	if endTime != nil {
+		input.EndTime, input.SetEndTime = *endTime, true
+	}
+
+	return input, errors.Join(
+		validateRequired("name", input.Name),
+		validateFrequency(input.Frequency),
+		validateNonNegative("priority", input.Priority),
+		validateNonNegative("first_notification", input.FirstNotification),
+		validateNonNegative("second_notification", input.SecondNotification),
+	)
+}
+
 func DeleteEvent(c *gin.Context) {
 	user := *ParseUser(c)
 	groups := *ParseGroups(c)
@@ -274,7 +486,9 @@ func DeleteEvent(c *gin.Context) {
 		return
 	}
 
-	if err = database.Db.Queries.DeleteEvent(c.Request.Context(), eventId); err != nil {
+	if err = database.TransactionAs(c, user.UserID, func(queries *sqlc.Queries) error {
+		return queries.TrashEvent(c, eventId)
+	}); err != nil {
 		switch {
 		case errors.Is(err, pgx.ErrNoRows):
 			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "event not found"})
@@ -284,6 +498,7 @@ func DeleteEvent(c *gin.Context) {
 		return
 	}
 
+	RecordAudit(c, AuditEventDelete, "event", eventId, gin.H{"calendar_id": calendarId})
 	c.JSON(http.StatusOK, gin.H{"status": "event deleted successfully"})
 }
 
@@ -304,7 +519,7 @@ func PruneEvents(c *gin.Context) {
 		return
 	}
 
-	if err = database.Transaction(c, func(queries *sqlc.Queries) error {
+	if err = database.TransactionAs(c, user.UserID, func(queries *sqlc.Queries) error {
 		for _, event := range events {
 			if event.Frequency != nil && *event.Frequency != "" {
 				expr, err := cronexpr.Parse(*event.Frequency)
@@ -329,8 +544,10 @@ func PruneEvents(c *gin.Context) {
 		return nil
 	}); err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
+	RecordAudit(c, AuditEventPrune, "user", user.UserID, nil)
 }
 
 func DeleteAllEvents(c *gin.Context) {
@@ -340,6 +557,7 @@ func DeleteAllEvents(c *gin.Context) {
 		return
 	}
 
+	RecordAudit(c, AuditDeleteAllEvents, "", "", nil)
 	c.JSON(http.StatusOK, gin.H{"status": "all events deleted successfully"})
 }
 
@@ -394,8 +612,14 @@ func ParseRange(c *gin.Context) (*time.Time, *time.Time) {
 	return &start, &end
 }
 
-func GenerateRecurrenceEvents(events *[]sqlc.Event, start, end *time.Time) ([]sqlc.Event, error) {
+// maxRecurrenceEvents caps how many events GenerateRecurrenceEvents returns once recurrences are expanded.
+const maxRecurrenceEvents = 200
+
+// GenerateRecurrenceEvents expands recurring events into their occurrences within the range, sorted by start time.
+// It reports truncated when the result hit maxRecurrenceEvents and occurrences were left out.
+func GenerateRecurrenceEvents(events *[]sqlc.Event, start, end *time.Time) ([]sqlc.Event, bool, error) {
 	includedEvents := make([]sqlc.Event, 0)
+	truncated := false
 
 	for _, event := range *events {
 		if event.StartTime.After(*start) {
@@ -405,7 +629,7 @@ func GenerateRecurrenceEvents(events *[]sqlc.Event, start, end *time.Time) ([]sq
 			duration := event.EndTime.Sub(event.StartTime)
 			expr, err := cronexpr.Parse(*event.Frequency)
 			if err != nil {
-				return nil, err
+				return nil, false, err
 			}
 
 			for date := expr.Next(event.EndTime); date.Before(*end) && date.After(time.Time{}); date = expr.Next(date) {
@@ -416,7 +640,8 @@ func GenerateRecurrenceEvents(events *[]sqlc.Event, start, end *time.Time) ([]sq
 				if nextEvent.StartTime.After(*start) && nextEvent.StartTime.Before(*end) {
 					includedEvents = append(includedEvents, nextEvent)
 				}
-				if len(includedEvents) > 200 {
+				if len(includedEvents) > maxRecurrenceEvents {
+					truncated = true
 					break
 				}
 			}
@@ -430,5 +655,5 @@ func GenerateRecurrenceEvents(events *[]sqlc.Event, start, end *time.Time) ([]sq
 		return a.StartTime.Before(b.StartTime)
 	})
 
-	return includedEvents, nil
+	return includedEvents, truncated, nil
 }
@@ -0,0 +1,412 @@
+package controllers
+
+import (
+	"archive/zip"
+	"calenduh-backend/internal/database"
+	"calenduh-backend/internal/sqlc"
+	"calenduh-backend/internal/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"time"
+)
+
+const (
+	ExportPending = "pending"
+	ExportRunning = "running"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+const (
+	// ExportRetention is how long a finished archive can be downloaded before it is deleted.
+	ExportRetention = 7 * 24 * time.Hour
+	// exportLinkExpiry is how long a download link stays valid once handed out.
+	exportLinkExpiry = 15 * time.Minute
+	// exportStaleAfter is how long a running export may go without finishing before another worker picks it up.
+	exportStaleAfter = time.Hour
+)
+
+// ExportResponse is an export's status, with a short-lived download link once it is ready.
+type ExportResponse struct {
+	sqlc.Export
+	DownloadURL *string `json:"download_url"`
+}
+
+// ExportManifest describes the contents of an export archive.
+type ExportManifest struct {
+	ExportID     string         `json:"export_id"`
+	UserID       string         `json:"user_id"`
+	GeneratedAt  time.Time      `json:"generated_at"`
+	Counts       map[string]int `json:"counts"`
+	MissingFiles []string       `json:"missing_files"`
+}
+
+// ExportSession is a session without its credentials.
+type ExportSession struct {
+	Type      sqlc.SessionType `json:"type"`
+	ExpiresOn time.Time        `json:"expires_on"`
+}
+
+// RequestExport
+// @Summary Request a copy of account data
+// @Description Starts building an archive of the user's profile, sessions, groups, calendars, events, subscriptions and images. Returns the export already in progress if there is one.
+func RequestExport(c *gin.Context) {
+	user := *ParseUser(c)
+
+	export, err := database.Db.Queries.GetActiveExport(c, user.UserID)
+	if err == nil {
+		c.JSON(http.StatusAccepted, ExportResponse{Export: export})
+		return
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	exportId, err := gonanoid.New()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	export, err = database.Db.Queries.CreateExport(c, sqlc.CreateExportParams{
+		ExportID: exportId,
+		UserID:   user.UserID,
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	RecordAudit(c, AuditUserExport, "export", exportId, nil)
+
+	// Start right away rather than waiting for the next scheduled run
+	go func() {
+		if err := ProcessExports(context.Background()); err != nil {
+			log.Printf("unable to process exports: %s\n", err.Error())
+		}
+	}()
+
+	c.JSON(http.StatusAccepted, ExportResponse{Export: export})
+}
+
+// GetExports
+// @Summary List account data exports
+// @Description Lists the user's exports newest first, with download links for those that are ready.
+func GetExports(c *gin.Context) {
+	user := *ParseUser(c)
+
+	exports, err := database.Db.Queries.GetExportsByUserId(c, user.UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := make([]ExportResponse, 0, len(exports))
+	for _, export := range exports {
+		item, err := toExportResponse(c, export)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		response = append(response, item)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetExport
+// @Summary Get an account data export
+// @Description Gets an export's status, with a download link valid for 15 minutes once it is ready.
+func GetExport(c *gin.Context) {
+	user := *ParseUser(c)
+	exportId := c.Param("export_id")
+	if exportId == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "export_id is required"})
+		return
+	}
+
+	export, err := database.Db.Queries.GetExportById(c, sqlc.GetExportByIdParams{
+		ExportID: exportId,
+		UserID:   user.UserID,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "export not found"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	response, err := toExportResponse(c, export)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ProcessExports builds every pending export, one at a time, until none are left.
+// Exports are claimed with skip locked so several workers can run at once.
+func ProcessExports(ctx context.Context) error {
+	for {
+		export, err := database.Db.Queries.ClaimExport(ctx, time.Now().Add(-exportStaleAfter))
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil
+			}
+			return err
+		}
+
+		if err := buildExport(ctx, export); err != nil {
+			log.Printf("unable to build export %s: %s\n", export.ExportID, err.Error())
+			if err := database.Db.Queries.FailExport(ctx, sqlc.FailExportParams{
+				Error:     err.Error(),
+				ExpiresAt: time.Now().Add(ExportRetention),
+				ExportID:  export.ExportID,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// PurgeExports deletes exports, and their archives, once they have expired.
+func PurgeExports(ctx context.Context) error {
+	exports, err := database.Db.Queries.GetExpiredExports(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, export := range exports {
+		if export.ObjectKey != nil {
+			if err := deleteFile(ctx, *export.ObjectKey); err != nil {
+				return err
+			}
+		}
+
+		if err := database.Db.Queries.DeleteExport(ctx, export.ExportID); err != nil {
+			return err
+		}
+	}
+
+	if len(exports) > 0 {
+		log.Printf("purged %d expired exports\n", len(exports))
+	}
+
+	return nil
+}
+
+// buildExport writes the user's data to a zip archive on disk, then uploads it.
+func buildExport(ctx context.Context, export sqlc.Export) error {
+	file, err := os.CreateTemp("", "export-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	archive := zip.NewWriter(file)
+	if err := writeExport(ctx, archive, export); err != nil {
+		return err
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	key := "exports/" + export.UserID + "/" + export.ExportID + ".zip"
+	if err := storage.Default.Put(ctx, key, file, "application/zip"); err != nil {
+		return err
+	}
+
+	return database.Db.Queries.CompleteExport(ctx, sqlc.CompleteExportParams{
+		ObjectKey: key,
+		SizeBytes: size,
+		ExpiresAt: time.Now().Add(ExportRetention),
+		ExportID:  export.ExportID,
+	})
+}
+
+func writeExport(ctx context.Context, archive *zip.Writer, export sqlc.Export) error {
+	manifest := ExportManifest{
+		ExportID:     export.ExportID,
+		UserID:       export.UserID,
+		GeneratedAt:  time.Now().UTC(),
+		Counts:       make(map[string]int),
+		MissingFiles: make([]string, 0),
+	}
+
+	user, err := database.Db.Queries.GetUserById(ctx, export.UserID)
+	if err != nil {
+		return err
+	}
+	if err := writeExportJSON(archive, "user.json", user); err != nil {
+		return err
+	}
+
+	sessions, err := database.Db.Queries.GetSessionsByUserId(ctx, user.UserID)
+	if err != nil {
+		return err
+	}
+	exportSessions := make([]ExportSession, 0, len(sessions))
+	for _, session := range sessions {
+		exportSessions = append(exportSessions, ExportSession{Type: session.Type, ExpiresOn: session.ExpiresOn})
+	}
+	manifest.Counts["sessions"] = len(exportSessions)
+	if err := writeExportJSON(archive, "sessions.json", exportSessions); err != nil {
+		return err
+	}
+
+	groups, err := database.Db.Queries.GetGroupsByUserId(ctx, user.UserID)
+	if err != nil {
+		return err
+	}
+	manifest.Counts["groups"] = len(groups)
+	if err := writeExportJSON(archive, "groups.json", groups); err != nil {
+		return err
+	}
+
+	calendars, err := database.Db.Queries.GetCalendarsByUserId(ctx, &user.UserID)
+	if err != nil {
+		return err
+	}
+	manifest.Counts["calendars"] = len(calendars)
+	if err := writeExportJSON(archive, "calendars.json", calendars); err != nil {
+		return err
+	}
+
+	allEvents := make([]sqlc.Event, 0)
+	for _, calendar := range calendars {
+		events, err := database.Db.Queries.GetEventsByCalendarId(ctx, sqlc.GetEventsByCalendarIdParams{
+			CalendarID: calendar.CalendarID,
+			EndTime:    time.UnixMilli(1 << 48),
+		})
+		if err != nil {
+			return err
+		}
+		allEvents = append(allEvents, events...)
+
+		entry, err := archive.Create("calendars/" + calendar.CalendarID + ".ics")
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(entry, buildICal(calendar, events, nil)); err != nil {
+			return err
+		}
+	}
+	manifest.Counts["events"] = len(allEvents)
+	if err := writeExportJSON(archive, "events.json", allEvents); err != nil {
+		return err
+	}
+
+	subscriptions, err := database.Db.Queries.GetSubscribedCalendars(ctx, user.UserID)
+	if err != nil {
+		return err
+	}
+	manifest.Counts["subscriptions"] = len(subscriptions)
+	if err := writeExportJSON(archive, "subscriptions.json", subscriptions); err != nil {
+		return err
+	}
+
+	keys := make(map[string]string)
+	if user.ProfilePicture != nil && *user.ProfilePicture != "" {
+		keys[*user.ProfilePicture] = "files/profile/" + path.Base(*user.ProfilePicture)
+	}
+	for _, event := range allEvents {
+		if event.Img != nil && *event.Img != "" {
+			keys[*event.Img] = "files/events/" + event.EventID + path.Ext(*event.Img)
+		}
+
+		attachments, err := database.Db.Queries.GetEventAttachments(ctx, event.EventID)
+		if err != nil {
+			return err
+		}
+		for _, attachment := range attachments {
+			keys[attachment.ObjectKey] = "files/attachments/" + attachment.AttachmentID + "/" + attachment.Filename
+		}
+	}
+
+	for key, name := range keys {
+		found, err := copyExportFile(ctx, archive, key, name)
+		if err != nil {
+			return err
+		}
+		if found {
+			manifest.Counts["files"]++
+		} else {
+			manifest.MissingFiles = append(manifest.MissingFiles, name)
+		}
+	}
+
+	return writeExportJSON(archive, "manifest.json", manifest)
+}
+
+func writeExportJSON(archive *zip.Writer, name string, value any) error {
+	entry, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+// copyExportFile streams an object from the bucket into the archive, reporting false if it no longer exists.
+func copyExportFile(ctx context.Context, archive *zip.Writer, key string, name string) (bool, error) {
+	object, err := storage.Default.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer object.Close()
+
+	entry, err := archive.Create(name)
+	if err != nil {
+		return false, err
+	}
+	if _, err := io.Copy(entry, object); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func toExportResponse(ctx context.Context, export sqlc.Export) (ExportResponse, error) {
+	response := ExportResponse{Export: export}
+	if export.Status != ExportReady || export.ObjectKey == nil {
+		return response, nil
+	}
+
+	url, err := storage.Default.URL(ctx, *export.ObjectKey, storage.URLOptions{
+		Expiry:   exportLinkExpiry,
+		Filename: "calenduh-export.zip",
+	})
+	if err != nil {
+		return response, err
+	}
+
+	response.DownloadURL = &url
+	return response, nil
+}
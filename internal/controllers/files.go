@@ -2,410 +2,387 @@ package controllers
 
 import (
 	"calenduh-backend/internal/database"
-	"calenduh-backend/internal/util"
-	"fmt"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
+	"calenduh-backend/internal/sqlc"
+	"calenduh-backend/internal/storage"
+	"context"
+	"errors"
 	"github.com/gin-gonic/gin"
-	"github.com/matoous/go-nanoid/v2"
+	"github.com/jackc/pgx/v5"
 	"net/http"
-	"calenduh-backend/internal/sqlc"
 )
 
 // this function specifically uploads profile pictures
 func UploadFile(c *gin.Context) {
 	user := *ParseUser(c)
-	file, err := c.FormFile("file")
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, err.Error())
+
+	upload, ok := receiveImage(c, UploadPurposeProfile)
+	if !ok {
 		return
 	}
 
-	if file.Size > 10<<20 {
-		c.AbortWithStatus(http.StatusRequestEntityTooLarge)
+	updatedUser, err := database.Db.Queries.UpdateUserProfilePicture(c, sqlc.UpdateUserProfilePictureParams{
+		UserID:         user.UserID,
+		ProfilePicture: &upload.FullKey,
+	})
+	if err != nil {
+		_ = deleteImage(c, upload.FullKey, uploadedBy(user.UserID))
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to update profile picture, deleting file"})
 		return
 	}
 
-	if !isValidFileType(file.Header.Get("Content-Type")) {
-		message := gin.H{"message": "File type must be JPEG, PNG, WEBP"}
-		c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, message)
-		return
+	// The old picture is no longer referenced, so failing to delete it only leaves an orphaned object behind
+	if user.ProfilePicture != nil && *user.ProfilePicture != "" {
+		_ = deleteImage(c, *user.ProfilePicture, uploadedBy(user.UserID))
 	}
 
-	client, err := GetS3Client()
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, err.Error())
+	c.JSON(http.StatusOK, gin.H{
+		"key":    upload.FullKey,
+		"user":   updatedUser,
+		"upload": upload,
+	})
+}
+
+// this function uploads images in general (not only profile pictures)
+func UploadFileNotAProfilePicture(c *gin.Context) {
+	upload, ok := receiveImage(c, UploadPurposeFile)
+	if !ok {
 		return
 	}
 
-	key := c.Query("key")
-	if key == "" {
-		key, err = gonanoid.New()
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, err.Error())
-			return
-		}
-	} else {
-		if *user.ProfilePicture != key {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": "key does not match"})
-			return
-		}
+	c.PureJSON(http.StatusOK, upload.FullKey)
+}
+
+// CreateEventImage
+// @Summary Upload an event image
+// @Description Replaces the event's image. The image is stored in avatar, card and full sizes.
+func CreateEventImage(c *gin.Context) {
+	user := *ParseUser(c)
+	event, ok := parseEditableEvent(c)
+	if !ok {
+		return
 	}
 
-	buffer, err := file.Open()
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, err.Error())
+	upload, ok := receiveImage(c, UploadPurposeEvent)
+	if !ok {
 		return
 	}
 
-	_, err = client.PutObject(&s3.PutObjectInput{
-		Body:         buffer,
-		Bucket:       aws.String(util.GetEnv("AWS_BUCKET")),
-		Key:          aws.String(key),
-		StorageClass: aws.String("GLACIER_IR"),
+	updatedEvent, err := database.Db.Queries.UpdateEventImage(c, sqlc.UpdateEventImageParams{
+		EventID:    event.EventID,
+		CalendarID: event.CalendarID,
+		Img:        &upload.FullKey,
 	})
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, err.Error())
+		_ = deleteImage(c, upload.FullKey, uploadedBy(user.UserID))
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to update event image, deleting file"})
 		return
 	}
 
-    updatedUser, err := database.Db.Queries.UpdateUserProfilePicture(c, sqlc.UpdateUserProfilePictureParams{
-        UserID:         user.UserID,
-        ProfilePicture: &key,
-    })
-    if err != nil {
-        _ = deleteFile(key)
-        c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to update profile picture, deleting file"})
-        return
-    }
-
-    c.JSON(http.StatusOK, gin.H{
-        "key": key,
-        "user": updatedUser,
-    })
+	if event.Img != nil && *event.Img != "" {
+		_ = deleteImage(c, *event.Img, uploadedBy(user.UserID))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"key":    upload.FullKey,
+		"event":  updatedEvent,
+		"upload": upload,
+	})
 }
 
-// this function uploads images in general (not only profile pictures)
-func UploadFileNotAProfilePicture(c *gin.Context) {
+func DeleteEventImage(c *gin.Context) {
 	user := *ParseUser(c)
-	file, err := c.FormFile("file")
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, err.Error())
-		return
-	}
-
-	if file.Size > 10<<20 {
-		c.AbortWithStatus(http.StatusRequestEntityTooLarge)
+	event, ok := parseEditableEvent(c)
+	if !ok {
 		return
 	}
 
-	if !isValidFileType(file.Header.Get("Content-Type")) {
-		message := gin.H{"message": "File type must be JPEG, PNG, WEBP"}
-		c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, message)
+	if event.Img == nil || *event.Img == "" {
+		c.Status(http.StatusOK)
 		return
 	}
 
-	client, err := GetS3Client()
+	_, err := database.Db.Queries.UpdateEventImage(c, sqlc.UpdateEventImageParams{
+		EventID:    event.EventID,
+		CalendarID: event.CalendarID,
+		Img:        nil, // set to null
+	})
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, err.Error())
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to delete event image",
+		})
 		return
 	}
 
-	key := c.Query("key")
+	// The image is no longer referenced, so failing to delete it only leaves an orphaned object behind
+	_ = deleteImage(c, *event.Img, uploadedBy(user.UserID))
+
+	c.Status(http.StatusOK)
+}
+
+func DeleteFile(c *gin.Context) {
+	user := *ParseUser(c)
+	key := c.Param("key")
+
 	if key == "" {
-		key, err = gonanoid.New()
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, err.Error())
-			return
-		}
-	} else {
-		if *user.ProfilePicture != key {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": "key does not match"})
-			return
-		}
+		message := gin.H{"message": "file key is required"}
+		c.AbortWithStatusJSON(http.StatusBadRequest, message)
+		return
 	}
 
-	buffer, err := file.Open()
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, err.Error())
+	if user.ProfilePicture == nil || *user.ProfilePicture != key {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": "key does not match"})
 		return
 	}
 
-	_, err = client.PutObject(&s3.PutObjectInput{
-		Body:         buffer,
-		Bucket:       aws.String(util.GetEnv("AWS_BUCKET")),
-		Key:          aws.String(key),
-		StorageClass: aws.String("GLACIER_IR"),
-	})
-	if err != nil {
+	if err := database.Db.Queries.DeleteUserProfilePicture(c, &key); err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	c.PureJSON(http.StatusOK, key)
-	return
+	// The image is no longer referenced, so failing to delete it only leaves an orphaned object behind
+	_ = deleteImage(c, key, uploadedBy(user.UserID))
+
+	c.Status(http.StatusOK)
 }
 
+func deleteFile(ctx context.Context, key string) error {
+	return storage.Default.Delete(ctx, key)
+}
 
-func CreateEventImage(c *gin.Context) {
+// GetProfilePictureURL
+// @Summary Get a link to the user's profile picture
+// @Description Returns a signed link that expires after a few minutes to the full size picture, or to the avatar or card size when size says so.
+func GetProfilePictureURL(c *gin.Context) {
 	user := *ParseUser(c)
-	
-	file, err := c.FormFile("file")
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, err.Error())
+
+	if user.ProfilePicture == nil || *user.ProfilePicture == "" {
+		c.AbortWithStatus(http.StatusNotFound)
 		return
 	}
 
-	calendarId := c.Param("calendar_id")
-	if calendarId == "" {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "calendar_id is required"})
+	respondImageURL(c, *user.ProfilePicture, uploadedBy(user.UserID))
+}
+
+// GetEventImageURL
+// @Summary Get a link to an event image
+// @Description Returns a signed link that expires after a few minutes to the event's image, for anyone who can see the event's calendar. Takes the same size as the profile picture link.
+func GetEventImageURL(c *gin.Context) {
+	calendar, err := database.Db.Queries.GetCalendarById(c, c.Param("calendar_id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "calendar not found"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
-	if file.Size > 10<<20 {
-		c.AbortWithStatus(http.StatusRequestEntityTooLarge)
+	visible, err := CanViewCalendar(c, calendar)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-
-	if !isValidFileType(file.Header.Get("Content-Type")) {
-		message := gin.H{"message": "File type must be JPEG, PNG, WEBP"}
-		c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, message)
+	if !visible {
+		c.AbortWithStatus(http.StatusUnauthorized)
 		return
 	}
 
-	client, err := GetS3Client()
+	event, err := database.Db.Queries.GetEventById(c, c.Param("event_id"))
+	if err == nil && event.CalendarID != calendar.CalendarID {
+		err = pgx.ErrNoRows
+	}
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, err.Error())
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "event not found"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
-	key := c.Query("key")
-	if key == "" {
-		key, err = gonanoid.New()
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, err.Error())
-			return
+	if event.Img == nil || *event.Img == "" {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "event has no image"})
+		return
+	}
+
+	respondImageURL(c, *event.Img, uploadedByEditor(c, calendar))
+}
+
+// uploadedByEditor accepts uploads made by someone who can edit the calendar. Uploads from accounts since deleted
+// have no uploader and are not accepted.
+func uploadedByEditor(ctx context.Context, calendar sqlc.Calendar) func(uploader *string) (bool, error) {
+	return func(uploader *string) (bool, error) {
+		if uploader == nil {
+			return false, nil
 		}
-	} else {
-		if *user.ProfilePicture != key {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": "key does not match"})
-			return
+		if calendar.UserID != nil && *calendar.UserID == *uploader {
+			return true, nil
 		}
+		if calendar.GroupID == nil {
+			return false, nil
+		}
+
+		_, err := database.Db.Queries.GetGroupMember(ctx, sqlc.GetGroupMemberParams{
+			GroupID: *calendar.GroupID,
+			UserID:  *uploader,
+		})
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return false, nil
+			}
+			return false, err
+		}
+		return true, nil
 	}
+}
 
-	buffer, err := file.Open()
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, err.Error())
+// UpdateProfilePicture
+// @Summary Set the user's profile picture
+// @Description Points the profile picture at an image the user already uploaded, given its full key.
+func UpdateProfilePicture(c *gin.Context) {
+	user := *ParseUser(c)
+	var request struct {
+		Key string `json:"key"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
 		return
 	}
-
-	_, err = client.PutObject(&s3.PutObjectInput{
-		Body:         buffer,
-		Bucket:       aws.String(util.GetEnv("AWS_BUCKET")),
-		Key:          aws.String(key),
-		StorageClass: aws.String("GLACIER_IR"),
+	if !requireOwnedImage(c, user.UserID, &request.Key, user.ProfilePicture) {
+		return
+	}
+	updatedUser, err := database.Db.Queries.UpdateUserProfilePicture(c, sqlc.UpdateUserProfilePictureParams{
+		UserID:         user.UserID,
+		ProfilePicture: &request.Key,
 	})
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, err.Error())
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// TODO: FIXXXXXXXXXX
-    updatedUser, err := database.Db.Queries.UpdateEventImage(c, sqlc.UpdateEventImageParams{
-        CalendarID: 	   calendarId,
-        Img: &key,
-    })
-
-    if err != nil {
-        _ = deleteFile(key)
-        c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to update profile picture, deleting file"})
-        return
-    }
-
-    c.JSON(http.StatusOK, gin.H{
-        "key": key,
-        "user": updatedUser,
-    })
-}
-
-func DeleteEventImage(c *gin.Context) {
-    eventID := c.Param("event_id")
-    if eventID == "" {
-        c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "event_id is required"})
-        return
-    }
-
-    calendarID := c.Param("calendar_id")
-    if calendarID == "" {
-        c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "calendar_id is required"})
-        return
-    }
-
-	event, err := database.Db.Queries.GetEventById(c, eventID)
-    if err != nil {
-        c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "event not found"})
-        return
-    }
-
-    if event.Img == nil || *event.Img == "" {
-        c.Status(http.StatusOK)
-        return
-    }
-
-	// delete image from s3
-    if err := deleteFile(*event.Img); err != nil {
-        c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
-            "error": "failed to delete image from storage",
-        })
-        return
-    }
-
-    _, err = database.Db.Queries.UpdateEventImage(c, sqlc.UpdateEventImageParams{
-        EventID:    eventID,
-        CalendarID: calendarID,
-        Img:        nil, // set to null
-    })
-    if err != nil {
-        c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
-            "error": "failed to delete event image",
-        })
-        return
-    }
-
-    c.Status(http.StatusOK)
+	c.JSON(http.StatusOK, updatedUser)
 }
 
-func DeleteFile(c *gin.Context) {
+func DeleteProfilePicture(c *gin.Context) {
 	user := *ParseUser(c)
-	key := c.Param("key")
 
-	if key == "" {
-		message := gin.H{"message": "file key is required"}
-		c.AbortWithStatusJSON(http.StatusBadRequest, message)
+	if user.ProfilePicture == nil || *user.ProfilePicture == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "no profile picture to delete"})
 		return
 	}
 
-	if *user.ProfilePicture != key {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": "key does not match"})
+	_, err := database.Db.Queries.UpdateUserProfilePicture(c, sqlc.UpdateUserProfilePictureParams{
+		UserID:         user.UserID,
+		ProfilePicture: nil,
+	})
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := deleteFile(key); err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, err.Error())
+	// The image is no longer referenced, so failing to delete it only leaves an orphaned object behind
+	_ = deleteImage(c, *user.ProfilePicture, uploadedBy(user.UserID))
+
+	c.Status(http.StatusOK)
+}
+
+// UploadGroupAvatar
+// @Summary Upload a group avatar
+// @Description Replaces the group's avatar with a JPEG, PNG, WEBP or GIF image of at most 10 MB, stored in avatar, card and full sizes.
+func UploadGroupAvatar(c *gin.Context) {
+	user := *ParseUser(c)
+	groups := *ParseGroups(c)
+	groupId := c.Param("group_id")
+	if !CanEditGroup(groupId, groups) {
+		c.AbortWithStatus(http.StatusUnauthorized)
 		return
 	}
 
-	if err := database.Db.Queries.DeleteUserProfilePicture(c, &key); err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, err.Error())
+	upload, ok := receiveImage(c, UploadPurposeGroup)
+	if !ok {
 		return
 	}
 
-	c.Status(http.StatusOK)
-	return
-}
-
-func GetS3Client() (*s3.S3, error) {
-	sess, err := session.NewSession()
+	previous := findGroup(groupId, groups).Avatar
+	group, err := database.Db.Queries.SetGroupAvatar(c, sqlc.SetGroupAvatarParams{
+		GroupID: groupId,
+		Avatar:  &upload.FullKey,
+	})
 	if err != nil {
-		return nil, err
+		_ = deleteImage(c, upload.FullKey, uploadedBy(user.UserID))
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to update group avatar, deleting file"})
+		return
+	}
+
+	// The old avatar is no longer referenced, so failing to delete it only leaves an orphaned object behind
+	if previous != nil && *previous != "" {
+		_ = deleteImage(c, *previous, uploadedBy(user.UserID))
 	}
 
-	client := s3.New(sess)
-	return client, nil
+	c.JSON(http.StatusOK, gin.H{
+		"key":    upload.FullKey,
+		"group":  group,
+		"upload": upload,
+	})
 }
 
-func deleteFile(key string) error {
-	client, err := GetS3Client()
-	if err != nil {
-		return err
+// DeleteGroupAvatar
+// @Summary Remove a group avatar
+// @Description Deletes the group's avatar image so the group has none.
+func DeleteGroupAvatar(c *gin.Context) {
+	user := *ParseUser(c)
+	groups := *ParseGroups(c)
+	groupId := c.Param("group_id")
+	if !CanEditGroup(groupId, groups) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
 	}
 
-	_, err = client.DeleteObject(&s3.DeleteObjectInput{
-		Bucket: aws.String(util.GetEnv("AWS_BUCKET")),
-		Key:    aws.String(key),
+	avatar := findGroup(groupId, groups).Avatar
+	if avatar == nil || *avatar == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "no group avatar to delete"})
+		return
+	}
+
+	group, err := database.Db.Queries.SetGroupAvatar(c, sqlc.SetGroupAvatarParams{
+		GroupID: groupId,
+		Avatar:  nil,
 	})
 	if err != nil {
-		return err
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	return nil
+	// The image is no longer referenced, so failing to delete it only leaves an orphaned object behind
+	_ = deleteImage(c, *avatar, uploadedBy(user.UserID))
+
+	c.JSON(http.StatusOK, group)
 }
 
-func isValidFileType(fileType string) bool {
-	validFileTypes := []string{
-		"image/jpeg",
-		"image/png",
-		"image/webp",
+// parseEditableEvent loads the event named in the path, aborting unless it belongs to the calendar in the path and
+// the user can edit that calendar.
+func parseEditableEvent(c *gin.Context) (sqlc.Event, bool) {
+	calendar, ok := parseEditableCalendar(c)
+	if !ok {
+		return sqlc.Event{}, false
 	}
 
-	for _, validFileType := range validFileTypes {
-		if fileType == validFileType {
-			return true
+	event, err := database.Db.Queries.GetEventById(c, c.Param("event_id"))
+	if err == nil && event.CalendarID != calendar.CalendarID {
+		err = pgx.ErrNoRows
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "event not found"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		}
+		return sqlc.Event{}, false
 	}
 
-	return false
+	return event, true
 }
-
-func GetProfilePictureURL(c *gin.Context) {
-    user := *ParseUser(c)
-    
-    if user.ProfilePicture == nil || *user.ProfilePicture == "" {
-        c.AbortWithStatus(http.StatusNotFound)
-        return
-    }
-
-    url := fmt.Sprintf("https://%s.s3.amazonaws.com/%s", 
-        util.GetEnv("AWS_BUCKET"),
-        *user.ProfilePicture)
-    
-    c.JSON(http.StatusOK, gin.H{"url": url})
-}
-
-func UpdateProfilePicture(c *gin.Context) {
-    user := *ParseUser(c)
-    var request struct {
-        Key string `json:"key"`
-    }
-    if err := c.BindJSON(&request); err != nil {
-        c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
-        return
-    }
-    updatedUser, err := database.Db.Queries.UpdateUserProfilePicture(c, sqlc.UpdateUserProfilePictureParams{
-        UserID:         user.UserID,
-        ProfilePicture: &request.Key,
-    })
-    if err != nil {
-        c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-        return
-    }
-    
-    c.JSON(http.StatusOK, updatedUser)
-}
-
-func DeleteProfilePicture(c *gin.Context) {
-    user := *ParseUser(c)
-    
-    if user.ProfilePicture == nil || *user.ProfilePicture == "" {
-        c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "no profile picture to delete"})
-        return
-    }
-
-    if err := deleteFile(*user.ProfilePicture); err != nil {
-        c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to delete file from storage"})
-        return
-    }
-
-    _, err := database.Db.Queries.UpdateUserProfilePicture(c, sqlc.UpdateUserProfilePictureParams{
-        UserID:         user.UserID,
-        ProfilePicture: nil,
-    })
-
-    if err != nil {
-        c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-        return
-    }
-    
-    c.Status(http.StatusOK)
-}
\ No newline at end of file
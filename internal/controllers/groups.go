@@ -8,6 +8,7 @@ import (
 	"github.com/jackc/pgx/v5"
 	gonanoid "github.com/matoous/go-nanoid/v2"
 	"net/http"
+	"slices"
 )
 
 func GetAllGroups(c *gin.Context) {
@@ -22,12 +23,17 @@ func GetAllGroups(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, groups)
+	RespondList(c, groups, ListOptions[sqlc.Group]{Sorts: GroupSorts, DefaultSort: "name"})
 }
 
 func GetMyGroups(c *gin.Context) {
-	groups := *ParseGroups(c)
-	c.PureJSON(http.StatusOK, groups)
+	groups, err := redactGroups(c, *ParseGroups(c))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	RespondList(c, groups, ListOptions[sqlc.Group]{Sorts: GroupSorts, DefaultSort: "name"})
 }
 
 func GetGroup(c *gin.Context) {
@@ -40,7 +46,7 @@ func GetGroup(c *gin.Context) {
 
 	for _, group := range groups {
 		if group.GroupID == groupId {
-			c.JSON(http.StatusOK, group)
+			respondGroup(c, http.StatusOK, group)
 			return
 		}
 	}
@@ -48,39 +54,85 @@ func GetGroup(c *gin.Context) {
 	c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "group not found or not permissible"})
 }
 
+// CreateGroup
+// @Summary Create a group
+// @Description Creates a group owned by the user, along with a default group calendar named after it.
 func CreateGroup(c *gin.Context) {
 	user := *ParseUser(c)
-	if err := database.Transaction(c, func(queries *sqlc.Queries) error {
-		var input sqlc.CreateGroupParams
-		if err := c.BindJSON(&input); err != nil {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return nil
-		}
 
-		input.GroupID = gonanoid.Must()
+	var input sqlc.CreateGroupParams
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := errors.Join(
+		validateRequired("name", &input.Name),
+		validateDescription(input.Description),
+		validateColor(input.Color),
+	); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid input: " + err.Error()})
+		return
+	}
 
-		group, err := queries.CreateGroup(c, input)
-		if err != nil {
+	input.GroupID = gonanoid.Must()
+
+	var group sqlc.Group
+	if err := database.TransactionAs(c, user.UserID, func(queries *sqlc.Queries) error {
+		var err error
+		if group, err = queries.CreateGroup(c, input); err != nil {
 			return err
 		}
 
-		params := sqlc.CreateGroupMemberParams{
+		if err = queries.CreateGroupMember(c, sqlc.CreateGroupMemberParams{
 			GroupID: group.GroupID,
 			UserID:  user.UserID,
+		}); err != nil {
+			return err
+		}
+		if err = queries.SetGroupMemberRole(c, sqlc.SetGroupMemberRoleParams{
+			UserID:  user.UserID,
+			GroupID: group.GroupID,
+			Role:    GroupRoleOwner,
+		}); err != nil {
+			return err
+		}
+
+		color := defaultCalendarColor
+		if group.Color != nil {
+			color = *group.Color
 		}
-		if err = queries.CreateGroupMember(c, params); err != nil {
+		calendar, err := queries.CreateCalendar(c, sqlc.CreateCalendarParams{
+			CalendarID: gonanoid.Must(),
+			GroupID:    &group.GroupID,
+			Title:      group.Name,
+			Color:      color,
+			Tags:       []string{},
+		})
+		if err != nil {
 			return err
 		}
 
-		c.JSON(http.StatusCreated, group)
-		return nil
+		group, err = queries.PatchGroup(c, sqlc.PatchGroupParams{
+			GroupID:              group.GroupID,
+			SetDefaultCalendarID: true,
+			DefaultCalendarID:    &calendar.CalendarID,
+		})
+		return err
 	}); err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
+
+	c.JSON(http.StatusCreated, group)
 }
 
+// JoinGroup
+// @Summary Join a group by invite code
+// @Description Adds the user to the group that owns a group or invite link code. Groups that require approval record a pending join request instead and respond 202.
 func JoinGroup(c *gin.Context) {
 	user := *ParseUser(c)
+	groups := *ParseGroups(c)
 	inviteCode := c.Param("invite_code")
 
 	if inviteCode == "" {
@@ -88,7 +140,20 @@ func JoinGroup(c *gin.Context) {
 		return
 	}
 
+	// Codes that are not a group's own invite code may belong to one of its invite links
+	var invite *sqlc.InviteLink
 	group, err := database.Db.Queries.GetGroupByInviteCode(c, inviteCode)
+	if errors.Is(err, pgx.ErrNoRows) {
+		var link sqlc.InviteLink
+		if link, err = database.Db.Queries.GetInviteLinkByCode(c, inviteCode); err == nil {
+			if link.GroupID == nil {
+				err = pgx.ErrNoRows
+			} else {
+				invite = &link
+				group, err = database.Db.Queries.GetGroupById(c, *link.GroupID)
+			}
+		}
+	}
 	if err != nil {
 		switch {
 		case errors.Is(err, pgx.ErrNoRows):
@@ -99,15 +164,51 @@ func JoinGroup(c *gin.Context) {
 		return
 	}
 
-	if err = database.Db.Queries.CreateGroupMember(c, sqlc.CreateGroupMemberParams{
-		UserID:  user.UserID,
-		GroupID: group.GroupID,
+	// Joining twice is a no-op so it doesn't use up an invite link
+	if CanEditGroup(group.GroupID, groups) {
+		respondGroup(c, http.StatusOK, group)
+		return
+	}
+
+	if group.ApprovalRequired {
+		requestToJoin(c, group, invite)
+		return
+	}
+
+	if invite == nil {
+		if err = database.Db.Queries.CreateGroupMember(c, sqlc.CreateGroupMemberParams{
+			UserID:  user.UserID,
+			GroupID: group.GroupID,
+		}); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		RecordAudit(c, AuditGroupJoin, "group", group.GroupID, gin.H{"via": "invite_code"})
+		respondGroup(c, http.StatusOK, group)
+		return
+	}
+
+	if err = database.Transaction(c, func(queries *sqlc.Queries) error {
+		if err := claimInvite(c, queries, *invite, user.UserID); err != nil {
+			return err
+		}
+		return queries.CreateGroupMember(c, sqlc.CreateGroupMemberParams{
+			UserID:  user.UserID,
+			GroupID: group.GroupID,
+		})
 	}); err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		switch {
+		case errors.Is(err, errInviteUnavailable):
+			c.AbortWithStatusJSON(http.StatusGone, gin.H{"error": err.Error()})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
-	c.JSON(http.StatusOK, group)
+	RecordAudit(c, AuditGroupJoin, "group", group.GroupID, gin.H{"via": "invite_link", "invite_id": invite.InviteID})
+	respondGroup(c, http.StatusOK, group)
 }
 
 func LeaveGroup(c *gin.Context) {
@@ -120,13 +221,36 @@ func LeaveGroup(c *gin.Context) {
 		return
 	}
 
-	if err := database.Transaction(c, func(queries *sqlc.Queries) error {
+	if err := database.TransactionAs(c, user.UserID, func(queries *sqlc.Queries) error {
 		for _, group := range groups {
 			members, err := queries.GetGroupMembers(c, group.GroupID)
 			if err != nil {
 				return err
 			}
 			if groupId == group.GroupID {
+				// The last member keeps their membership so the group can be restored from their trash
+				if len(members) == 1 {
+					if err := trashGroup(c, queries, group.GroupID); err != nil {
+						return err
+					}
+
+					RecordAudit(c, AuditGroupLeave, "group", group.GroupID, gin.H{"group_trashed": true})
+					c.Status(http.StatusOK)
+					return nil
+				}
+
+				// A group is never left without an owner, so the longest standing member takes over from the last one
+				successor := nextGroupOwner(members, user.UserID)
+				if successor != nil {
+					if err := queries.SetGroupMemberRole(c, sqlc.SetGroupMemberRoleParams{
+						UserID:  successor.UserID,
+						GroupID: group.GroupID,
+						Role:    GroupRoleOwner,
+					}); err != nil {
+						return err
+					}
+				}
+
 				if err := queries.DeleteGroupMember(c, sqlc.DeleteGroupMemberParams{
 					UserID:  user.UserID,
 					GroupID: group.GroupID,
@@ -134,12 +258,11 @@ func LeaveGroup(c *gin.Context) {
 					return err
 				}
 
-				if len(members) == 1 {
-					if err := queries.DeleteGroup(c, group.GroupID); err != nil {
-						return err
-					}
+				var meta gin.H
+				if successor != nil {
+					meta = gin.H{"new_owner": successor.UserID}
 				}
-
+				RecordAudit(c, AuditGroupLeave, "group", group.GroupID, meta)
 				c.Status(http.StatusOK)
 				return nil
 			}
@@ -151,6 +274,28 @@ func LeaveGroup(c *gin.Context) {
 	return
 }
 
+// nextGroupOwner picks the member who joined first to take over a group its only owner is leaving. It returns nil
+// when the leaving member is not the only owner.
+func nextGroupOwner(members []sqlc.GroupMember, leavingId string) *sqlc.GroupMember {
+	var successor *sqlc.GroupMember
+	for i, member := range members {
+		if member.UserID == leavingId {
+			if member.Role != GroupRoleOwner {
+				return nil
+			}
+			continue
+		}
+		if member.Role == GroupRoleOwner {
+			return nil
+		}
+		if successor == nil || member.JoinedAt.Before(successor.JoinedAt) ||
+			(member.JoinedAt.Equal(successor.JoinedAt) && member.UserID < successor.UserID) {
+			successor = &members[i]
+		}
+	}
+	return successor
+}
+
 func UpdateGroup(c *gin.Context) {
 	groups := *ParseGroups(c)
 	var input sqlc.UpdateGroupParams
@@ -178,14 +323,125 @@ func UpdateGroup(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, group)
+	respondGroup(c, http.StatusOK, group)
+}
+
+// PatchGroup
+// @Summary Partially update a group
+// @Description Applies a JSON Merge Patch to a group, leaving omitted fields untouched.
+func PatchGroup(c *gin.Context) {
+	user := *ParseUser(c)
+	groups := *ParseGroups(c)
+	groupId := c.Param("group_id")
+	if groupId == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "group_id is required"})
+		return
+	}
+
+	if !CanEditGroup(groupId, groups) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	patch, err := BindMergePatch(c, "name", "approval_required", "description", "color", "default_calendar_id",
+		"members_can_create_calendars", "members_can_invite")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid input: " + err.Error()})
+		return
+	}
+
+	input, err := parseGroupPatch(patch)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid input: " + err.Error()})
+		return
+	}
+	input.GroupID = groupId
+
+	// Members could otherwise lift the restrictions placed on them
+	if input.ApprovalRequired != nil || input.MembersCanCreateCalendars != nil || input.MembersCanInvite != nil {
+		owner, err := isGroupOwner(c, groupId, user.UserID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !owner {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "only group owners can change group permissions"})
+			return
+		}
+	}
+
+	if input.DefaultCalendarID != nil {
+		calendar, err := database.Db.Queries.GetCalendarById(c, *input.DefaultCalendarID)
+		if err != nil {
+			switch {
+			case errors.Is(err, pgx.ErrNoRows):
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid input: default calendar not found"})
+			default:
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		if calendar.GroupID == nil || *calendar.GroupID != groupId {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid input: default calendar must belong to the group"})
+			return
+		}
+	}
+
+	group, err := database.Db.Queries.PatchGroup(c, input)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "group not found"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	respondGroup(c, http.StatusOK, group)
+}
+
+func parseGroupPatch(patch MergePatch) (sqlc.PatchGroupParams, error) {
+	var input sqlc.PatchGroupParams
+	var err error
+
+	if input.Name, err = PatchValue[string](patch, "name"); err != nil {
+		return input, err
+	}
+	if input.ApprovalRequired, err = PatchValue[bool](patch, "approval_required"); err != nil {
+		return input, err
+	}
+	if input.Description, input.SetDescription, err = PatchNullable[string](patch, "description"); err != nil {
+		return input, err
+	}
+	if input.Color, input.SetColor, err = PatchNullable[string](patch, "color"); err != nil {
+		return input, err
+	}
+	if input.DefaultCalendarID, input.SetDefaultCalendarID, err = PatchNullable[string](patch, "default_calendar_id"); err != nil {
+		return input, err
+	}
+	if input.MembersCanCreateCalendars, err = PatchValue[bool](patch, "members_can_create_calendars"); err != nil {
+		return input, err
+	}
+	if input.MembersCanInvite, err = PatchValue[bool](patch, "members_can_invite"); err != nil {
+		return input, err
+	}
+
+	return input, errors.Join(
+		validateRequired("name", input.Name),
+		validateDescription(input.Description),
+		validateColor(input.Color),
+	)
 }
 
 func DeleteGroup(c *gin.Context) {
+	user := *ParseUser(c)
 	groups := *ParseGroups(c)
 	groupId := c.Param("group_id")
 	if groupId == "" {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "group_id is required"})
+		return
 	}
 
 	if !CanEditGroup(groupId, groups) {
@@ -193,7 +449,13 @@ func DeleteGroup(c *gin.Context) {
 		return
 	}
 
-	err := database.Db.Queries.DeleteGroup(c, groupId)
+	if !requireGroupPermission(c, groupId, false, "delete the group") {
+		return
+	}
+
+	err := database.TransactionAs(c, user.UserID, func(queries *sqlc.Queries) error {
+		return trashGroup(c, queries, groupId)
+	})
 	if err != nil {
 		switch {
 		case errors.Is(err, pgx.ErrNoRows):
@@ -204,9 +466,41 @@ func DeleteGroup(c *gin.Context) {
 		return
 	}
 
+	RecordAudit(c, AuditGroupDelete, "group", groupId, nil)
 	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
 }
 
+// redactGroups blanks the invite code of the groups the user does not own, since anyone holding it can join.
+func redactGroups(c *gin.Context, groups []sqlc.Group) ([]sqlc.Group, error) {
+	owned, err := database.Db.Queries.GetOwnedGroupIds(c, ParseUser(c).UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	redacted := make([]sqlc.Group, len(groups))
+	for i, group := range groups {
+		if !slices.Contains(owned, group.GroupID) {
+			group.InviteCode = ""
+		}
+		redacted[i] = group
+	}
+	return redacted, nil
+}
+
+// respondGroup responds with a group, leaving out its invite code unless the user owns it.
+func respondGroup(c *gin.Context, status int, group sqlc.Group) {
+	owner, err := isGroupOwner(c, group.GroupID, ParseUser(c).UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !owner {
+		group.InviteCode = ""
+	}
+
+	c.JSON(status, group)
+}
+
 func ParseGroups(c *gin.Context) *[]sqlc.Group {
 	v, found := c.Get("groups")
 	if !found {
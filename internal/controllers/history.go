@@ -0,0 +1,322 @@
+package controllers
+
+import (
+	"calenduh-backend/internal/database"
+	"calenduh-backend/internal/jobs"
+	"calenduh-backend/internal/sqlc"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RevisionResponse is a revision with its snapshot and changes left as raw JSON.
+// Changes maps each modified field to its old and new value and is only present on updates.
+type RevisionResponse struct {
+	RevisionID int64           `json:"revision_id"`
+	EntityType string          `json:"entity_type"`
+	EntityID   string          `json:"entity_id"`
+	CalendarID string          `json:"calendar_id"`
+	Action     string          `json:"action"`
+	ActorID    *string         `json:"actor_id"`
+	Snapshot   json.RawMessage `json:"snapshot"`
+	Changes    json.RawMessage `json:"changes,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	Restorable bool            `json:"restorable"`
+}
+
+// GetEventHistory
+// @Summary Get the revision history of an event
+// @Description Lists every recorded change to an event, newest first, including its deletion.
+func GetEventHistory(c *gin.Context) {
+	user := *ParseUser(c)
+	groups := *ParseGroups(c)
+	calendarId := c.Param("calendar_id")
+	eventId := c.Param("event_id")
+
+	if calendarId == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "calendar_id is required"})
+		return
+	}
+	if eventId == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "event_id is required"})
+		return
+	}
+
+	calendar, err := database.Db.Queries.GetCalendarById(c, calendarId)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "calendar not found"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if !CanEditCalendar(calendar, user.UserID, groups) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	revisions, err := database.Db.Queries.GetEventRevisions(c, sqlc.GetEventRevisionsParams{
+		EntityID:   eventId,
+		CalendarID: calendarId,
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, toRevisionResponses(revisions))
+}
+
+// GetCalendarHistory
+// @Summary Get the revision history of a calendar
+// @Description Lists every recorded change to a calendar, newest first. Deleted calendars remain visible to their former owners.
+func GetCalendarHistory(c *gin.Context) {
+	user := *ParseUser(c)
+	groups := *ParseGroups(c)
+	calendarId := c.Param("calendar_id")
+	if calendarId == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "calendar_id is required"})
+		return
+	}
+
+	revisions, err := database.Db.Queries.GetCalendarRevisions(c, calendarId)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(revisions) == 0 {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "calendar history not found"})
+		return
+	}
+
+	owner, err := revisionOwner(c, revisions[0])
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !CanEditCalendar(owner, user.UserID, groups) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	c.JSON(http.StatusOK, toRevisionResponses(revisions))
+}
+
+// RestoreEventRevision
+// @Summary Restore an event to a previous revision
+// @Description Returns an event to the state recorded by a revision. Restoring a deletion undoes it.
+func RestoreEventRevision(c *gin.Context) {
+	user := *ParseUser(c)
+	groups := *ParseGroups(c)
+
+	revision, ok := parseRestorableRevision(c, "event")
+	if !ok {
+		return
+	}
+
+	calendar, err := database.Db.Queries.GetCalendarById(c, revision.CalendarID)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "calendar no longer exists, restore it first"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if !CanEditCalendar(calendar, user.UserID, groups) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	// Restoring may move the event back from the calendar it lives on now
+	var currentImg *string
+	current, err := database.Db.Queries.GetEventById(c, revision.EntityID)
+	if err == nil {
+		currentImg = current.Img
+	}
+	switch {
+	case err == nil && current.CalendarID != calendar.CalendarID:
+		currentCalendar, err := database.Db.Queries.GetCalendarById(c, current.CalendarID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !CanEditCalendar(currentCalendar, user.UserID, groups) {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+	case err != nil && !errors.Is(err, pgx.ErrNoRows):
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The image in the snapshot may have been deleted since, or uploaded by someone else, so it is only brought back
+	// when the event still shows it or the caller owns the upload
+	var snapshot struct {
+		Img *string `json:"img"`
+	}
+	if err := json.Unmarshal(revision.Snapshot, &snapshot); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	keepImg := true
+	if err := checkOwnedImage(c, user.UserID, snapshot.Img, currentImg); err != nil {
+		if !errors.Is(err, errImageNotOwned) {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		keepImg = false
+	}
+
+	var event sqlc.Event
+	if err = database.TransactionAs(c, user.UserID, func(queries *sqlc.Queries) error {
+		event, err = queries.RestoreEvent(c, sqlc.RestoreEventParams{
+			KeepImg:    keepImg,
+			RevisionID: revision.RevisionID,
+		})
+		return err
+	}); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("ETag", VersionETag(event.ChangeSeq))
+	c.JSON(http.StatusOK, event)
+}
+
+// RestoreCalendarRevision
+// @Summary Restore a calendar to a previous revision
+// @Description Returns a calendar to the state recorded by a revision. Restoring a deletion also brings back its events.
+func RestoreCalendarRevision(c *gin.Context) {
+	user := *ParseUser(c)
+	groups := *ParseGroups(c)
+
+	revision, ok := parseRestorableRevision(c, "calendar")
+	if !ok {
+		return
+	}
+
+	if _, err := database.Db.Queries.GetTrashedCalendarById(c, revision.CalendarID); err == nil {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "calendar is in the trash, restore it from there first"})
+		return
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	owner, err := revisionOwner(c, revision)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !CanEditCalendar(owner, user.UserID, groups) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	var calendar sqlc.Calendar
+	if err = database.TransactionAs(c, user.UserID, func(queries *sqlc.Queries) error {
+		calendar, err = queries.RestoreCalendar(c, revision.RevisionID)
+		if err != nil {
+			return err
+		}
+
+		if revision.Action == "delete" {
+			return queries.RestoreDeletedCalendarEvents(c, sqlc.RestoreDeletedCalendarEventsParams{
+				CalendarID: calendar.CalendarID,
+				DeletedAt:  revision.CreatedAt,
+			})
+		}
+
+		return nil
+	}); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("ETag", VersionETag(calendar.ChangeSeq))
+	c.JSON(http.StatusOK, calendar)
+}
+
+// parseRestorableRevision loads the revision named in the route, aborting unless it
+// belongs to entityType and is still inside the retention window.
+func parseRestorableRevision(c *gin.Context, entityType string) (sqlc.Revision, bool) {
+	revisionId, err := strconv.ParseInt(c.Param("revision_id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "revision_id must be a number"})
+		return sqlc.Revision{}, false
+	}
+
+	revision, err := database.Db.Queries.GetRevisionById(c, revisionId)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "revision not found"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return sqlc.Revision{}, false
+	}
+
+	if revision.EntityType != entityType {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "revision not found"})
+		return sqlc.Revision{}, false
+	}
+
+	if time.Since(revision.CreatedAt) > jobs.RevisionRetention {
+		c.AbortWithStatusJSON(http.StatusGone, gin.H{"error": "revision is too old to restore"})
+		return sqlc.Revision{}, false
+	}
+
+	return revision, true
+}
+
+// revisionOwner returns the calendar a calendar revision belongs to, falling back to
+// the ownership recorded in the revision once the calendar has been deleted.
+func revisionOwner(c *gin.Context, revision sqlc.Revision) (sqlc.Calendar, error) {
+	calendar, err := database.Db.Queries.GetCalendarById(c, revision.CalendarID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return sqlc.Calendar{
+			CalendarID: revision.CalendarID,
+			UserID:     revision.UserID,
+			GroupID:    revision.GroupID,
+		}, nil
+	}
+
+	return calendar, err
+}
+
+func toRevisionResponses(revisions []sqlc.Revision) []RevisionResponse {
+	responses := make([]RevisionResponse, 0, len(revisions))
+	for _, revision := range revisions {
+		response := RevisionResponse{
+			RevisionID: revision.RevisionID,
+			EntityType: revision.EntityType,
+			EntityID:   revision.EntityID,
+			CalendarID: revision.CalendarID,
+			Action:     revision.Action,
+			ActorID:    revision.ActorID,
+			Snapshot:   revision.Snapshot,
+			CreatedAt:  revision.CreatedAt,
+			Restorable: time.Since(revision.CreatedAt) <= jobs.RevisionRetention,
+		}
+		if len(revision.Changes) > 0 {
+			response.Changes = revision.Changes
+		}
+		responses = append(responses, response)
+	}
+
+	return responses
+}
@@ -0,0 +1,366 @@
+package controllers
+
+import (
+	"calenduh-backend/internal/database"
+	"calenduh-backend/internal/mailer"
+	"calenduh-backend/internal/sqlc"
+	"calenduh-backend/internal/util"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	InvitationPending   = "pending"
+	InvitationAccepted  = "accepted"
+	InvitationDeclined  = "declined"
+	InvitationCancelled = "cancelled"
+
+	invitationMailTimeout = 30 * time.Second
+	invitationTokenLength = 32
+)
+
+var errInvitationAnswered = errors.New("invitation is no longer pending")
+
+// RedeemInvitationInput carries the token from an email invitation.
+type RedeemInvitationInput struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// CreateInvitationInput addresses an invitation by exactly one of username or email.
+type CreateInvitationInput struct {
+	Username *string `json:"username"`
+	Email    *string `json:"email"`
+}
+
+// CreateGroupInvitation
+// @Summary Invite someone to a group
+// @Description Invites a user by username, or anyone by email even without an account yet. Username invitees see it at /groups/@invites and are emailed when a mailer is configured. Email invitees are sent a single-use token to accept with at /groups/@invites/redeem. Accepting skips approval.
+func CreateGroupInvitation(c *gin.Context) {
+	user := *ParseUser(c)
+	groups := *ParseGroups(c)
+	groupId := c.Param("group_id")
+	if !CanEditGroup(groupId, groups) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	if !requireGroupPermission(c, groupId, findGroup(groupId, groups).MembersCanInvite, "invite") {
+		return
+	}
+
+	var input CreateInvitationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid input: " + err.Error()})
+		return
+	}
+	if (input.Username == nil) == (input.Email == nil) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid input: exactly one of username or email is required"})
+		return
+	}
+
+	params := sqlc.CreateGroupInvitationParams{
+		InvitationID: gonanoid.Must(),
+		GroupID:      groupId,
+		InvitedBy:    &user.UserID,
+	}
+
+	// Email invitations never reveal whether the address belongs to an account, and are accepted with the token
+	// mailed to the address since account emails are not verified
+	var recipient, token string
+	if input.Email != nil {
+		email := strings.TrimSpace(*input.Email)
+		if err := validateEmail(&email); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid input: " + err.Error()})
+			return
+		}
+		params.Email = &email
+		recipient = email
+		token = gonanoid.Must(invitationTokenLength)
+		tokenHash := util.GetHash(token)
+		params.TokenHash = &tokenHash
+	} else {
+		invitee, ok := findInvitee(c, groupId, strings.TrimSpace(*input.Username))
+		if !ok {
+			return
+		}
+		params.InviteeID = &invitee.UserID
+		recipient = invitee.Email
+	}
+
+	invitation, err := database.Db.Queries.CreateGroupInvitation(c, params)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.As(err, &pgErr) && pgErr.Code == "23505":
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "an invitation is already pending"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	go sendInvitationMail(recipient, token, *findGroup(groupId, groups), user)
+
+	RecordAudit(c, AuditGroupInvite, "group", groupId, gin.H{"invitation_id": invitation.InvitationID})
+	c.JSON(http.StatusCreated, invitation)
+}
+
+// GetGroupInvitations
+// @Summary List pending invitations to a group
+// @Description Lists a group's pending invitations with the invitee's username and name, or the email address they were sent to.
+func GetGroupInvitations(c *gin.Context) {
+	groups := *ParseGroups(c)
+	groupId := c.Param("group_id")
+	if !CanEditGroup(groupId, groups) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	invitations, err := database.Db.Queries.GetGroupInvitations(c, groupId)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	JSONWithContentETag(c, nonNil(invitations))
+}
+
+// CancelGroupInvitation
+// @Summary Cancel an invitation to a group
+// @Description Withdraws a pending invitation so the invitee can no longer accept it.
+func CancelGroupInvitation(c *gin.Context) {
+	groups := *ParseGroups(c)
+	groupId := c.Param("group_id")
+	if !CanEditGroup(groupId, groups) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	invitation, err := database.Db.Queries.CancelGroupInvitation(c, sqlc.CancelGroupInvitationParams{
+		InvitationID: c.Param("invitation_id"),
+		GroupID:      groupId,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "pending invitation not found"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	RecordAudit(c, AuditGroupInviteCancel, "group", groupId, gin.H{"invitation_id": invitation.InvitationID})
+	c.JSON(http.StatusOK, invitation)
+}
+
+// GetMyInvitations
+// @Summary List the user's pending group invitations
+// @Description Lists pending invitations addressed to the user by username, with the group name and who sent them. Email invitations only show up once redeemed with their token.
+func GetMyInvitations(c *gin.Context) {
+	user := *ParseUser(c)
+
+	invitations, err := database.Db.Queries.GetPendingInvitationsForUser(c, user.UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	JSONWithContentETag(c, nonNil(invitations))
+}
+
+// AcceptInvitation
+// @Summary Accept a group invitation
+// @Description Joins the group the invitation is for, even if the group requires approval. Email invitations are accepted at /groups/@invites/redeem instead.
+func AcceptInvitation(c *gin.Context) {
+	respondToInvitation(c, InvitationAccepted)
+}
+
+// DeclineInvitation
+// @Summary Decline a group invitation
+// @Description Turns down an invitation. The group can invite the user again later.
+func DeclineInvitation(c *gin.Context) {
+	respondToInvitation(c, InvitationDeclined)
+}
+
+// RedeemInvitation
+// @Summary Accept an email invitation
+// @Description Joins the group an email invitation is for using the token it was sent with, whatever address the user signed up with. Each token can be used once.
+func RedeemInvitation(c *gin.Context) {
+	var input RedeemInvitationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid input: " + err.Error()})
+		return
+	}
+
+	tokenHash := util.GetHash(input.Token)
+	invitation, err := database.Db.Queries.GetGroupInvitationByToken(c, &tokenHash)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "invitation not found"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	answerInvitation(c, invitation, InvitationAccepted)
+}
+
+func respondToInvitation(c *gin.Context, status string) {
+	user := *ParseUser(c)
+
+	invitation, err := database.Db.Queries.GetGroupInvitationById(c, c.Param("invitation_id"))
+	if err == nil && !isInvitee(invitation, user) {
+		err = pgx.ErrNoRows
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "invitation not found"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	answerInvitation(c, invitation, status)
+}
+
+// answerInvitation records the user's answer to an invitation they are entitled to, adding them to the group when
+// they accept.
+func answerInvitation(c *gin.Context, invitation sqlc.GroupInvitation, status string) {
+	user := *ParseUser(c)
+
+	var err error
+	if err = database.Transaction(c, func(queries *sqlc.Queries) error {
+		invitation, err = queries.RespondToGroupInvitation(c, sqlc.RespondToGroupInvitationParams{
+			Status:       status,
+			UserID:       user.UserID,
+			InvitationID: invitation.InvitationID,
+		})
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return errInvitationAnswered
+			}
+			return err
+		}
+
+		if status != InvitationAccepted {
+			return nil
+		}
+
+		members, err := queries.GetGroupMembers(c, invitation.GroupID)
+		if err != nil {
+			return err
+		}
+		if slices.ContainsFunc(members, func(member sqlc.GroupMember) bool { return member.UserID == user.UserID }) {
+			return nil
+		}
+
+		return queries.CreateGroupMember(c, sqlc.CreateGroupMemberParams{
+			UserID:  user.UserID,
+			GroupID: invitation.GroupID,
+		})
+	}); err != nil {
+		switch {
+		case errors.Is(err, errInvitationAnswered):
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if status == InvitationAccepted {
+		RecordAudit(c, AuditGroupJoin, "group", invitation.GroupID, gin.H{"via": "invitation", "invitation_id": invitation.InvitationID})
+	} else {
+		RecordAudit(c, AuditGroupInviteDecline, "group", invitation.GroupID, gin.H{"invitation_id": invitation.InvitationID})
+	}
+	c.JSON(http.StatusOK, invitation)
+}
+
+// findInvitee looks up the user a username invitation is for, aborting if there is not exactly one or they are
+// already a member.
+func findInvitee(c *gin.Context, groupId string, username string) (sqlc.User, bool) {
+	users, err := database.Db.Queries.GetUsersByUsername(c, username)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return sqlc.User{}, false
+	}
+
+	switch len(users) {
+	case 0:
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return sqlc.User{}, false
+	case 1:
+	default:
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "more than one user has that username, invite them by email instead"})
+		return sqlc.User{}, false
+	}
+
+	members, err := database.Db.Queries.GetGroupMembers(c, groupId)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return sqlc.User{}, false
+	}
+	if slices.ContainsFunc(members, func(member sqlc.GroupMember) bool { return member.UserID == users[0].UserID }) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "user is already a member of the group"})
+		return sqlc.User{}, false
+	}
+
+	return users[0], true
+}
+
+// isInvitee reports whether an invitation was addressed to the user by username. Email invitations are only
+// answered with their token.
+func isInvitee(invitation sqlc.GroupInvitation, user sqlc.User) bool {
+	return invitation.InviteeID != nil && *invitation.InviteeID == user.UserID
+}
+
+func findGroup(groupId string, groups []sqlc.Group) *sqlc.Group {
+	for _, group := range groups {
+		if group.GroupID == groupId {
+			return &group
+		}
+	}
+	return nil
+}
+
+// sendInvitationMail emails an invitee in the background, including the token to accept an email invitation with.
+// Failures are logged since a username invitation shows up in the app either way; an email invitation has to be
+// cancelled and sent again.
+func sendInvitationMail(recipient string, token string, group sqlc.Group, inviter sqlc.User) {
+	if recipient == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), invitationMailTimeout)
+	defer cancel()
+
+	body := fmt.Sprintf("%s invited you to join the group %s on Calenduh.\n\n"+
+		"Open Calenduh to accept or decline the invitation.\n", inviter.Username, group.Name)
+	if token != "" {
+		body = fmt.Sprintf("%s invited you to join the group %s on Calenduh.\n\n"+
+			"Open Calenduh and enter this invitation code to join. It can only be used once.\n\n%s\n",
+			inviter.Username, group.Name, token)
+	}
+
+	if err := mailer.Default.Send(ctx, mailer.Message{
+		To:      recipient,
+		Subject: fmt.Sprintf("%s invited you to %s on Calenduh", inviter.Username, group.Name),
+		Body:    body,
+	}); err != nil {
+		log.Printf("unable to send group invitation email: %s\n", err.Error())
+	}
+}
@@ -0,0 +1,385 @@
+package controllers
+
+import (
+	"calenduh-backend/internal/database"
+	"calenduh-backend/internal/sqlc"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// inviteCodeAlphabet leaves out characters that are easily confused when a code is read aloud or retyped.
+	inviteCodeAlphabet    = "23456789abcdefghjkmnpqrstuvwxyz"
+	inviteCodeLength      = 10
+	maxInviteCodeAttempts = 5
+	maxInviteNameLength   = 100
+)
+
+var (
+	errInviteCodeCollision = errors.New("could not generate a unique invite code")
+	errInviteUnavailable   = errors.New("invite link has expired, been revoked or reached its limit")
+)
+
+// CreateInviteInput is the body for creating a named invite link.
+type CreateInviteInput struct {
+	Name      string     `json:"name"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	MaxUses   *int32     `json:"max_uses"`
+}
+
+// GetGroupInvites
+// @Summary List group invite links
+// @Description Lists a group's invite links, including revoked and expired ones, with how many times each was used.
+func GetGroupInvites(c *gin.Context) {
+	groups := *ParseGroups(c)
+	groupId := c.Param("group_id")
+	if !CanEditGroup(groupId, groups) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	if !requireGroupPermission(c, groupId, findGroup(groupId, groups).MembersCanInvite, "invite") {
+		return
+	}
+
+	invites, err := database.Db.Queries.GetGroupInviteLinks(c, &groupId)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	JSONWithContentETag(c, nonNil(invites))
+}
+
+// CreateGroupInvite
+// @Summary Create a group invite link
+// @Description Creates a named invite link for a group, optionally expiring at expires_at or after max_uses joins.
+func CreateGroupInvite(c *gin.Context) {
+	groups := *ParseGroups(c)
+	groupId := c.Param("group_id")
+	if !CanEditGroup(groupId, groups) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	if !requireGroupPermission(c, groupId, findGroup(groupId, groups).MembersCanInvite, "invite") {
+		return
+	}
+
+	createInvite(c, &groupId, nil)
+}
+
+// GetCalendarInvites
+// @Summary List calendar invite links
+// @Description Lists a calendar's invite links, including revoked and expired ones, with how many times each was used.
+func GetCalendarInvites(c *gin.Context) {
+	calendar, ok := parseEditableCalendar(c)
+	if !ok {
+		return
+	}
+
+	invites, err := database.Db.Queries.GetCalendarInviteLinks(c, &calendar.CalendarID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	JSONWithContentETag(c, nonNil(invites))
+}
+
+// CreateCalendarInvite
+// @Summary Create a calendar invite link
+// @Description Creates a named invite link to subscribe to a calendar, optionally expiring at expires_at or after max_uses subscriptions.
+func CreateCalendarInvite(c *gin.Context) {
+	calendar, ok := parseEditableCalendar(c)
+	if !ok {
+		return
+	}
+
+	createInvite(c, nil, &calendar.CalendarID)
+}
+
+// RevokeInvite
+// @Summary Revoke an invite link
+// @Description Stops an invite link from being used. Subscriptions made with a calendar link lose access; group members stay.
+func RevokeInvite(c *gin.Context) {
+	user := *ParseUser(c)
+	invite, ok := parseManagedInvite(c)
+	if !ok {
+		return
+	}
+
+	invite, err := database.Db.Queries.RevokeInviteLink(c, invite.InviteID)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "invite link is already revoked"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	RecordAuditAs(c, user.UserID, AuditInviteRevoke, "invite", invite.InviteID, inviteTarget(invite))
+	c.JSON(http.StatusOK, invite)
+}
+
+// GetInviteUses
+// @Summary List who used an invite link
+// @Description Lists the users who joined a group or subscribed to a calendar through an invite link, newest first.
+func GetInviteUses(c *gin.Context) {
+	invite, ok := parseManagedInvite(c)
+	if !ok {
+		return
+	}
+
+	uses, err := database.Db.Queries.GetInviteLinkUses(c, invite.InviteID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	JSONWithContentETag(c, nonNil(uses))
+}
+
+// RotateGroupInviteCode
+// @Summary Regenerate a group's invite code
+// @Description Replaces the group's invite code so the old one can no longer be used to join. Existing members stay.
+func RotateGroupInviteCode(c *gin.Context) {
+	user := *ParseUser(c)
+	groups := *ParseGroups(c)
+	groupId := c.Param("group_id")
+	if !CanEditGroup(groupId, groups) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	if !requireGroupPermission(c, groupId, findGroup(groupId, groups).MembersCanInvite, "invite") {
+		return
+	}
+
+	var group sqlc.Group
+	if err := withUniqueInviteCode(func(code string) error {
+		var err error
+		group, err = database.Db.Queries.SetGroupInviteCode(c, sqlc.SetGroupInviteCodeParams{
+			GroupID:    groupId,
+			InviteCode: code,
+		})
+		return err
+	}); err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "group not found"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	RecordAuditAs(c, user.UserID, AuditInviteRotate, "group", groupId, nil)
+	respondGroup(c, http.StatusOK, group)
+}
+
+// RotateCalendarInviteCode
+// @Summary Regenerate a calendar's invite code
+// @Description Replaces the calendar's invite code. Subscribers who used the old code lose access to a private calendar; revoke individual invite links to cut off fewer people.
+func RotateCalendarInviteCode(c *gin.Context) {
+	user := *ParseUser(c)
+	calendar, ok := parseEditableCalendar(c)
+	if !ok {
+		return
+	}
+
+	if err := withUniqueInviteCode(func(code string) error {
+		var err error
+		calendar, err = database.Db.Queries.SetCalendarInviteCode(c, sqlc.SetCalendarInviteCodeParams{
+			CalendarID: calendar.CalendarID,
+			InviteCode: code,
+		})
+		return err
+	}); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	RecordAuditAs(c, user.UserID, AuditInviteRotate, "calendar", calendar.CalendarID, nil)
+	c.Header("ETag", VersionETag(calendar.ChangeSeq))
+	c.JSON(http.StatusOK, calendar)
+}
+
+func createInvite(c *gin.Context, groupId *string, calendarId *string) {
+	user := *ParseUser(c)
+
+	var input CreateInviteInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid input: " + err.Error()})
+		return
+	}
+
+	input.Name = strings.TrimSpace(input.Name)
+	switch {
+	case input.Name == "" || len(input.Name) > maxInviteNameLength:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "name must be between 1 and 100 characters"})
+		return
+	case input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	case input.MaxUses != nil && *input.MaxUses < 1:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "max_uses must be at least 1"})
+		return
+	}
+
+	inviteId, err := gonanoid.New()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var invite sqlc.InviteLink
+	if err := withUniqueInviteCode(func(code string) error {
+		invite, err = database.Db.Queries.CreateInviteLink(c, sqlc.CreateInviteLinkParams{
+			InviteID:   inviteId,
+			Code:       code,
+			GroupID:    groupId,
+			CalendarID: calendarId,
+			Name:       input.Name,
+			CreatedBy:  &user.UserID,
+			ExpiresAt:  input.ExpiresAt,
+			MaxUses:    input.MaxUses,
+		})
+		return err
+	}); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	RecordAuditAs(c, user.UserID, AuditInviteCreate, "invite", invite.InviteID, inviteTarget(invite))
+	c.JSON(http.StatusCreated, invite)
+}
+
+// claimInvite uses up one join on an invite link and records who used it.
+// It returns errInviteUnavailable when the link can no longer be used.
+func claimInvite(c *gin.Context, queries *sqlc.Queries, invite sqlc.InviteLink, userId string) error {
+	if _, err := queries.ClaimInviteLink(c, invite.InviteID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errInviteUnavailable
+		}
+		return err
+	}
+
+	return queries.CreateInviteLinkUse(c, sqlc.CreateInviteLinkUseParams{
+		InviteID: invite.InviteID,
+		UserID:   userId,
+	})
+}
+
+// parseManagedInvite loads the invite_id link and checks the user can manage its group or calendar.
+func parseManagedInvite(c *gin.Context) (sqlc.InviteLink, bool) {
+	user := *ParseUser(c)
+	groups := *ParseGroups(c)
+
+	invite, err := database.Db.Queries.GetInviteLinkById(c, c.Param("invite_id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "invite link not found"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return invite, false
+	}
+
+	if invite.GroupID != nil {
+		if !CanEditGroup(*invite.GroupID, groups) {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return invite, false
+		}
+		if !requireGroupPermission(c, *invite.GroupID, findGroup(*invite.GroupID, groups).MembersCanInvite, "invite") {
+			return invite, false
+		}
+		return invite, true
+	}
+
+	calendar, err := database.Db.Queries.GetCalendarById(c, *invite.CalendarID)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "calendar not found"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return invite, false
+	}
+
+	if !CanEditCalendar(calendar, user.UserID, groups) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return invite, false
+	}
+
+	return invite, true
+}
+
+// parseEditableCalendar loads the calendar_id calendar and checks the user can edit it.
+func parseEditableCalendar(c *gin.Context) (sqlc.Calendar, bool) {
+	user := *ParseUser(c)
+	groups := *ParseGroups(c)
+
+	calendar, err := database.Db.Queries.GetCalendarById(c, c.Param("calendar_id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "calendar not found"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return calendar, false
+	}
+
+	if !CanEditCalendar(calendar, user.UserID, groups) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return calendar, false
+	}
+
+	return calendar, true
+}
+
+// withUniqueInviteCode runs write with freshly generated codes until one does not collide with an existing code.
+// write must be a single statement outside a transaction, since a unique violation aborts the transaction.
+func withUniqueInviteCode(write func(code string) error) error {
+	for attempt := 0; attempt < maxInviteCodeAttempts; attempt++ {
+		code, err := gonanoid.Generate(inviteCodeAlphabet, inviteCodeLength)
+		if err != nil {
+			return err
+		}
+
+		err = write(code)
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			continue
+		}
+		return err
+	}
+
+	return errInviteCodeCollision
+}
+
+func inviteTarget(invite sqlc.InviteLink) gin.H {
+	if invite.GroupID != nil {
+		return gin.H{"group_id": *invite.GroupID}
+	}
+	return gin.H{"calendar_id": *invite.CalendarID}
+}
+
+// nonNil turns a nil slice into an empty one so it serializes as [] rather than null.
+func nonNil[T any](items []T) []T {
+	if items == nil {
+		return make([]T, 0)
+	}
+	return items
+}
@@ -0,0 +1,266 @@
+package controllers
+
+import (
+	"calenduh-backend/internal/database"
+	"calenduh-backend/internal/sqlc"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const (
+	JoinRequestPending   = "pending"
+	JoinRequestApproved  = "approved"
+	JoinRequestDenied    = "denied"
+	JoinRequestCancelled = "cancelled"
+
+	maxJoinMessageLength = 500
+)
+
+var errJoinRequestDecided = errors.New("join request is no longer pending")
+
+// JoinRequestInput is the optional body of a join in a group that requires approval.
+type JoinRequestInput struct {
+	Message *string `json:"message"`
+}
+
+// GetGroupJoinRequests
+// @Summary List requests to join a group
+// @Description Lists a group's join requests with the applicant's username and name, oldest first. Only pending requests unless status says otherwise. Owners only.
+func GetGroupJoinRequests(c *gin.Context) {
+	groups := *ParseGroups(c)
+	groupId := c.Param("group_id")
+	if !CanEditGroup(groupId, groups) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	if !requireGroupPermission(c, groupId, false, "review join requests") {
+		return
+	}
+
+	status := c.DefaultQuery("status", JoinRequestPending)
+	if !slices.Contains([]string{JoinRequestPending, JoinRequestApproved, JoinRequestDenied, JoinRequestCancelled}, status) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "status must be one of pending, approved, denied, cancelled"})
+		return
+	}
+
+	requests, err := database.Db.Queries.GetGroupJoinRequests(c, sqlc.GetGroupJoinRequestsParams{
+		GroupID: groupId,
+		Status:  status,
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	JSONWithContentETag(c, nonNil(requests))
+}
+
+// ApproveJoinRequest
+// @Summary Approve a request to join a group
+// @Description Adds the applicant to the group. Only group owners can approve.
+func ApproveJoinRequest(c *gin.Context) {
+	decideJoinRequest(c, JoinRequestApproved)
+}
+
+// DenyJoinRequest
+// @Summary Deny a request to join a group
+// @Description Closes the request without adding the applicant. They can ask again later. Only group owners can deny.
+func DenyJoinRequest(c *gin.Context) {
+	decideJoinRequest(c, JoinRequestDenied)
+}
+
+// GetMyJoinRequests
+// @Summary List the user's requests to join groups
+// @Description Lists every join request the user has made, newest first, with the name of the group.
+func GetMyJoinRequests(c *gin.Context) {
+	user := *ParseUser(c)
+
+	requests, err := database.Db.Queries.GetJoinRequestsByUserId(c, user.UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	JSONWithContentETag(c, nonNil(requests))
+}
+
+// CancelMyJoinRequest
+// @Summary Cancel a request to join a group
+// @Description Withdraws one of the user's pending join requests.
+func CancelMyJoinRequest(c *gin.Context) {
+	user := *ParseUser(c)
+
+	request, err := database.Db.Queries.CancelJoinRequest(c, sqlc.CancelJoinRequestParams{
+		RequestID: c.Param("request_id"),
+		UserID:    user.UserID,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "pending join request not found"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	RecordAudit(c, AuditGroupJoinCancel, "group", request.GroupID, gin.H{"request_id": request.RequestID})
+	c.JSON(http.StatusOK, request)
+}
+
+// requestToJoin records a pending request for a group that requires approval instead of adding the user.
+// Asking again while a request is pending returns the existing request.
+func requestToJoin(c *gin.Context, group sqlc.Group, invite *sqlc.InviteLink) {
+	user := *ParseUser(c)
+
+	pending, err := database.Db.Queries.GetPendingJoinRequest(c, sqlc.GetPendingJoinRequestParams{
+		GroupID: group.GroupID,
+		UserID:  user.UserID,
+	})
+	if err == nil {
+		c.JSON(http.StatusAccepted, pending)
+		return
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var input JoinRequestInput
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid input: " + err.Error()})
+			return
+		}
+	}
+	if input.Message != nil {
+		message := strings.TrimSpace(*input.Message)
+		if len(message) > maxJoinMessageLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "message must be at most 500 characters"})
+			return
+		}
+		input.Message = &message
+		if message == "" {
+			input.Message = nil
+		}
+	}
+
+	params := sqlc.CreateJoinRequestParams{
+		RequestID: gonanoid.Must(),
+		GroupID:   group.GroupID,
+		UserID:    user.UserID,
+		Message:   input.Message,
+	}
+	if invite != nil {
+		params.InviteID = &invite.InviteID
+	}
+
+	// An invite link is used up when the request is made, so a link limited to ten uses admits ten applicants
+	var request sqlc.GroupJoinRequest
+	if err := database.Transaction(c, func(queries *sqlc.Queries) error {
+		if invite != nil {
+			if err := claimInvite(c, queries, *invite, user.UserID); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		request, err = queries.CreateJoinRequest(c, params)
+		return err
+	}); err != nil {
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.Is(err, errInviteUnavailable):
+			c.AbortWithStatusJSON(http.StatusGone, gin.H{"error": err.Error()})
+		case errors.As(err, &pgErr) && pgErr.Code == "23505":
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "a join request is already pending"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	RecordAudit(c, AuditGroupJoinRequest, "group", group.GroupID, gin.H{"request_id": request.RequestID})
+	c.JSON(http.StatusAccepted, request)
+}
+
+func decideJoinRequest(c *gin.Context, status string) {
+	user := *ParseUser(c)
+	groups := *ParseGroups(c)
+	groupId := c.Param("group_id")
+	if !CanEditGroup(groupId, groups) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	if !requireGroupPermission(c, groupId, false, "review join requests") {
+		return
+	}
+
+	request, err := database.Db.Queries.GetJoinRequestById(c, c.Param("request_id"))
+	if err == nil && request.GroupID != groupId {
+		err = pgx.ErrNoRows
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "join request not found"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if err := database.Transaction(c, func(queries *sqlc.Queries) error {
+		request, err = queries.DecideJoinRequest(c, sqlc.DecideJoinRequestParams{
+			RequestID: request.RequestID,
+			Status:    status,
+			DecidedBy: &user.UserID,
+		})
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return errJoinRequestDecided
+			}
+			return err
+		}
+
+		if status != JoinRequestApproved {
+			return nil
+		}
+
+		// The applicant may have joined another way since asking, such as after approval was turned off
+		members, err := queries.GetGroupMembers(c, groupId)
+		if err != nil {
+			return err
+		}
+		if slices.ContainsFunc(members, func(member sqlc.GroupMember) bool { return member.UserID == request.UserID }) {
+			return nil
+		}
+
+		return queries.CreateGroupMember(c, sqlc.CreateGroupMemberParams{
+			UserID:  request.UserID,
+			GroupID: groupId,
+		})
+	}); err != nil {
+		switch {
+		case errors.Is(err, errJoinRequestDecided):
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if status == JoinRequestApproved {
+		RecordAudit(c, AuditGroupJoinApprove, "group", groupId, gin.H{"request_id": request.RequestID, "user_id": request.UserID})
+		RecordAuditAs(c, request.UserID, AuditGroupJoin, "group", groupId, gin.H{"via": "join_request", "request_id": request.RequestID})
+	} else {
+		RecordAudit(c, AuditGroupJoinDeny, "group", groupId, gin.H{"request_id": request.RequestID, "user_id": request.UserID})
+	}
+	c.JSON(http.StatusOK, request)
+}
@@ -0,0 +1,409 @@
+package controllers
+
+import (
+	"calenduh-backend/internal/database"
+	"calenduh-backend/internal/sqlc"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+	"net/http"
+	"time"
+)
+
+const (
+	ConflictLastWriterWins = "last_writer_wins"
+	ConflictReport         = "report"
+)
+
+const (
+	UploadCreated   = "created"
+	UploadUpdated   = "updated"
+	UploadUnchanged = "unchanged"
+	UploadConflict  = "conflict"
+	UploadError     = "error"
+)
+
+// LocalCalendar is a calendar created offline on a client.
+// CalendarID is accepted in place of ClientID for older clients.
+type LocalCalendar struct {
+	ClientID   string    `json:"client_id"`
+	CalendarID string    `json:"calendar_id"`
+	Title      string    `json:"title"`
+	Color      string    `json:"color"`
+	IsPublic   bool      `json:"is_public"`
+	LastEdited time.Time `json:"last_edited"`
+}
+
+// LocalEvent is an event created offline on a client.
+// CalendarID may reference either a local calendar's client ID or a server calendar ID.
+// EventID is accepted in place of ClientID for older clients.
+type LocalEvent struct {
+	ClientID           string    `json:"client_id"`
+	EventID            string    `json:"event_id"`
+	CalendarID         string    `json:"calendar_id"`
+	Name               string    `json:"name"`
+	Location           *string   `json:"location"`
+	Description        *string   `json:"description"`
+	Notification       *string   `json:"notification"`
+	Frequency          *string   `json:"frequency"`
+	Priority           *int32    `json:"priority"`
+	StartTime          time.Time `json:"start_time"`
+	EndTime            time.Time `json:"end_time"`
+	AllDay             bool      `json:"all_day"`
+	FirstNotification  *int32    `json:"first_notification"`
+	SecondNotification *int32    `json:"second_notification"`
+	Img                *string   `json:"img"`
+	LastEdited         time.Time `json:"last_edited"`
+}
+
+type UploadLocalCalendarsParams struct {
+	ConflictStrategy string          `json:"conflict_strategy"`
+	Calendars        []LocalCalendar `json:"calendars"`
+	Events           []LocalEvent    `json:"events"`
+}
+
+type CalendarUploadResult struct {
+	ClientID string         `json:"client_id"`
+	ServerID string         `json:"server_id,omitempty"`
+	Status   string         `json:"status"`
+	Calendar *sqlc.Calendar `json:"calendar,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
+type EventUploadResult struct {
+	ClientID string      `json:"client_id"`
+	ServerID string      `json:"server_id,omitempty"`
+	Status   string      `json:"status"`
+	Event    *sqlc.Event `json:"event,omitempty"`
+	Error    string      `json:"error,omitempty"`
+}
+
+type UploadLocalCalendarsResponse struct {
+	Calendars []CalendarUploadResult `json:"calendars"`
+	Events    []EventUploadResult    `json:"events"`
+}
+
+// UploadLocalCalendars
+// @Summary Upload local user calendars and events
+// @Description Idempotently imports calendars and events created offline, mapping client IDs to server IDs with a result per item.
+func UploadLocalCalendars(c *gin.Context) {
+	user := *ParseUser(c)
+	groups := *ParseGroups(c)
+	var input UploadLocalCalendarsParams
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch input.ConflictStrategy {
+	case "":
+		input.ConflictStrategy = ConflictLastWriterWins
+	case ConflictLastWriterWins, ConflictReport:
+	default:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "conflict_strategy must be last_writer_wins or report"})
+		return
+	}
+
+	response := UploadLocalCalendarsResponse{
+		Calendars: make([]CalendarUploadResult, 0, len(input.Calendars)),
+		Events:    make([]EventUploadResult, 0, len(input.Events)),
+	}
+
+	// Calendars first so events can reference them by client ID
+	for _, local := range input.Calendars {
+		response.Calendars = append(response.Calendars, uploadLocalCalendar(c, user, groups, local, input.ConflictStrategy))
+	}
+
+	for _, local := range input.Events {
+		response.Events = append(response.Events, uploadLocalEvent(c, user, groups, local, input.ConflictStrategy))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func uploadLocalCalendar(c *gin.Context, user sqlc.User, groups []sqlc.Group, local LocalCalendar, strategy string) CalendarUploadResult {
+	result := CalendarUploadResult{ClientID: local.ClientID}
+	if result.ClientID == "" {
+		result.ClientID = local.CalendarID
+	}
+	if result.ClientID == "" {
+		result.Status = UploadError
+		result.Error = "client_id is required"
+		return result
+	}
+	// Edit times come from the client's clock, and one in the future would win every later conflict
+	if now := time.Now(); local.LastEdited.IsZero() || local.LastEdited.After(now) {
+		local.LastEdited = now
+	}
+
+	if err := database.TransactionAs(c, user.UserID, func(queries *sqlc.Queries) error {
+		serverId, err := queries.GetServerId(c, sqlc.GetServerIdParams{
+			UserID:     user.UserID,
+			EntityType: "calendar",
+			ClientID:   result.ClientID,
+		})
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+
+		var existing *sqlc.Calendar
+		if err == nil {
+			calendar, err := queries.GetCalendarById(c, serverId)
+			switch {
+			case err == nil:
+				existing = &calendar
+			case !errors.Is(err, pgx.ErrNoRows):
+				return err
+			}
+		}
+
+		if existing == nil {
+			calendar, err := queries.ImportCalendar(c, sqlc.ImportCalendarParams{
+				CalendarID: gonanoid.Must(),
+				UserID:     &user.UserID,
+				Title:      local.Title,
+				Color:      local.Color,
+				IsPublic:   local.IsPublic,
+				LastEdited: local.LastEdited,
+			})
+			if err != nil {
+				return err
+			}
+
+			if err = queries.CreateClientId(c, sqlc.CreateClientIdParams{
+				UserID:     user.UserID,
+				EntityType: "calendar",
+				ClientID:   result.ClientID,
+				ServerID:   calendar.CalendarID,
+			}); err != nil {
+				return err
+			}
+
+			result.Status = UploadCreated
+			result.Calendar = &calendar
+			return nil
+		}
+
+		// The calendar may have moved to a group the user has since left
+		if !CanEditCalendar(*existing, user.UserID, groups) {
+			return errors.New("not permitted to edit calendar")
+		}
+
+		result.Calendar = existing
+		switch resolveConflict(local.LastEdited, existing.LastEdited, strategy) {
+		case UploadUnchanged:
+			result.Status = UploadUnchanged
+		case UploadConflict:
+			result.Status = UploadConflict
+		case UploadUpdated:
+			calendar, err := queries.OverwriteCalendar(c, sqlc.OverwriteCalendarParams{
+				CalendarID: existing.CalendarID,
+				Title:      local.Title,
+				Color:      local.Color,
+				IsPublic:   local.IsPublic,
+				LastEdited: local.LastEdited,
+			})
+			if err != nil {
+				return err
+			}
+
+			result.Status = UploadUpdated
+			result.Calendar = &calendar
+		}
+
+		return nil
+	}); err != nil {
+		result.Status = UploadError
+		result.Calendar = nil
+		result.Error = err.Error()
+		return result
+	}
+
+	result.ServerID = result.Calendar.CalendarID
+	return result
+}
+
+func uploadLocalEvent(c *gin.Context, user sqlc.User, groups []sqlc.Group, local LocalEvent, strategy string) EventUploadResult {
+	result := EventUploadResult{ClientID: local.ClientID}
+	if result.ClientID == "" {
+		result.ClientID = local.EventID
+	}
+	if result.ClientID == "" {
+		result.Status = UploadError
+		result.Error = "client_id is required"
+		return result
+	}
+	if local.CalendarID == "" {
+		result.Status = UploadError
+		result.Error = "calendar_id is required"
+		return result
+	}
+	// Edit times come from the client's clock, and one in the future would win every later conflict
+	if now := time.Now(); local.LastEdited.IsZero() || local.LastEdited.After(now) {
+		local.LastEdited = now
+	}
+
+	if err := database.TransactionAs(c, user.UserID, func(queries *sqlc.Queries) error {
+		// Resolve the calendar from a local client ID, falling back to a server calendar ID
+		calendarId, err := queries.GetServerId(c, sqlc.GetServerIdParams{
+			UserID:     user.UserID,
+			EntityType: "calendar",
+			ClientID:   local.CalendarID,
+		})
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			calendarId = local.CalendarID
+		case err != nil:
+			return err
+		}
+
+		calendar, err := queries.GetCalendarById(c, calendarId)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return errors.New("calendar not found")
+			}
+			return err
+		}
+
+		if !CanEditCalendar(calendar, user.UserID, groups) {
+			return errors.New("not permitted to edit calendar")
+		}
+
+		serverId, err := queries.GetServerId(c, sqlc.GetServerIdParams{
+			UserID:     user.UserID,
+			EntityType: "event",
+			ClientID:   result.ClientID,
+		})
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+
+		var existing *sqlc.Event
+		if err == nil {
+			event, err := queries.GetEventById(c, serverId)
+			switch {
+			case err == nil:
+				existing = &event
+			case !errors.Is(err, pgx.ErrNoRows):
+				return err
+			}
+		}
+
+		if existing == nil {
+			if err := checkOwnedImage(c, user.UserID, local.Img, nil); err != nil {
+				return err
+			}
+
+			event, err := queries.ImportEvent(c, sqlc.ImportEventParams{
+				EventID:            gonanoid.Must(),
+				CalendarID:         calendar.CalendarID,
+				Name:               local.Name,
+				Location:           local.Location,
+				Description:        local.Description,
+				Notification:       local.Notification,
+				Frequency:          local.Frequency,
+				Priority:           local.Priority,
+				StartTime:          local.StartTime,
+				EndTime:            local.EndTime,
+				AllDay:             local.AllDay,
+				FirstNotification:  local.FirstNotification,
+				SecondNotification: local.SecondNotification,
+				Img:                local.Img,
+				LastEdited:         local.LastEdited,
+			})
+			if err != nil {
+				return err
+			}
+
+			if err = queries.CreateClientId(c, sqlc.CreateClientIdParams{
+				UserID:     user.UserID,
+				EntityType: "event",
+				ClientID:   result.ClientID,
+				ServerID:   event.EventID,
+			}); err != nil {
+				return err
+			}
+
+			result.Status = UploadCreated
+			result.Event = &event
+			return nil
+		}
+
+		// The event may currently live on a calendar other than the one it is being moved to
+		if existing.CalendarID != calendar.CalendarID {
+			current, err := queries.GetCalendarById(c, existing.CalendarID)
+			if err != nil {
+				return err
+			}
+			if !CanEditCalendar(current, user.UserID, groups) {
+				return errors.New("not permitted to edit calendar")
+			}
+		}
+
+		result.Event = existing
+		switch resolveConflict(local.LastEdited, existing.LastEdited, strategy) {
+		case UploadUnchanged:
+			result.Status = UploadUnchanged
+		case UploadConflict:
+			result.Status = UploadConflict
+		case UploadUpdated:
+			if err := checkOwnedImage(c, user.UserID, local.Img, existing.Img); err != nil {
+				return err
+			}
+
+			event, err := queries.OverwriteEvent(c, sqlc.OverwriteEventParams{
+				EventID:            existing.EventID,
+				CalendarID:         calendar.CalendarID,
+				Name:               local.Name,
+				Location:           local.Location,
+				Description:        local.Description,
+				Notification:       local.Notification,
+				Frequency:          local.Frequency,
+				Priority:           local.Priority,
+				StartTime:          local.StartTime,
+				EndTime:            local.EndTime,
+				AllDay:             local.AllDay,
+				FirstNotification:  local.FirstNotification,
+				SecondNotification: local.SecondNotification,
+				Img:                local.Img,
+				LastEdited:         local.LastEdited,
+			})
+			if err != nil {
+				return err
+			}
+
+			result.Status = UploadUpdated
+			result.Event = &event
+		}
+
+		return nil
+	}); err != nil {
+		result.Status = UploadError
+		result.Event = nil
+		result.Error = err.Error()
+		return result
+	}
+
+	result.ServerID = result.Event.EventID
+	return result
+}
+
+// resolveConflict decides what to do with a local copy of a row that already exists on the server.
+// Identical edit times are a retried upload. A newer server copy is always a conflict and is kept,
+// while a newer local copy replaces it unless the client asked for conflicts to be reported instead.
+func resolveConflict(local, server time.Time, strategy string) string {
+	local = local.Truncate(time.Millisecond)
+	server = server.Truncate(time.Millisecond)
+
+	switch {
+	case local.Equal(server):
+		return UploadUnchanged
+	case local.Before(server):
+		return UploadConflict
+	case strategy == ConflictReport:
+		return UploadConflict
+	default:
+		return UploadUpdated
+	}
+}
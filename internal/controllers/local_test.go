@@ -0,0 +1,35 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResolveConflict(t *testing.T) {
+	server := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		local    time.Time
+		strategy string
+		want     string
+	}{
+		{"same time", server, ConflictLastWriterWins, UploadUnchanged},
+		{"same time when reporting", server, ConflictReport, UploadUnchanged},
+		// The database keeps milliseconds, so a retried upload with more precision is still the same edit
+		{"same millisecond", server.Add(400 * time.Microsecond), ConflictLastWriterWins, UploadUnchanged},
+		{"same time in another zone", server.In(time.FixedZone("EST", -5*60*60)), ConflictLastWriterWins, UploadUnchanged},
+		{"older local copy", server.Add(-time.Second), ConflictLastWriterWins, UploadConflict},
+		{"older local copy when reporting", server.Add(-time.Second), ConflictReport, UploadConflict},
+		{"newer local copy", server.Add(time.Millisecond), ConflictLastWriterWins, UploadUpdated},
+		{"newer local copy when reporting", server.Add(time.Hour), ConflictReport, UploadConflict},
+		{"newer local copy without a strategy", server.Add(time.Hour), "", UploadUpdated},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := resolveConflict(test.local, server, test.strategy); got != test.want {
+				t.Fatalf("resolveConflict = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
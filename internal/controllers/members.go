@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"calenduh-backend/internal/database"
+	"calenduh-backend/internal/images"
+	"calenduh-backend/internal/sqlc"
+	"calenduh-backend/internal/storage"
+	"calenduh-backend/internal/util"
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+	"time"
+)
+
+const (
+	GroupRoleOwner  = "owner"
+	GroupRoleMember = "member"
+)
+
+// GroupMemberProfile is a group member as other members see them. Email is null when the member hides it.
+type GroupMemberProfile struct {
+	UserID            string     `json:"user_id"`
+	Username          string     `json:"username"`
+	Name              *string    `json:"name"`
+	Email             *string    `json:"email"`
+	ProfilePictureURL *string    `json:"profile_picture_url"`
+	Role              string     `json:"role"`
+	JoinedAt          time.Time  `json:"joined_at"`
+	Active            bool       `json:"active"`
+	LastSeen          *time.Time `json:"last_seen"`
+}
+
+// GetGroupMembers
+// @Summary List the members of a group
+// @Description Lists each member's profile, role and when they joined, with active set for members seen in the last 15 minutes. Emails of members who hide them are null.
+func GetGroupMembers(c *gin.Context) {
+	user := *ParseUser(c)
+	groups := *ParseGroups(c)
+	groupId := c.Param("group_id")
+	if !CanEditGroup(groupId, groups) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	members, err := database.Db.Queries.GetGroupMemberProfiles(c, groupId)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	profiles := make([]GroupMemberProfile, 0, len(members))
+	for _, member := range members {
+		pictureURL, err := profilePictureURL(c, member.UserID, member.ProfilePicture)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		profile := GroupMemberProfile{
+			UserID:            member.UserID,
+			Username:          member.Username,
+			Name:              member.Name,
+			ProfilePictureURL: pictureURL,
+			Role:              member.Role,
+			JoinedAt:          member.JoinedAt,
+		}
+		if !member.HideEmail || member.UserID == user.UserID {
+			profile.Email = &member.Email
+		}
+		lastSeen, active, err := util.LastSeen(c, member.UserID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if active {
+			profile.Active = true
+			profile.LastSeen = &lastSeen
+		}
+		profiles = append(profiles, profile)
+	}
+
+	RespondList(c, profiles, ListOptions[GroupMemberProfile]{Sorts: MemberSorts, DefaultSort: "joined_at"})
+}
+
+// isGroupOwner reports whether the user is an owner of the group. Non-members are not owners.
+func isGroupOwner(c *gin.Context, groupId string, userId string) (bool, error) {
+	member, err := database.Db.Queries.GetGroupMember(c, sqlc.GetGroupMemberParams{
+		GroupID: groupId,
+		UserID:  userId,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return member.Role == GroupRoleOwner, nil
+}
+
+// requireGroupPermission lets owners through and members only when the group setting allows them to, aborting
+// with 403 otherwise. action describes what is being done for the error message.
+func requireGroupPermission(c *gin.Context, groupId string, membersAllowed bool, action string) bool {
+	if membersAllowed {
+		return true
+	}
+
+	owner, err := isGroupOwner(c, groupId, ParseUser(c).UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if !owner {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "only group owners can " + action + " in this group"})
+		return false
+	}
+
+	return true
+}
+
+// profilePictureURL turns a stored profile picture key into a signed link to its avatar size. Pictures the user did
+// not upload themselves are left out.
+func profilePictureURL(ctx context.Context, userId string, key *string) (*string, error) {
+	if key == nil || *key == "" {
+		return nil, nil
+	}
+
+	upload, err := imageUpload(ctx, *key, uploadedBy(userId))
+	if err != nil {
+		if errors.Is(err, errImageNotOwned) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	avatar, err := imageVariantKey(upload, *key, images.VariantAvatar)
+	if err != nil {
+		return nil, err
+	}
+
+	url, err := storage.Default.URL(ctx, avatar, storage.URLOptions{Expiry: ImageURLExpiry})
+	if err != nil {
+		return nil, err
+	}
+	return &url, nil
+}
@@ -0,0 +1,314 @@
+package controllers
+
+import (
+	"calenduh-backend/internal/sqlc"
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const maxPageLimit = 500
+
+// ListSort is one sort option. Keys are the JSON keys Compare reads, ending with the item's ID so no two items tie.
+// Cursors record them from the last item of a page and the next page starts after it, so pages do not shift when
+// items are added or removed. Sorts without keys keep the order the items came in, such as a database ranking,
+// and page by position instead.
+type ListSort[T any] struct {
+	Compare func(a, b T) int
+	Keys    []string
+}
+
+// ListOptions configures how RespondList orders and pages a list.
+type ListOptions[T any] struct {
+	Sorts       map[string]ListSort[T]
+	DefaultSort string
+	// DefaultLimit is the page size when the client does not pass limit. Zero returns every item.
+	DefaultLimit int
+	// Truncated reports that the list was cut short before paging, such as by a recurrence cap.
+	Truncated bool
+}
+
+type listCursor struct {
+	Sort string `json:"s"`
+	// After holds the sort keys of the last item sent, or Offset its position for sorts without keys.
+	After  map[string]json.RawMessage `json:"a,omitempty"`
+	Offset int                        `json:"o,omitempty"`
+	// Limit is the page size the cursor was issued with, which later pages keep unless limit is passed again.
+	Limit int `json:"l"`
+}
+
+// RespondList writes one page of items. Clients choose the order with sort (prefix "-" to reverse), page with
+// limit and the cursor from X-Next-Cursor, and trim each item to the comma separated keys in fields.
+// X-Total-Count holds the size of the whole list and X-Truncated is set when the list itself is incomplete.
+func RespondList[T any](c *gin.Context, items []T, options ListOptions[T]) {
+	sortKey := c.DefaultQuery("sort", options.DefaultSort)
+	var option ListSort[T]
+	if sortKey != "" {
+		var ok bool
+		option, ok = options.Sorts[strings.TrimPrefix(sortKey, "-")]
+		if !ok {
+			names := make([]string, 0, len(options.Sorts))
+			for name := range options.Sorts {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "sort must be one of " + strings.Join(names, ", ")})
+			return
+		}
+
+		if strings.HasPrefix(sortKey, "-") {
+			compare := option.Compare
+			option.Compare = func(a, b T) int { return compare(b, a) }
+		}
+		slices.SortStableFunc(items, option.Compare)
+	}
+
+	limit := options.DefaultLimit
+	var cursor listCursor
+	if value := c.Query("cursor"); value != "" {
+		var err error
+		if cursor, err = decodeCursor(value); err != nil || cursor.Offset < 0 || cursor.Limit < 0 || cursor.Limit > maxPageLimit {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "cursor is invalid"})
+			return
+		}
+		if cursor.Sort != sortKey {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "cursor was issued for a different sort"})
+			return
+		}
+		if len(option.Keys) > 0 && cursor.After == nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "cursor is invalid"})
+			return
+		}
+		limit = cursor.Limit
+	}
+	if value := c.Query("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > maxPageLimit {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxPageLimit)})
+			return
+		}
+	}
+
+	offset := cursor.Offset
+	if cursor.After != nil && len(option.Keys) > 0 {
+		after, err := decodeCursorItem[T](cursor.After)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "cursor is invalid"})
+			return
+		}
+		offset = sort.Search(len(items), func(i int) bool { return option.Compare(items[i], after) > 0 })
+	}
+
+	page := make([]T, 0)
+	if offset < len(items) {
+		page = items[offset:]
+	}
+	if limit > 0 && len(page) > limit {
+		page = page[:limit]
+
+		next := listCursor{Sort: sortKey, Limit: limit}
+		if len(option.Keys) > 0 {
+			after, err := selectFields(page[limit-1:], option.Keys)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			next.After = after[0]
+		} else {
+			next.Offset = offset + limit
+		}
+		c.Header("X-Next-Cursor", encodeCursor(next))
+	}
+
+	c.Header("X-Total-Count", strconv.Itoa(len(items)))
+	if options.Truncated {
+		c.Header("X-Truncated", "true")
+	}
+
+	if fields := c.Query("fields"); fields != "" {
+		body, err := selectFields(page, strings.Split(fields, ","))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		JSONWithContentETag(c, body)
+		return
+	}
+
+	JSONWithContentETag(c, page)
+}
+
+func encodeCursor(cursor listCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string) (listCursor, error) {
+	var cursor listCursor
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor, err
+	}
+
+	err = json.Unmarshal(data, &cursor)
+	return cursor, err
+}
+
+// decodeCursorItem rebuilds enough of the last item of a page from its sort keys to compare the list against.
+func decodeCursorItem[T any](keys map[string]json.RawMessage) (T, error) {
+	var item T
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return item, err
+	}
+
+	err = json.Unmarshal(data, &item)
+	return item, err
+}
+
+// selectFields keeps only the requested top-level JSON keys of each item. Unknown keys are ignored.
+func selectFields[T any](items []T, fields []string) ([]map[string]json.RawMessage, error) {
+	data, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &objects); err != nil {
+		return nil, err
+	}
+
+	trimmed := make([]map[string]json.RawMessage, 0, len(objects))
+	for _, object := range objects {
+		kept := make(map[string]json.RawMessage, len(fields))
+		for _, field := range fields {
+			if value, ok := object[strings.TrimSpace(field)]; ok {
+				kept[strings.TrimSpace(field)] = value
+			}
+		}
+		trimmed = append(trimmed, kept)
+	}
+
+	return trimmed, nil
+}
+
+var EventSorts = map[string]ListSort[sqlc.Event]{
+	"start_time": {
+		Compare: func(a, b sqlc.Event) int {
+			return cmp.Or(a.StartTime.Compare(b.StartTime), cmp.Compare(a.EventID, b.EventID))
+		},
+		Keys: []string{"start_time", "event_id"},
+	},
+	"end_time": {
+		Compare: func(a, b sqlc.Event) int {
+			return cmp.Or(a.EndTime.Compare(b.EndTime), a.StartTime.Compare(b.StartTime), cmp.Compare(a.EventID, b.EventID))
+		},
+		Keys: []string{"end_time", "start_time", "event_id"},
+	},
+	"name": {
+		Compare: func(a, b sqlc.Event) int {
+			return cmp.Or(cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)), a.StartTime.Compare(b.StartTime), cmp.Compare(a.EventID, b.EventID))
+		},
+		Keys: []string{"name", "start_time", "event_id"},
+	},
+	"priority": {
+		Compare: func(a, b sqlc.Event) int {
+			return cmp.Or(cmp.Compare(derefInt32(a.Priority), derefInt32(b.Priority)), a.StartTime.Compare(b.StartTime), cmp.Compare(a.EventID, b.EventID))
+		},
+		Keys: []string{"priority", "start_time", "event_id"},
+	},
+	"last_edited": {
+		Compare: func(a, b sqlc.Event) int {
+			return cmp.Or(a.LastEdited.Compare(b.LastEdited), a.StartTime.Compare(b.StartTime), cmp.Compare(a.EventID, b.EventID))
+		},
+		Keys: []string{"last_edited", "start_time", "event_id"},
+	},
+}
+
+var CalendarSorts = map[string]ListSort[sqlc.Calendar]{
+	"title": {
+		Compare: func(a, b sqlc.Calendar) int {
+			return cmp.Or(cmp.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title)), cmp.Compare(a.CalendarID, b.CalendarID))
+		},
+		Keys: []string{"title", "calendar_id"},
+	},
+	"last_edited": {
+		Compare: func(a, b sqlc.Calendar) int {
+			return cmp.Or(a.LastEdited.Compare(b.LastEdited), cmp.Compare(a.CalendarID, b.CalendarID))
+		},
+		Keys: []string{"last_edited", "calendar_id"},
+	},
+}
+
+var GroupSorts = map[string]ListSort[sqlc.Group]{
+	"name": {
+		Compare: func(a, b sqlc.Group) int {
+			return cmp.Or(cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)), cmp.Compare(a.GroupID, b.GroupID))
+		},
+		Keys: []string{"name", "group_id"},
+	},
+}
+
+var UserSorts = map[string]ListSort[sqlc.User]{
+	"username": {
+		Compare: func(a, b sqlc.User) int {
+			return cmp.Or(cmp.Compare(strings.ToLower(a.Username), strings.ToLower(b.Username)), cmp.Compare(a.UserID, b.UserID))
+		},
+		Keys: []string{"username", "user_id"},
+	},
+}
+
+var MemberSorts = map[string]ListSort[GroupMemberProfile]{
+	"joined_at": {
+		Compare: func(a, b GroupMemberProfile) int {
+			return cmp.Or(a.JoinedAt.Compare(b.JoinedAt), cmp.Compare(a.UserID, b.UserID))
+		},
+		Keys: []string{"joined_at", "user_id"},
+	},
+	"username": {
+		Compare: func(a, b GroupMemberProfile) int {
+			return cmp.Or(cmp.Compare(strings.ToLower(a.Username), strings.ToLower(b.Username)), cmp.Compare(a.UserID, b.UserID))
+		},
+		Keys: []string{"username", "user_id"},
+	},
+	"role": {
+		Compare: func(a, b GroupMemberProfile) int {
+			return cmp.Or(cmp.Compare(a.Role, b.Role), a.JoinedAt.Compare(b.JoinedAt), cmp.Compare(a.UserID, b.UserID))
+		},
+		Keys: []string{"role", "joined_at", "user_id"},
+	},
+}
+
+var AttachmentSorts = map[string]ListSort[EventAttachmentResponse]{
+	"created_at": {
+		Compare: func(a, b EventAttachmentResponse) int {
+			return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), cmp.Compare(a.AttachmentID, b.AttachmentID))
+		},
+		Keys: []string{"created_at", "attachment_id"},
+	},
+	"filename": {
+		Compare: func(a, b EventAttachmentResponse) int {
+			return cmp.Or(cmp.Compare(strings.ToLower(a.Filename), strings.ToLower(b.Filename)), cmp.Compare(a.AttachmentID, b.AttachmentID))
+		},
+		Keys: []string{"filename", "attachment_id"},
+	},
+	"size_bytes": {
+		Compare: func(a, b EventAttachmentResponse) int {
+			return cmp.Or(cmp.Compare(a.SizeBytes, b.SizeBytes), cmp.Compare(a.AttachmentID, b.AttachmentID))
+		},
+		Keys: []string{"size_bytes", "attachment_id"},
+	},
+}
+
+func derefInt32(value *int32) int32 {
+	if value == nil {
+		return 0
+	}
+	return *value
+}
@@ -0,0 +1,235 @@
+package controllers
+
+import (
+	"cmp"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+type listItem struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Score int    `json:"score"`
+}
+
+var listItemSorts = map[string]ListSort[listItem]{
+	"name": {
+		Compare: func(a, b listItem) int {
+			return cmp.Or(cmp.Compare(a.Name, b.Name), cmp.Compare(a.ID, b.ID))
+		},
+		Keys: []string{"name", "id"},
+	},
+	// relevance has no keys, so it pages by offset
+	"relevance": {
+		Compare: func(a, b listItem) int { return cmp.Compare(b.Score, a.Score) },
+	},
+}
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func listItems(names ...string) []listItem {
+	items := make([]listItem, 0, len(names))
+	for i, name := range names {
+		items = append(items, listItem{ID: strconv.Itoa(i), Name: name, Score: len(names) - i})
+	}
+	return items
+}
+
+// respondList runs RespondList over a copy of items for a request with the given query.
+func respondList(t *testing.T, items []listItem, options ListOptions[listItem], query url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodGet, "/?"+query.Encode(), nil)
+	RespondList(c, slices.Clone(items), options)
+	return recorder
+}
+
+func decodeList(t *testing.T, recorder *httptest.ResponseRecorder) []listItem {
+	t.Helper()
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", recorder.Code, recorder.Body.String())
+	}
+	var page []listItem
+	if err := json.Unmarshal(recorder.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	return page
+}
+
+func names(items []listItem) []string {
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		result = append(result, item.Name)
+	}
+	return result
+}
+
+func TestRespondListSorts(t *testing.T) {
+	items := listItems("carol", "alice", "bob")
+	options := ListOptions[listItem]{Sorts: listItemSorts, DefaultSort: "name"}
+
+	tests := []struct {
+		sort string
+		want []string
+	}{
+		{"", []string{"alice", "bob", "carol"}},
+		{"name", []string{"alice", "bob", "carol"}},
+		{"-name", []string{"carol", "bob", "alice"}},
+		{"relevance", []string{"carol", "alice", "bob"}},
+	}
+	for _, test := range tests {
+		query := url.Values{}
+		if test.sort != "" {
+			query.Set("sort", test.sort)
+		}
+		recorder := respondList(t, items, options, query)
+		if got := names(decodeList(t, recorder)); !slices.Equal(got, test.want) {
+			t.Errorf("sort %q = %v, want %v", test.sort, got, test.want)
+		}
+		if total := recorder.Header().Get("X-Total-Count"); total != "3" {
+			t.Errorf("sort %q: X-Total-Count = %q, want 3", test.sort, total)
+		}
+	}
+}
+
+func TestRespondListRejects(t *testing.T) {
+	items := listItems("a", "b", "c")
+	options := ListOptions[listItem]{Sorts: listItemSorts, DefaultSort: "name"}
+
+	first := respondList(t, items, options, url.Values{"limit": {"1"}})
+	cursor := first.Header().Get("X-Next-Cursor")
+	if cursor == "" {
+		t.Fatal("no cursor for the first page")
+	}
+
+	tests := []struct {
+		name  string
+		query url.Values
+	}{
+		{"unknown sort", url.Values{"sort": {"missing"}}},
+		{"zero limit", url.Values{"limit": {"0"}}},
+		{"limit too large", url.Values{"limit": {strconv.Itoa(maxPageLimit + 1)}}},
+		{"limit not a number", url.Values{"limit": {"ten"}}},
+		{"garbage cursor", url.Values{"cursor": {"!!!"}}},
+		{"cursor for another sort", url.Values{"cursor": {cursor}, "sort": {"-name"}}},
+		{"keyed cursor without keys", url.Values{"cursor": {encodeCursor(listCursor{Sort: "name", Offset: 1, Limit: 1})}}},
+		{"negative offset", url.Values{"cursor": {encodeCursor(listCursor{Sort: "relevance", Offset: -1, Limit: 1})}, "sort": {"relevance"}}},
+		{"cursor limit too large", url.Values{"cursor": {encodeCursor(listCursor{Sort: "relevance", Limit: maxPageLimit + 1})}, "sort": {"relevance"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if recorder := respondList(t, items, options, test.query); recorder.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d", recorder.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+// pageThrough follows X-Next-Cursor from the first page, letting change alter the list between requests.
+func pageThrough(t *testing.T, items []listItem, options ListOptions[listItem], query url.Values, change func([]listItem) []listItem) [][]string {
+	t.Helper()
+
+	var pages [][]string
+	for range 10 {
+		recorder := respondList(t, items, options, query)
+		pages = append(pages, names(decodeList(t, recorder)))
+
+		cursor := recorder.Header().Get("X-Next-Cursor")
+		if cursor == "" {
+			return pages
+		}
+		query = url.Values{"cursor": {cursor}}
+		if change != nil {
+			items = change(items)
+		}
+	}
+	t.Fatal("paging did not end")
+	return nil
+}
+
+func TestRespondListPagesKeepLimit(t *testing.T) {
+	items := listItems("a", "b", "c", "d", "e")
+	options := ListOptions[listItem]{Sorts: listItemSorts, DefaultSort: "name", DefaultLimit: 3}
+
+	pages := pageThrough(t, items, options, url.Values{"limit": {"2"}}, nil)
+	want := [][]string{{"a", "b"}, {"c", "d"}, {"e"}}
+	if !slices.EqualFunc(pages, want, slices.Equal[[]string]) {
+		t.Fatalf("pages = %v, want %v", pages, want)
+	}
+
+	pages = pageThrough(t, items, options, url.Values{}, nil)
+	want = [][]string{{"a", "b", "c"}, {"d", "e"}}
+	if !slices.EqualFunc(pages, want, slices.Equal[[]string]) {
+		t.Fatalf("default limit pages = %v, want %v", pages, want)
+	}
+}
+
+func TestRespondListKeysetSurvivesChanges(t *testing.T) {
+	items := listItems("a", "b", "c", "d", "e")
+	options := ListOptions[listItem]{Sorts: listItemSorts, DefaultSort: "name"}
+
+	// Removing an item already sent must not skip the next one
+	removeFirst := func(items []listItem) []listItem {
+		return slices.DeleteFunc(slices.Clone(items), func(item listItem) bool { return item.Name == "a" })
+	}
+	pages := pageThrough(t, items, options, url.Values{"limit": {"2"}}, removeFirst)
+	want := [][]string{{"a", "b"}, {"c", "d"}, {"e"}}
+	if !slices.EqualFunc(pages, want, slices.Equal[[]string]) {
+		t.Fatalf("pages after removal = %v, want %v", pages, want)
+	}
+
+	// Adding an item before the cursor must not repeat one
+	addFirst := func(items []listItem) []listItem {
+		if slices.ContainsFunc(items, func(item listItem) bool { return item.Name == "0" }) {
+			return items
+		}
+		return append(slices.Clone(items), listItem{ID: "new", Name: "0"})
+	}
+	pages = pageThrough(t, items, options, url.Values{"limit": {"2"}}, addFirst)
+	if !slices.EqualFunc(pages, want, slices.Equal[[]string]) {
+		t.Fatalf("pages after insertion = %v, want %v", pages, want)
+	}
+}
+
+func TestRespondListOffsetSort(t *testing.T) {
+	items := listItems("a", "b", "c")
+	options := ListOptions[listItem]{Sorts: listItemSorts, DefaultSort: "relevance"}
+
+	pages := pageThrough(t, items, options, url.Values{"limit": {"2"}}, nil)
+	want := [][]string{{"a", "b"}, {"c"}}
+	if !slices.EqualFunc(pages, want, slices.Equal[[]string]) {
+		t.Fatalf("pages = %v, want %v", pages, want)
+	}
+}
+
+func TestRespondListFields(t *testing.T) {
+	items := listItems("a")
+	recorder := respondList(t, items, ListOptions[listItem]{Sorts: listItemSorts, DefaultSort: "name"},
+		url.Values{"fields": {"name, missing"}})
+
+	var body []map[string]any
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body) != 1 || len(body[0]) != 1 || body[0]["name"] != "a" {
+		t.Fatalf("fields body = %v, want [{name: a}]", body)
+	}
+}
+
+func TestRespondListTruncated(t *testing.T) {
+	recorder := respondList(t, listItems("a"), ListOptions[listItem]{Sorts: listItemSorts, Truncated: true}, url.Values{})
+	if recorder.Header().Get("X-Truncated") != "true" {
+		t.Fatal("X-Truncated not set")
+	}
+}
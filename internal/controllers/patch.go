@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gorhill/cronexpr"
+	"net/mail"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// MergePatch is a decoded JSON Merge Patch (RFC 7396) document for a flat resource.
+// Fields missing from the document are left untouched and fields set to null are cleared.
+type MergePatch map[string]json.RawMessage
+
+const (
+	maxDescriptionLength = 2000
+	maxTags              = 10
+	maxTagLength         = 32
+)
+
+var colorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+
+// BindMergePatch decodes the request body as a merge patch, rejecting any field not listed in fields.
+func BindMergePatch(c *gin.Context, fields ...string) (MergePatch, error) {
+	var patch MergePatch
+	if err := json.NewDecoder(c.Request.Body).Decode(&patch); err != nil {
+		return nil, err
+	}
+	if patch == nil {
+		return nil, errors.New("patch must be a JSON object")
+	}
+
+	for key := range patch {
+		if !slices.Contains(fields, key) {
+			return nil, fmt.Errorf("%s cannot be patched", key)
+		}
+	}
+
+	return patch, nil
+}
+
+// PatchValue decodes a field that cannot be cleared, returning nil when the patch omits it.
+func PatchValue[T any](patch MergePatch, key string) (*T, error) {
+	raw, found := patch[key]
+	if !found {
+		return nil, nil
+	}
+	if isJSONNull(raw) {
+		return nil, fmt.Errorf("%s cannot be null", key)
+	}
+
+	var value T
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", key, err)
+	}
+
+	return &value, nil
+}
+
+// PatchNullable decodes a field that may be cleared with null.
+// set reports whether the patch mentions the field at all, and value is nil when it is being cleared.
+func PatchNullable[T any](patch MergePatch, key string) (value *T, set bool, err error) {
+	raw, found := patch[key]
+	if !found {
+		return nil, false, nil
+	}
+	if isJSONNull(raw) {
+		return nil, true, nil
+	}
+
+	value = new(T)
+	if err := json.Unmarshal(raw, value); err != nil {
+		return nil, false, fmt.Errorf("invalid %s: %w", key, err)
+	}
+
+	return value, true, nil
+}
+
+func isJSONNull(raw json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+}
+
+func validateRequired(key string, value *string) error {
+	if value != nil && strings.TrimSpace(*value) == "" {
+		return fmt.Errorf("%s cannot be empty", key)
+	}
+	return nil
+}
+
+func validateColor(color *string) error {
+	if color != nil && !colorPattern.MatchString(*color) {
+		return errors.New("color must be a hex color such as #4285F4")
+	}
+	return nil
+}
+
+func validateEmail(email *string) error {
+	if email == nil {
+		return nil
+	}
+	if _, err := mail.ParseAddress(*email); err != nil {
+		return errors.New("email is not a valid address")
+	}
+	return nil
+}
+
+func validateFrequency(frequency *string) error {
+	if frequency == nil || *frequency == "" {
+		return nil
+	}
+	if _, err := cronexpr.Parse(*frequency); err != nil {
+		return fmt.Errorf("invalid frequency: %w", err)
+	}
+	return nil
+}
+
+func validateNonNegative(key string, value *int32) error {
+	if value != nil && *value < 0 {
+		return fmt.Errorf("%s cannot be negative", key)
+	}
+	return nil
+}
+
+func validateDescription(description *string) error {
+	if description != nil && len(*description) > maxDescriptionLength {
+		return fmt.Errorf("description cannot be longer than %d characters", maxDescriptionLength)
+	}
+	return nil
+}
+
+// normalizeTags lowercases, trims and de-duplicates tags so directory filters match regardless of how they were typed.
+// It never returns nil, since tags cannot be null.
+func normalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || slices.Contains(normalized, tag) {
+			continue
+		}
+		if len(tag) > maxTagLength {
+			return nil, fmt.Errorf("tags cannot be longer than %d characters", maxTagLength)
+		}
+		normalized = append(normalized, tag)
+	}
+
+	if len(normalized) > maxTags {
+		return nil, fmt.Errorf("a calendar can have at most %d tags", maxTags)
+	}
+
+	return normalized, nil
+}
@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func bindPatch(t *testing.T, body string, fields ...string) (MergePatch, error) {
+	t.Helper()
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(body))
+	return BindMergePatch(c, fields...)
+}
+
+func TestBindMergePatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr bool
+		want    []string
+	}{
+		{"allowed fields", `{"name": "Work", "color": null}`, false, []string{"name", "color"}},
+		{"empty object", `{}`, false, nil},
+		{"unknown field", `{"name": "Work", "owner": "someone"}`, true, nil},
+		{"null document", `null`, true, nil},
+		{"array", `[{"name": "Work"}]`, true, nil},
+		{"string", `"name"`, true, nil},
+		{"malformed", `{"name": `, true, nil},
+		{"empty body", ``, true, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			patch, err := bindPatch(t, test.body, "name", "color")
+			if (err != nil) != test.wantErr {
+				t.Fatalf("error = %v, want error %v", err, test.wantErr)
+			}
+			if len(patch) != len(test.want) {
+				t.Fatalf("patch = %v, want keys %v", patch, test.want)
+			}
+			for _, key := range test.want {
+				if _, ok := patch[key]; !ok {
+					t.Errorf("patch is missing %s", key)
+				}
+			}
+		})
+	}
+}
+
+func TestPatchValue(t *testing.T) {
+	patch, err := bindPatch(t, `{"name": "Work", "count": 3, "enabled": false, "cleared": null, "wrong": "three"}`,
+		"name", "count", "enabled", "cleared", "wrong")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name, err := PatchValue[string](patch, "name")
+	if err != nil || name == nil || *name != "Work" {
+		t.Errorf("name = %v, %v, want Work", name, err)
+	}
+	count, err := PatchValue[int32](patch, "count")
+	if err != nil || count == nil || *count != 3 {
+		t.Errorf("count = %v, %v, want 3", count, err)
+	}
+	// false is a value, not a missing field
+	enabled, err := PatchValue[bool](patch, "enabled")
+	if err != nil || enabled == nil || *enabled {
+		t.Errorf("enabled = %v, %v, want false", enabled, err)
+	}
+
+	missing, err := PatchValue[string](patch, "missing")
+	if err != nil || missing != nil {
+		t.Errorf("missing = %v, %v, want nil without error", missing, err)
+	}
+	if _, err := PatchValue[string](patch, "cleared"); err == nil {
+		t.Error("null accepted for a field that cannot be cleared")
+	}
+	if _, err := PatchValue[int32](patch, "wrong"); err == nil {
+		t.Error("string accepted for a number")
+	}
+}
+
+func TestPatchNullable(t *testing.T) {
+	patch, err := bindPatch(t, `{"description": "Notes", "color": null, "wrong": 5}`, "description", "color", "wrong")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key     string
+		want    *string
+		wantSet bool
+		wantErr bool
+	}{
+		{"description", stringPtr("Notes"), true, false},
+		{"color", nil, true, false},
+		{"missing", nil, false, false},
+		{"wrong", nil, false, true},
+	}
+	for _, test := range tests {
+		t.Run(test.key, func(t *testing.T) {
+			value, set, err := PatchNullable[string](patch, test.key)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("error = %v, want error %v", err, test.wantErr)
+			}
+			if set != test.wantSet {
+				t.Errorf("set = %v, want %v", set, test.wantSet)
+			}
+			if (value == nil) != (test.want == nil) || (value != nil && *value != *test.want) {
+				t.Errorf("value = %v, want %v", value, test.want)
+			}
+		})
+	}
+}
+
+func stringPtr(value string) *string {
+	return &value
+}
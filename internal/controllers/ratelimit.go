@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"calenduh-backend/internal/cache"
+	"calenduh-backend/internal/sqlc"
+	"calenduh-backend/internal/util"
+	"github.com/JGLTechnologies/gin-rate-limit"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rate limit buckets. Each is configured with RATE_LIMIT_<BUCKET> as "<requests>/<period>", such as "10/1m", and
+// turned off with "0".
+const (
+	RateLimitIP     = "ip"
+	RateLimitWrite  = "write"
+	RateLimitAuth   = "auth"
+	RateLimitImport = "import"
+	RateLimitUpload = "upload"
+)
+
+const rateLimitKeyPrefix = "calenduh:ratelimit:"
+
+type rateLimit struct {
+	Limit  uint
+	Period time.Duration
+	// PerUser counts signed in users' requests together wherever they come from. Requests without a session are
+	// always counted per IP address.
+	PerUser bool
+	// WritesOnly lets GET, HEAD and OPTIONS requests through without counting them.
+	WritesOnly bool
+}
+
+var rateLimits = map[string]rateLimit{
+	RateLimitIP:     {Limit: 600, Period: time.Minute},
+	RateLimitWrite:  {Limit: 120, Period: time.Minute, PerUser: true, WritesOnly: true},
+	RateLimitAuth:   {Limit: 10, Period: time.Minute},
+	RateLimitImport: {Limit: 5, Period: time.Minute, PerUser: true},
+	RateLimitUpload: {Limit: 30, Period: time.Minute, PerUser: true},
+}
+
+var (
+	rateLimiters   = make(map[string]gin.HandlerFunc)
+	rateLimitersMu sync.Mutex
+)
+
+// RateLimit limits the requests in a bucket, answering 429 with Retry-After once the bucket is used up. Counts are
+// kept in Redis when that is the cache backend, so every instance shares them. Every route limited by a bucket
+// shares the one store, so a bucket's limit covers all of them together.
+func RateLimit(bucket string) gin.HandlerFunc {
+	rateLimitersMu.Lock()
+	defer rateLimitersMu.Unlock()
+
+	limiter, ok := rateLimiters[bucket]
+	if !ok {
+		limiter = newRateLimiter(bucket)
+		rateLimiters[bucket] = limiter
+	}
+	return limiter
+}
+
+func newRateLimiter(bucket string) gin.HandlerFunc {
+	limit := configuredRateLimit(bucket)
+	if limit.Limit == 0 {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	var skip func(c *gin.Context) bool
+	if limit.WritesOnly {
+		skip = func(c *gin.Context) bool {
+			method := c.Request.Method
+			return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+		}
+	}
+
+	var store ratelimit.Store
+	if backend, ok := cache.Default.(*cache.Redis); ok {
+		store = ratelimit.RedisStore(&ratelimit.RedisOptions{
+			Rate:        limit.Period,
+			Limit:       limit.Limit,
+			RedisClient: backend.Client(),
+			Skip:        skip,
+		})
+	} else {
+		store = ratelimit.InMemoryStore(&ratelimit.InMemoryOptions{
+			Rate:  limit.Period,
+			Limit: limit.Limit,
+			Skip:  skip,
+		})
+	}
+
+	return ratelimit.RateLimiter(store, &ratelimit.Options{
+		ErrorHandler: util.HandleRateLimit,
+		KeyFunc: func(c *gin.Context) string {
+			if limit.PerUser {
+				if v, found := c.Get("user"); found {
+					if user, ok := v.(*sqlc.User); ok {
+						return rateLimitKeyPrefix + bucket + ":user:" + user.UserID
+					}
+				}
+			}
+			return rateLimitKeyPrefix + bucket + ":ip:" + c.ClientIP()
+		},
+	})
+}
+
+// configuredRateLimit reads a bucket's RATE_LIMIT_<BUCKET> setting over its default.
+func configuredRateLimit(bucket string) rateLimit {
+	limit := rateLimits[bucket]
+	key := "RATE_LIMIT_" + strings.ToUpper(bucket)
+	value := os.Getenv(key)
+	if value == "" {
+		return limit
+	}
+	if value == "0" {
+		limit.Limit = 0
+		return limit
+	}
+
+	requests, period, found := strings.Cut(value, "/")
+	count, err := strconv.ParseUint(requests, 10, 32)
+	if !found || err != nil {
+		log.Fatal("Invalid rate limit for environment variable: " + key)
+	}
+	duration, err := time.ParseDuration(period)
+	if err != nil || duration < time.Second {
+		log.Fatal("Invalid rate limit for environment variable: " + key)
+	}
+
+	limit.Limit = uint(count)
+	limit.Period = duration
+	return limit
+}
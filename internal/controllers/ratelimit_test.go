@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestConfiguredRateLimit(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  rateLimit
+	}{
+		{"default", "", rateLimits[RateLimitWrite]},
+		{"disabled", "0", rateLimit{Limit: 0, Period: time.Minute, PerUser: true, WritesOnly: true}},
+		{"custom", "10/30s", rateLimit{Limit: 10, Period: 30 * time.Second, PerUser: true, WritesOnly: true}},
+		{"hourly", "1000/1h", rateLimit{Limit: 1000, Period: time.Hour, PerUser: true, WritesOnly: true}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("RATE_LIMIT_WRITE", test.value)
+			if got := configuredRateLimit(RateLimitWrite); got != test.want {
+				t.Fatalf("configuredRateLimit = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+// TestConfiguredRateLimitInvalid runs each invalid setting in a child process, since configuredRateLimit exits.
+func TestConfiguredRateLimitInvalid(t *testing.T) {
+	if value, ok := os.LookupEnv("RATE_LIMIT_TEST_CHILD"); ok {
+		os.Setenv("RATE_LIMIT_AUTH", value)
+		configuredRateLimit(RateLimitAuth)
+		return
+	}
+
+	for _, value := range []string{"10", "ten/1m", "-1/1m", "10/", "10/soon", "10/500ms", "99999999999/1m"} {
+		t.Run(value, func(t *testing.T) {
+			cmd := exec.Command(os.Args[0], "-test.run=^TestConfiguredRateLimitInvalid$")
+			cmd.Env = append(os.Environ(), "RATE_LIMIT_TEST_CHILD="+value)
+			if err := cmd.Run(); err == nil {
+				t.Fatalf("RATE_LIMIT_AUTH=%s was accepted", value)
+			}
+		})
+	}
+}
+
+// limitedRouter serves a route behind a fresh limiter for bucket, without the limiters RateLimit has cached.
+func limitedRouter(bucket string) *gin.Engine {
+	router := gin.New()
+	router.Any("/", newRateLimiter(bucket), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return router
+}
+
+func limitedRequest(router *gin.Engine, method string, ip string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest(method, "/", nil)
+	req.RemoteAddr = ip + ":1234"
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestRateLimitRejectsOverLimit(t *testing.T) {
+	t.Setenv("RATE_LIMIT_AUTH", "2/1m")
+	router := limitedRouter(RateLimitAuth)
+
+	for i := range 2 {
+		if recorder := limitedRequest(router, http.MethodPost, "192.0.2.1"); recorder.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want %d", i+1, recorder.Code, http.StatusOK)
+		}
+	}
+
+	recorder := limitedRequest(router, http.MethodPost, "192.0.2.1")
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusTooManyRequests)
+	}
+	retryAfter, err := strconv.Atoi(recorder.Header().Get("Retry-After"))
+	if err != nil || retryAfter < 1 || retryAfter > 60 {
+		t.Fatalf("Retry-After = %q, want between 1 and 60 seconds", recorder.Header().Get("Retry-After"))
+	}
+
+	// Another address has its own count
+	if recorder := limitedRequest(router, http.MethodPost, "192.0.2.2"); recorder.Code != http.StatusOK {
+		t.Fatalf("other address: status = %d, want %d", recorder.Code, http.StatusOK)
+	}
+}
+
+func TestRateLimitWritesOnly(t *testing.T) {
+	t.Setenv("RATE_LIMIT_WRITE", "1/1m")
+	router := limitedRouter(RateLimitWrite)
+
+	for range 3 {
+		if recorder := limitedRequest(router, http.MethodGet, "192.0.2.1"); recorder.Code != http.StatusOK {
+			t.Fatalf("GET: status = %d, want %d", recorder.Code, http.StatusOK)
+		}
+	}
+	if recorder := limitedRequest(router, http.MethodPost, "192.0.2.1"); recorder.Code != http.StatusOK {
+		t.Fatalf("first POST: status = %d, want %d", recorder.Code, http.StatusOK)
+	}
+	if recorder := limitedRequest(router, http.MethodPost, "192.0.2.1"); recorder.Code != http.StatusTooManyRequests {
+		t.Fatalf("second POST: status = %d, want %d", recorder.Code, http.StatusTooManyRequests)
+	}
+}
+
+func TestRateLimitDisabled(t *testing.T) {
+	t.Setenv("RATE_LIMIT_AUTH", "0")
+	router := limitedRouter(RateLimitAuth)
+
+	for range 20 {
+		if recorder := limitedRequest(router, http.MethodPost, "192.0.2.1"); recorder.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", recorder.Code, http.StatusOK)
+		}
+	}
+}
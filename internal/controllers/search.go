@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"calenduh-backend/internal/database"
+	"calenduh-backend/internal/sqlc"
+	"github.com/gin-gonic/gin"
+	"github.com/gorhill/cronexpr"
+	"maps"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultSearchLimit = 50
+	// maxSearchSeries bounds how many matching events are loaded before occurrences are expanded.
+	maxSearchSeries = 1000
+	// maxSeriesOccurrences bounds how many occurrences a single recurring event contributes to the results.
+	maxSeriesOccurrences = 366
+)
+
+// searchSorts adds relevance, which keeps the order the database ranked the matches in, to the usual event sorts.
+var searchSorts = func() map[string]ListSort[sqlc.Event] {
+	sorts := maps.Clone(EventSorts)
+	sorts["relevance"] = ListSort[sqlc.Event]{Compare: func(a, b sqlc.Event) int { return 0 }}
+	return sorts
+}()
+
+// SearchEvents
+// @Summary Search events
+// @Description Full-text search (q) over event names, locations and descriptions, filtered by calendar_id, group_id, priority, all_day, has_image, start and end. Recurring events return each occurrence in range. Pages of 50 by start_time unless sort and limit say otherwise.
+func SearchEvents(c *gin.Context) {
+	user := *ParseUser(c)
+	start, end := ParseRange(c)
+
+	params := sqlc.SearchEventsParams{
+		UserID:     user.UserID,
+		Query:      optionalQuery(c, "q"),
+		CalendarID: optionalQuery(c, "calendar_id"),
+		GroupID:    optionalQuery(c, "group_id"),
+		StartTime:  *start,
+		EndTime:    *end,
+		MaxResults: maxSearchSeries,
+	}
+
+	if value := c.Query("priority"); value != "" {
+		priority, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "priority must be an integer"})
+			return
+		}
+		priority32 := int32(priority)
+		params.Priority = &priority32
+	}
+
+	var ok bool
+	if params.AllDay, ok = optionalBoolQuery(c, "all_day"); !ok {
+		return
+	}
+	if params.HasImage, ok = optionalBoolQuery(c, "has_image"); !ok {
+		return
+	}
+
+	series, err := database.Db.Queries.SearchEvents(c, params)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	truncated := len(series) == maxSearchSeries
+	occurrences := make([]sqlc.Event, 0, len(series))
+	for _, event := range series {
+		expanded, capped, err := expandOccurrences(event, *start, *end)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		occurrences = append(occurrences, expanded...)
+		truncated = truncated || capped
+	}
+
+	// Occurrences starting together keep their relevance order since sorting is stable
+	RespondList(c, occurrences, ListOptions[sqlc.Event]{
+		Sorts:        searchSorts,
+		DefaultSort:  "start_time",
+		DefaultLimit: defaultSearchLimit,
+		Truncated:    truncated,
+	})
+}
+
+// expandOccurrences returns every occurrence of an event that overlaps the range, including the event itself.
+// Unlike GenerateRecurrenceEvents it skips straight to the range and caps each series on its own, reporting
+// whether the cap left occurrences out.
+func expandOccurrences(event sqlc.Event, start time.Time, end time.Time) ([]sqlc.Event, bool, error) {
+	occurrences := make([]sqlc.Event, 0, 1)
+	if event.EndTime.After(start) && event.StartTime.Before(end) {
+		occurrences = append(occurrences, event)
+	}
+
+	if event.Frequency == nil || *event.Frequency == "" {
+		return occurrences, false, nil
+	}
+
+	expr, err := cronexpr.Parse(*event.Frequency)
+	if err != nil {
+		return nil, false, err
+	}
+
+	duration := event.EndTime.Sub(event.StartTime)
+	from := event.EndTime
+	if earliest := start.Add(-duration); earliest.After(from) {
+		from = earliest
+	}
+
+	for date := expr.Next(from); !date.IsZero() && date.Before(end); date = expr.Next(date) {
+		if len(occurrences) >= maxSeriesOccurrences {
+			return occurrences, true, nil
+		}
+
+		occurrence := event
+		occurrence.StartTime = date
+		occurrence.EndTime = date.Add(duration)
+		if occurrence.EndTime.After(start) {
+			occurrences = append(occurrences, occurrence)
+		}
+	}
+
+	return occurrences, false, nil
+}
+
+// optionalBoolQuery parses an optional boolean query parameter, aborting with 400 if it is malformed.
+func optionalBoolQuery(c *gin.Context, key string) (*bool, bool) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, true
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": key + " must be true or false"})
+		return nil, false
+	}
+
+	return &parsed, true
+}
@@ -38,22 +38,54 @@ func CreateSubscription(c *gin.Context) {
 
 	input.UserID = user.UserID
 
+	// Codes that are not a calendar's own invite code may belong to one of its invite links
+	var invite *sqlc.InviteLink
 	if input.CalendarID == "" {
 		if input.InviteCode == nil {
 			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing invite code"})
 			return
 		}
 		calendar, err := database.Db.Queries.GetCalendarByInviteCode(c, *input.InviteCode)
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "calendar not found"})
+		if err == nil {
+			input.CalendarID = calendar.CalendarID
+		} else {
+			link, err := database.Db.Queries.GetInviteLinkByCode(c, *input.InviteCode)
+			if err != nil || link.CalendarID == nil {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "calendar not found"})
+				return
+			}
+			invite = &link
+			input.CalendarID = *link.CalendarID
+		}
+	} else if input.InviteCode != nil {
+		link, err := database.Db.Queries.GetInviteLinkByCode(c, *input.InviteCode)
+		if err == nil && link.CalendarID != nil && *link.CalendarID == input.CalendarID {
+			invite = &link
+		}
+	}
+
+	if invite == nil {
+		if err := database.Db.Queries.CreateSubscription(c, input); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 			return
 		}
 
-		input.CalendarID = calendar.CalendarID
+		c.Status(http.StatusOK)
+		return
 	}
 
-	if err := database.Db.Queries.CreateSubscription(c, input); err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+	if err := database.Transaction(c, func(queries *sqlc.Queries) error {
+		if err := claimInvite(c, queries, *invite, user.UserID); err != nil {
+			return err
+		}
+		return queries.CreateSubscription(c, input)
+	}); err != nil {
+		switch {
+		case errors.Is(err, errInviteUnavailable):
+			c.AbortWithStatusJSON(http.StatusGone, gin.H{"error": err.Error()})
+		default:
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		}
 		return
 	}
 
@@ -85,6 +117,7 @@ func DeleteSubscription(c *gin.Context) {
 		return
 	}
 
+	RecordAudit(c, AuditSubscriptionDelete, "user", userId, gin.H{"calendar_id": calendarId})
 	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
 }
 
@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"calenduh-backend/internal/database"
+	"calenduh-backend/internal/jobs"
+	"calenduh-backend/internal/sqlc"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+type SyncResponse struct {
+	SyncToken string           `json:"sync_token"`
+	Calendars []sqlc.Calendar  `json:"calendars"`
+	Events    []sqlc.Event     `json:"events"`
+	Groups    []sqlc.Group     `json:"groups"`
+	Deleted   []sqlc.Tombstone `json:"deleted"`
+}
+
+var errSyncTokenExpired = errors.New("sync token expired")
+
+// Sync
+// @Summary Delta sync for offline clients
+// @Description Returns calendars, events, groups and deletions since the provided sync token, or everything when omitted.
+func Sync(c *gin.Context) {
+	user := *ParseUser(c)
+
+	since, err := parseSyncToken(c.Query("token"))
+	if err != nil {
+		switch {
+		case errors.Is(err, errSyncTokenExpired):
+			c.AbortWithStatusJSON(http.StatusGone, gin.H{"error": err.Error()})
+		default:
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid sync token"})
+		}
+		return
+	}
+
+	// Read the oldest running transaction first, so anything it or a later one writes is sent again next time even
+	// when it commits after we query
+	current, err := database.Db.Queries.GetSyncWatermark(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	calendars, err := database.Db.Queries.GetChangedCalendars(c, sqlc.GetChangedCalendarsParams{
+		UserID: user.UserID,
+		Since:  since,
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	events, err := database.Db.Queries.GetChangedEvents(c, sqlc.GetChangedEventsParams{
+		UserID: user.UserID,
+		Since:  since,
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	groups, err := database.Db.Queries.GetChangedGroups(c, sqlc.GetChangedGroupsParams{
+		UserID: user.UserID,
+		Since:  since,
+	})
+	if err == nil {
+		groups, err = redactGroups(c, groups)
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	deleted := make([]sqlc.Tombstone, 0)
+	if since > 0 {
+		deleted, err = database.Db.Queries.GetTombstones(c, sqlc.GetTombstonesParams{
+			Since:  since,
+			UserID: user.UserID,
+		})
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// A calendar can lose one way of being seen while keeping another, so removals of calendars sent as changed are
+	// left out
+	visible := make(map[string]bool, len(calendars))
+	for _, calendar := range calendars {
+		visible[calendar.CalendarID] = true
+	}
+	deleted = slices.DeleteFunc(deleted, func(tombstone sqlc.Tombstone) bool {
+		return (tombstone.EntityType == "calendar" || tombstone.EntityType == "subscription") &&
+			tombstone.CalendarID != nil && visible[*tombstone.CalendarID]
+	})
+
+	c.JSON(http.StatusOK, SyncResponse{
+		SyncToken: createSyncToken(current),
+		Calendars: calendars,
+		Events:    events,
+		Groups:    groups,
+		Deleted:   deleted,
+	})
+}
+
+// createSyncToken encodes a transaction watermark and the time it was issued into an opaque token.
+func createSyncToken(xid int64) string {
+	raw := fmt.Sprintf("v2:%d:%d", xid, time.Now().UnixMilli())
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// parseSyncToken returns the transaction watermark encoded in a token, or 0 for an empty token. Tokens from before
+// watermarks held a sequence position, and are expired so the client starts over.
+func parseSyncToken(token string) (int64, error) {
+	if token == "" {
+		return 0, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, err
+	}
+
+	if strings.HasPrefix(string(raw), "v1:") {
+		return 0, errSyncTokenExpired
+	}
+
+	var xid, issued int64
+	if _, err = fmt.Sscanf(string(raw), "v2:%d:%d", &xid, &issued); err != nil {
+		return 0, err
+	}
+
+	if time.Since(time.UnixMilli(issued)) > jobs.TombstoneRetention {
+		return 0, errSyncTokenExpired
+	}
+
+	return xid, nil
+}
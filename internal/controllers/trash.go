@@ -0,0 +1,258 @@
+package controllers
+
+import (
+	"calenduh-backend/internal/database"
+	"calenduh-backend/internal/jobs"
+	"calenduh-backend/internal/sqlc"
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// TrashResponse lists what the user can restore. Items are purged RetentionDays after their deleted_at.
+// Events and calendars trashed along with their parent are restored with it and are not listed separately.
+type TrashResponse struct {
+	Calendars     []sqlc.Calendar `json:"calendars"`
+	Events        []sqlc.Event    `json:"events"`
+	Groups        []sqlc.Group    `json:"groups"`
+	RetentionDays int             `json:"retention_days"`
+}
+
+// GetTrash
+// @Summary List recently deleted items
+// @Description Lists the calendars, events and groups the user has deleted that can still be restored.
+func GetTrash(c *gin.Context) {
+	user := *ParseUser(c)
+
+	calendars, err := database.Db.Queries.GetTrashedCalendars(c, user.UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	events, err := database.Db.Queries.GetTrashedEvents(c, user.UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	groups, err := database.Db.Queries.GetTrashedGroups(c, user.UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, TrashResponse{
+		Calendars:     calendars,
+		Events:        events,
+		Groups:        groups,
+		RetentionDays: int(jobs.TrashRetention / (24 * time.Hour)),
+	})
+}
+
+// RestoreTrashedEvent
+// @Summary Restore a deleted event
+// @Description Moves an event out of the trash. Its calendar must not be in the trash.
+func RestoreTrashedEvent(c *gin.Context) {
+	user := *ParseUser(c)
+	groups := *ParseGroups(c)
+	eventId := c.Param("event_id")
+	if eventId == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "event_id is required"})
+		return
+	}
+
+	event, err := database.Db.Queries.GetTrashedEventById(c, eventId)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "event not found in trash"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	calendar, err := database.Db.Queries.GetCalendarById(c, event.CalendarID)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "calendar is in the trash, restore it first"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if !CanEditCalendar(calendar, user.UserID, groups) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	if isPurgeable(event.DeletedAt) {
+		c.AbortWithStatusJSON(http.StatusGone, gin.H{"error": "event has been in the trash too long to restore"})
+		return
+	}
+
+	if err = database.TransactionAs(c, user.UserID, func(queries *sqlc.Queries) error {
+		event, err = queries.RestoreTrashedEvent(c, eventId)
+		return err
+	}); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	RecordAudit(c, AuditEventRestore, "event", eventId, gin.H{"calendar_id": event.CalendarID})
+	c.Header("ETag", VersionETag(event.ChangeSeq))
+	c.JSON(http.StatusOK, event)
+}
+
+// RestoreTrashedCalendar
+// @Summary Restore a deleted calendar
+// @Description Moves a calendar and the events deleted along with it out of the trash.
+func RestoreTrashedCalendar(c *gin.Context) {
+	user := *ParseUser(c)
+	groups := *ParseGroups(c)
+	calendarId := c.Param("calendar_id")
+	if calendarId == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "calendar_id is required"})
+		return
+	}
+
+	calendar, err := database.Db.Queries.GetTrashedCalendarById(c, calendarId)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "calendar not found in trash"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if calendar.GroupID != nil {
+		if _, err = database.Db.Queries.GetTrashedGroupById(c, *calendar.GroupID); err == nil {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "group is in the trash, restore it first"})
+			return
+		} else if !errors.Is(err, pgx.ErrNoRows) {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if !CanEditCalendar(calendar, user.UserID, groups) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	if isPurgeable(calendar.DeletedAt) {
+		c.AbortWithStatusJSON(http.StatusGone, gin.H{"error": "calendar has been in the trash too long to restore"})
+		return
+	}
+
+	deletedAt := *calendar.DeletedAt
+	if err = database.TransactionAs(c, user.UserID, func(queries *sqlc.Queries) error {
+		if err := queries.RestoreTrashedCalendarEvents(c, sqlc.RestoreTrashedCalendarEventsParams{
+			CalendarID: calendarId,
+			DeletedAt:  deletedAt,
+		}); err != nil {
+			return err
+		}
+
+		calendar, err = queries.RestoreTrashedCalendar(c, calendarId)
+		return err
+	}); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	RecordAudit(c, AuditCalendarRestore, "calendar", calendarId, nil)
+	c.Header("ETag", VersionETag(calendar.ChangeSeq))
+	c.JSON(http.StatusOK, calendar)
+}
+
+// RestoreTrashedGroup
+// @Summary Restore a deleted group
+// @Description Moves a group and the calendars and events deleted along with it out of the trash.
+func RestoreTrashedGroup(c *gin.Context) {
+	user := *ParseUser(c)
+	groupId := c.Param("group_id")
+	if groupId == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "group_id is required"})
+		return
+	}
+
+	group, err := database.Db.Queries.GetTrashedGroupById(c, groupId)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "group not found in trash"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	members, err := database.Db.Queries.GetGroupMembers(c, groupId)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !slices.ContainsFunc(members, func(member sqlc.GroupMember) bool { return member.UserID == user.UserID }) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	if isPurgeable(group.DeletedAt) {
+		c.AbortWithStatusJSON(http.StatusGone, gin.H{"error": "group has been in the trash too long to restore"})
+		return
+	}
+
+	deletedAt := *group.DeletedAt
+	if err = database.TransactionAs(c, user.UserID, func(queries *sqlc.Queries) error {
+		if err := queries.RestoreTrashedGroupEvents(c, sqlc.RestoreTrashedGroupEventsParams{
+			DeletedAt: deletedAt,
+			GroupID:   groupId,
+		}); err != nil {
+			return err
+		}
+
+		if err := queries.RestoreTrashedGroupCalendars(c, sqlc.RestoreTrashedGroupCalendarsParams{
+			GroupID:   groupId,
+			DeletedAt: deletedAt,
+		}); err != nil {
+			return err
+		}
+
+		group, err = queries.RestoreTrashedGroup(c, groupId)
+		return err
+	}); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	RecordAudit(c, AuditGroupRestore, "group", groupId, nil)
+	c.JSON(http.StatusOK, group)
+}
+
+// trashGroup moves a group into the trash along with its calendars and their events.
+// Everything is stamped with the transaction's time so it can be restored as one.
+func trashGroup(ctx context.Context, queries *sqlc.Queries, groupId string) error {
+	if err := queries.TrashGroupEvents(ctx, groupId); err != nil {
+		return err
+	}
+	if err := queries.TrashGroupCalendars(ctx, groupId); err != nil {
+		return err
+	}
+	return queries.TrashGroup(ctx, groupId)
+}
+
+// isPurgeable reports whether an item has outlived the trash retention and is only waiting for the purge job.
+func isPurgeable(deletedAt *time.Time) bool {
+	return deletedAt == nil || time.Since(*deletedAt) > jobs.TrashRetention
+}
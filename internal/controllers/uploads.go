@@ -0,0 +1,382 @@
+package controllers
+
+import (
+	"bytes"
+	"calenduh-backend/internal/database"
+	"calenduh-backend/internal/images"
+	"calenduh-backend/internal/jobs"
+	"calenduh-backend/internal/sqlc"
+	"calenduh-backend/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	UploadPurposeProfile = "profile"
+	UploadPurposeEvent   = "event"
+	UploadPurposeGroup   = "group"
+	UploadPurposeFile    = "file"
+
+	maxUploadBytes = 10 << 20
+)
+
+var (
+	errImageSize     = errors.New("size must be one of avatar, card, full")
+	errImageNotOwned = errors.New("image must be one you uploaded")
+	errQuotaExceeded = errors.New("upload quota exceeded")
+)
+
+// UploadQuota is how many bytes of images, counting every variant, and event attachments each user may keep stored. main sets it from
+// UPLOAD_QUOTA_MB.
+var UploadQuota int64 = 200 << 20
+
+// ImageURLExpiry is how long the signed links handed out for private images stay valid. main sets it from
+// IMAGE_URL_EXPIRY_MINUTES.
+var ImageURLExpiry = 15 * time.Minute
+
+// UploadUsage reports how much of their quota a user has used.
+type UploadUsage struct {
+	UsedBytes  int64 `json:"used_bytes"`
+	QuotaBytes int64 `json:"quota_bytes"`
+}
+
+// GetUploadUsage
+// @Summary Get the user's upload usage
+// @Description Reports how many bytes the user's uploaded images, counting every size, and event attachments take up against their quota.
+func GetUploadUsage(c *gin.Context) {
+	user := *ParseUser(c)
+
+	used, err := database.Db.Queries.GetUploadUsage(c, &user.UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, UploadUsage{UsedBytes: used, QuotaBytes: UploadQuota})
+}
+
+// GetOrphanedFiles
+// @Summary Preview orphaned file collection
+// @Description Lists stored objects that no user, event, group, attachment, export or event history references, without deleting anything. Objects newer than the grace period are only counted.
+func GetOrphanedFiles(c *gin.Context) {
+	collectOrphanedFiles(c, true)
+}
+
+// DeleteOrphanedFiles
+// @Summary Collect orphaned files now
+// @Description Deletes the stored objects a preview would list instead of waiting for the daily job, and reports what was removed.
+func DeleteOrphanedFiles(c *gin.Context) {
+	collectOrphanedFiles(c, false)
+}
+
+func collectOrphanedFiles(c *gin.Context, dryRun bool) {
+	report, err := jobs.FindOrphanedObjects(c, dryRun)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !dryRun {
+		RecordAudit(c, AuditCollectOrphans, "", "", gin.H{"deleted": report.Deleted, "bytes_freed": report.BytesFreed, "failed": len(report.Failed)})
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// receiveImage reads the "file" form field, processes it into avatar, card and full sizes, and stores them against
+// the user's quota. Clients store and reference the full key; the other sizes are found through it.
+func receiveImage(c *gin.Context, purpose string) (sqlc.Upload, bool) {
+	user := *ParseUser(c)
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return sqlc.Upload{}, false
+	}
+	if header.Size > maxUploadBytes {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file must be at most 10 MB"})
+		return sqlc.Upload{}, false
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return sqlc.Upload{}, false
+	}
+	defer file.Close()
+
+	// The declared size comes from the client, so the read is capped as well
+	data, err := io.ReadAll(io.LimitReader(file, maxUploadBytes+1))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return sqlc.Upload{}, false
+	}
+	if len(data) > maxUploadBytes {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file must be at most 10 MB"})
+		return sqlc.Upload{}, false
+	}
+
+	result, err := images.Process(data)
+	if err != nil {
+		switch {
+		case errors.Is(err, images.ErrUnsupportedType):
+			c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		case errors.Is(err, images.ErrTooManyPixels):
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		case errors.Is(err, images.ErrInvalidImage):
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return sqlc.Upload{}, false
+	}
+
+	params := sqlc.CreateUploadParams{
+		UploadID:    gonanoid.Must(),
+		UserID:      &user.UserID,
+		Purpose:     purpose,
+		ContentType: result.ContentType,
+		SizeBytes:   result.Size(),
+	}
+
+	stored := make([]string, 0, len(result.Variants))
+	for _, variant := range result.Variants {
+		key := "uploads/" + params.UploadID + "/" + variant.Name + "." + result.Extension
+		if err := storage.Default.Put(c, key, bytes.NewReader(variant.Data), result.ContentType); err != nil {
+			deleteFiles(c, stored)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return sqlc.Upload{}, false
+		}
+		stored = append(stored, key)
+
+		switch variant.Name {
+		case images.VariantAvatar:
+			params.AvatarKey = key
+		case images.VariantCard:
+			params.CardKey = key
+		case images.VariantFull:
+			params.FullKey = key
+			params.Width = int32(variant.Width)
+			params.Height = int32(variant.Height)
+		}
+	}
+
+	var upload sqlc.Upload
+	used, err := reserveQuota(c, user.UserID, result.Size(), func(queries *sqlc.Queries) error {
+		var err error
+		upload, err = queries.CreateUpload(c, params)
+		return err
+	})
+	if err != nil {
+		deleteFiles(c, stored)
+		switch {
+		case errors.Is(err, errQuotaExceeded):
+			respondQuotaExceeded(c, used)
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return sqlc.Upload{}, false
+	}
+
+	return upload, true
+}
+
+// reserveQuota runs create, which records size more bytes stored by the user, only if they fit in the user's quota,
+// failing with errQuotaExceeded otherwise. The user's row stays locked until create is done so concurrent uploads
+// cannot each fit in the same space. It also returns how many bytes the user had used before.
+func reserveQuota(ctx context.Context, userId string, size int64, create func(queries *sqlc.Queries) error) (int64, error) {
+	var used int64
+	err := database.Transaction(ctx, func(queries *sqlc.Queries) error {
+		if _, err := queries.LockUploadQuota(ctx, userId); err != nil {
+			return err
+		}
+
+		var err error
+		if used, err = queries.GetUploadUsage(ctx, &userId); err != nil {
+			return err
+		}
+		if used+size > UploadQuota {
+			return errQuotaExceeded
+		}
+
+		return create(queries)
+	})
+	return used, err
+}
+
+// respondQuotaExceeded aborts with 413 and how much of their quota the user has used.
+func respondQuotaExceeded(c *gin.Context, used int64) {
+	c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+		"error": errQuotaExceeded.Error(),
+		"usage": UploadUsage{UsedBytes: used, QuotaBytes: UploadQuota},
+	})
+}
+
+// deleteImage removes every size of an uploaded image given its full key, as long as allowed accepts its uploader.
+// Images uploaded by someone else are left in place, since only the reference to them is going away. Keys from
+// before the upload pipeline only have the one object and no uploader, so they are only deleted once no row
+// references them, which means callers clear their reference first.
+func deleteImage(ctx context.Context, key string, allowed func(uploader *string) (bool, error)) error {
+	upload, err := imageUpload(ctx, key, allowed)
+	if err != nil {
+		if errors.Is(err, errImageNotOwned) {
+			return nil
+		}
+		return err
+	}
+	if upload == nil {
+		referenced, err := database.Db.Queries.IsObjectReferenced(ctx, key)
+		if err != nil || referenced {
+			return err
+		}
+		return deleteFile(ctx, key)
+	}
+
+	for _, variant := range []string{upload.AvatarKey, upload.CardKey, upload.FullKey} {
+		if err := deleteFile(ctx, variant); err != nil {
+			return err
+		}
+	}
+
+	return database.Db.Queries.DeleteUpload(ctx, upload.UploadID)
+}
+
+// imageUpload finds the upload behind a stored image key before a link is signed for it, failing with
+// errImageNotOwned unless allowed accepts its uploader. Keys from before the upload pipeline have no upload and are
+// bare IDs at the top of the bucket, so they can never name an export, an attachment or someone else's upload.
+func imageUpload(ctx context.Context, key string, allowed func(uploader *string) (bool, error)) (*sqlc.Upload, error) {
+	upload, err := database.Db.Queries.GetUploadByKey(ctx, key)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			if strings.Contains(key, "/") {
+				return nil, errImageNotOwned
+			}
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	ok, err := allowed(upload.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errImageNotOwned
+	}
+
+	return &upload, nil
+}
+
+// uploadedBy accepts uploads made by the user.
+func uploadedBy(userId string) func(uploader *string) (bool, error) {
+	return func(uploader *string) (bool, error) {
+		return uploader != nil && *uploader == userId, nil
+	}
+}
+
+// requireOwnedImage aborts with 400 unless an image key a client is storing is empty, unchanged from current, or the
+// full size of an image the user uploaded, so images can only point at the user's own uploads.
+func requireOwnedImage(c *gin.Context, userId string, key *string, current *string) bool {
+	if err := checkOwnedImage(c, userId, key, current); err != nil {
+		switch {
+		case errors.Is(err, errImageNotOwned):
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return false
+	}
+
+	return true
+}
+
+// checkOwnedImage is requireOwnedImage for callers that report errors themselves, failing with errImageNotOwned.
+func checkOwnedImage(ctx context.Context, userId string, key *string, current *string) error {
+	if key == nil || *key == "" || (current != nil && *current == *key) {
+		return nil
+	}
+
+	upload, err := database.Db.Queries.GetUploadByKey(ctx, *key)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errImageNotOwned
+		}
+		return err
+	}
+	if upload.UserID == nil || *upload.UserID != userId {
+		return errImageNotOwned
+	}
+
+	return nil
+}
+
+// imageVariantKey finds the key of one size of an image from the upload behind its full key. Images from before
+// the upload pipeline have no upload and only their original size, which is returned for every size.
+func imageVariantKey(upload *sqlc.Upload, key string, size string) (string, error) {
+	switch size {
+	case "", images.VariantFull:
+		return key, nil
+	case images.VariantAvatar, images.VariantCard:
+	default:
+		return "", errImageSize
+	}
+
+	if upload == nil {
+		return key, nil
+	}
+	if size == images.VariantAvatar {
+		return upload.AvatarKey, nil
+	}
+	return upload.CardKey, nil
+}
+
+// deleteFiles removes objects stored before a later step failed, leaving any it cannot remove behind.
+func deleteFiles(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		_ = deleteFile(ctx, key)
+	}
+}
+
+// respondImageURL answers with a short-lived signed link to the size of an image asked for in the size query, as
+// long as allowed accepts its uploader. The response may be cached privately for half the link's lifetime so a
+// cached link is never close to expiring.
+func respondImageURL(c *gin.Context, key string, allowed func(uploader *string) (bool, error)) {
+	upload, err := imageUpload(c, key, allowed)
+	if err != nil {
+		switch {
+		case errors.Is(err, errImageNotOwned):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "image not found"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	variant, err := imageVariantKey(upload, key, c.Query("size"))
+	if err != nil {
+		switch {
+		case errors.Is(err, errImageSize):
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	expiresAt := time.Now().Add(ImageURLExpiry)
+	url, err := storage.Default.URL(c, variant, storage.URLOptions{Expiry: ImageURLExpiry})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", int(ImageURLExpiry.Seconds()/2)))
+	c.JSON(http.StatusOK, gin.H{"url": url, "expires_at": expiresAt})
+}
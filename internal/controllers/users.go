@@ -6,14 +6,10 @@ import (
 	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"net/http"
 )
 
-type UploadLocalCalendarsParams struct {
-	Calendars []sqlc.CreateCalendarParams `json:"calendars"`
-	Events    []sqlc.CreateEventParams    `json:"events"`
-}
-
 // GetMe
 // @Summary Get details of the current user
 // @Description Fetches the user data for the currently authenticated user.
@@ -24,7 +20,7 @@ func GetMe(c *gin.Context) {
 
 // GetAllUsers
 // @Summary Lists all users in the database
-// @Description Debug route to see all users currently existing
+// @Description Debug route to see all users currently existing, including their emails, so it is limited to admins
 func GetAllUsers(c *gin.Context) {
 	users, err := database.Db.Queries.GetAllUsers(c)
 	if err != nil {
@@ -37,7 +33,7 @@ func GetAllUsers(c *gin.Context) {
 		return
 	}
 
-	c.PureJSON(http.StatusOK, users)
+	RespondList(c, users, ListOptions[sqlc.User]{Sorts: UserSorts, DefaultSort: "username"})
 }
 
 // GetUser
@@ -61,6 +57,10 @@ func GetUser(c *gin.Context) {
 		return
 	}
 
+	if user.HideEmail && user.UserID != ParseUser(c).UserID {
+		user.Email = ""
+	}
+
 	c.PureJSON(http.StatusOK, user)
 }
 
@@ -75,6 +75,10 @@ func UpdateUser(c *gin.Context) {
 
 	updateUserParams.UserID = user.UserID
 
+	if !requireOwnedImage(c, user.UserID, updateUserParams.ProfilePicture, user.ProfilePicture) {
+		return
+	}
+
 	user, err := database.Db.Queries.UpdateUser(c, updateUserParams)
 	if err != nil {
 		switch {
@@ -89,131 +93,110 @@ func UpdateUser(c *gin.Context) {
 	c.PureJSON(http.StatusOK, user)
 }
 
-func DeleteMe(c *gin.Context) {
+// PatchMe
+// @Summary Partially update the current user
+// @Description Applies a JSON Merge Patch to the current user's profile, leaving omitted fields untouched.
+func PatchMe(c *gin.Context) {
 	user := *ParseUser(c)
 	groups := *ParseGroups(c)
-	if err := database.Transaction(c, func(queries *sqlc.Queries) error {
-		for _, group := range groups {
-			groupMembers, err := queries.GetGroupMembers(c, group.GroupID)
-			if err != nil {
-				return err
-			}
-			if len(groupMembers) == 1 {
-				if err := queries.DeleteGroup(c, group.GroupID); err != nil {
-					return err
-				}
-			}
-		}
 
-		if err := database.Db.Queries.DeleteUser(c, user.UserID); err != nil {
-			switch {
-			case errors.Is(err, pgx.ErrNoRows):
-				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "user not found"})
-			default:
-				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			}
-			return nil
-		}
-
-		return nil
-	}); err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	patch, err := BindMergePatch(c, "email", "username", "name", "birthday", "default_calendar_id",
+		"default_calendar_enabled", "is_24_hour", "hide_email")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid input: " + err.Error()})
+		return
 	}
 
-	c.PureJSON(http.StatusOK, gin.H{"status": "deleted"})
-}
+	input, err := parseUserPatch(patch)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid input: " + err.Error()})
+		return
+	}
 
-func DeleteUser(c *gin.Context) {
-	userId := c.Param("user_id")
-	if err := database.Transaction(c, func(queries *sqlc.Queries) error {
-		if userId == "" {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
-			return nil
-		}
+	input.UserID = user.UserID
 
-		groups, err := queries.GetGroupsByUserId(c, userId)
+	if input.DefaultCalendarID != nil {
+		calendar, err := database.Db.Queries.GetCalendarById(c, *input.DefaultCalendarID)
 		if err != nil {
 			switch {
 			case errors.Is(err, pgx.ErrNoRows):
-				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "user not found"})
-				return nil
-			default:
-				return err
-			}
-		}
-
-		for _, group := range groups {
-			groupMembers, err := queries.GetGroupMembers(c, group.GroupID)
-			if err != nil {
-				return err
-			}
-			if len(groupMembers) == 1 {
-				if err := queries.DeleteGroup(c, group.GroupID); err != nil {
-					return err
-				}
-			}
-		}
-
-		if err := database.Db.Queries.DeleteUser(c, userId); err != nil {
-			switch {
-			case errors.Is(err, pgx.ErrNoRows):
-				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "user not found"})
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid input: default calendar not found"})
 			default:
 				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			}
-			return nil
+			return
 		}
 
-		return nil
-	}); err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if !CanEditCalendar(calendar, user.UserID, groups) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid input: default calendar must be editable"})
+			return
+		}
 	}
 
-	c.PureJSON(http.StatusOK, gin.H{"status": "deleted"})
-}
-
-func DeleteAllUsers(c *gin.Context) {
-	err := database.Db.Queries.DeleteAllUsers(c)
+	user, err = database.Db.Queries.PatchUser(c, input)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"status": "all users deleted successfully"})
+	c.PureJSON(http.StatusOK, user)
 }
 
-func UploadLocalCalendars(c *gin.Context) {
-	user := *ParseUser(c)
-	var input UploadLocalCalendarsParams
-	if err := c.BindJSON(&input); err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+func parseUserPatch(patch MergePatch) (sqlc.PatchUserParams, error) {
+	var input sqlc.PatchUserParams
+	var err error
+
+	if input.Email, err = PatchValue[string](patch, "email"); err != nil {
+		return input, err
+	}
+	if input.Username, err = PatchValue[string](patch, "username"); err != nil {
+		return input, err
+	}
+	if input.Name, input.SetName, err = PatchNullable[string](patch, "name"); err != nil {
+		return input, err
+	}
+	if input.DefaultCalendarID, input.SetDefaultCalendarID, err = PatchNullable[string](patch, "default_calendar_id"); err != nil {
+		return input, err
+	}
+	if input.DefaultCalendarEnabled, err = PatchValue[bool](patch, "default_calendar_enabled"); err != nil {
+		return input, err
+	}
+	if input.Is24Hour, err = PatchValue[bool](patch, "is_24_hour"); err != nil {
+		return input, err
+	}
+	if input.HideEmail, err = PatchValue[bool](patch, "hide_email"); err != nil {
+		return input, err
 	}
 
-	if err := database.Transaction(c, func(queries *sqlc.Queries) error {
-		// Calendars first
-		for _, createCalendarParams := range input.Calendars {
-			createCalendarParams.UserID = &user.UserID
-			if _, err := queries.CreateCalendar(c, createCalendarParams); err != nil {
-				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return err
-			}
-		}
+	birthday, set, err := PatchNullable[pgtype.Date](patch, "birthday")
+	if err != nil {
+		return input, err
+	}
+	if birthday != nil {
+		input.Birthday = *birthday
+	}
+	input.SetBirthday = set
 
-		// Then Events
-		for _, createEventParams := range input.Events {
-			if _, err := queries.CreateEvent(c, createEventParams); err != nil {
-				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return err
-			}
-		}
+	return input, errors.Join(
+		validateEmail(input.Email),
+		validateRequired("username", input.Username),
+	)
+}
 
-		c.JSON(http.StatusOK, gin.H{"message": "UploadLocalCalendars successful"})
-		return nil
-	}); err != nil {
+func DeleteAllUsers(c *gin.Context) {
+	err := database.Db.Queries.DeleteAllUsers(c)
+	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+
+	RecordAudit(c, AuditDeleteAllUsers, "", "", nil)
+	c.JSON(http.StatusOK, gin.H{"status": "all users deleted successfully"})
 }
 
 func ParseUser(c *gin.Context) *sqlc.User {
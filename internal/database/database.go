@@ -92,14 +92,26 @@ func Transaction(ctx context.Context, next TransactionFunc) error {
 		return err
 	}
 
-	defer func(transaction pgx.Tx, ctx context.Context) {}(transaction, ctx)
+	defer func(transaction pgx.Tx, ctx context.Context) {
+		_ = transaction.Rollback(ctx) // No-op once committed
+	}(transaction, ctx)
 	queries := Db.Queries.WithTx(transaction)
 
 	if err := next(queries); err != nil {
 		log.Println("could not execute transaction:", err)
-		return nil
+		return err
 	} else {
 		log.Println("executed transaction")
 		return transaction.Commit(ctx)
 	}
 }
+
+// TransactionAs runs a transaction on behalf of a user so history triggers can record who made each change.
+func TransactionAs(ctx context.Context, actorId string, next TransactionFunc) error {
+	return Transaction(ctx, func(queries *sqlc.Queries) error {
+		if err := queries.SetActor(ctx, actorId); err != nil {
+			return err
+		}
+		return next(queries)
+	})
+}
@@ -0,0 +1,162 @@
+package images
+
+import (
+	"bytes"
+	"errors"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // Register decoder
+	"image"
+	_ "image/gif" // Register decoder
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"slices"
+)
+
+const (
+	VariantAvatar = "avatar"
+	VariantCard   = "card"
+	VariantFull   = "full"
+
+	avatarSize = 256
+	cardSize   = 640
+	fullSize   = 2048
+	// maxPixels stops small files that decode into huge images from exhausting memory.
+	maxPixels   = 40_000_000
+	jpegQuality = 85
+)
+
+var (
+	ErrUnsupportedType = errors.New("file type must be JPEG, PNG, WEBP or GIF")
+	ErrTooManyPixels   = errors.New("image dimensions are too large")
+	ErrInvalidImage    = errors.New("file is not a valid image")
+)
+
+var supportedTypes = []string{"image/jpeg", "image/png", "image/webp", "image/gif"}
+
+// Variant is one re-encoded size of an uploaded image.
+type Variant struct {
+	Name   string
+	Data   []byte
+	Width  int
+	Height int
+}
+
+// Result holds every variant of an image. All variants share one content type: PNG for images with
+// transparency and JPEG otherwise.
+type Result struct {
+	ContentType string
+	Extension   string
+	Variants    []Variant
+}
+
+// Size is the total number of bytes across all variants.
+func (r Result) Size() int64 {
+	var size int64
+	for _, variant := range r.Variants {
+		size += int64(len(variant.Data))
+	}
+	return size
+}
+
+// Process checks what an uploaded file really is from its contents, then decodes and re-encodes it at the avatar,
+// card and full sizes. Re-encoding drops EXIF, GPS and any other metadata, after applying the EXIF orientation
+// so photos stay upright. Animated GIFs keep only their first frame.
+func Process(data []byte) (Result, error) {
+	if !slices.Contains(supportedTypes, http.DetectContentType(data)) {
+		return Result{}, ErrUnsupportedType
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Result{}, ErrInvalidImage
+	}
+	if config.Width*config.Height > maxPixels {
+		return Result{}, ErrTooManyPixels
+	}
+
+	source, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Result{}, ErrInvalidImage
+	}
+	if format == "jpeg" {
+		source = orient(source, exifOrientation(data))
+	}
+
+	result := Result{ContentType: "image/jpeg", Extension: "jpg"}
+	if !isOpaque(source) {
+		result.ContentType, result.Extension = "image/png", "png"
+	}
+
+	for _, variant := range []struct {
+		name string
+		img  image.Image
+	}{
+		{VariantAvatar, cropSquare(source, avatarSize)},
+		{VariantCard, fit(source, cardSize)},
+		{VariantFull, fit(source, fullSize)},
+	} {
+		var buffer bytes.Buffer
+		if result.ContentType == "image/png" {
+			err = png.Encode(&buffer, variant.img)
+		} else {
+			err = jpeg.Encode(&buffer, variant.img, &jpeg.Options{Quality: jpegQuality})
+		}
+		if err != nil {
+			return Result{}, err
+		}
+
+		bounds := variant.img.Bounds()
+		result.Variants = append(result.Variants, Variant{
+			Name:   variant.name,
+			Data:   buffer.Bytes(),
+			Width:  bounds.Dx(),
+			Height: bounds.Dy(),
+		})
+	}
+
+	return result, nil
+}
+
+// fit scales an image down so neither side is longer than size. Smaller images are only re-encoded.
+func fit(source image.Image, size int) image.Image {
+	bounds := source.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= size && height <= size {
+		return scale(source, bounds, width, height)
+	}
+
+	if width >= height {
+		height = max(1, height*size/width)
+		width = size
+	} else {
+		width = max(1, width*size/height)
+		height = size
+	}
+	return scale(source, bounds, width, height)
+}
+
+// cropSquare takes the largest centered square of an image and scales it to size, or smaller if the square is.
+func cropSquare(source image.Image, size int) image.Image {
+	bounds := source.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	x := bounds.Min.X + (bounds.Dx()-side)/2
+	y := bounds.Min.Y + (bounds.Dy()-side)/2
+	square := image.Rect(x, y, x+side, y+side)
+
+	size = min(size, side)
+	return scale(source, square, size, size)
+}
+
+func scale(source image.Image, from image.Rectangle, width int, height int) image.Image {
+	target := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(target, target.Bounds(), source, from, draw.Src, nil)
+	return target
+}
+
+func isOpaque(img image.Image) bool {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok {
+		return opaque.Opaque()
+	}
+	return false
+}
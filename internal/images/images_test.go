@@ -0,0 +1,276 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+var (
+	red  = color.NRGBA{R: 255, A: 255}
+	blue = color.NRGBA{B: 255, A: 255}
+)
+
+func solidImage(width int, height int, fill color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetNRGBA(x, y, fill)
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	if err := jpeg.Encode(&buffer, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+// withOrientation inserts an EXIF block carrying an orientation tag right after a JPEG's start of image marker.
+func withOrientation(data []byte, order binary.ByteOrder, orientation uint16) []byte {
+	tiff := make([]byte, 8+2+12+4)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)
+	order.PutUint16(tiff[10:], 0x0112) // Orientation
+	order.PutUint16(tiff[12:], 3)      // SHORT
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], orientation)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(segment)+2))
+	app1 = append(app1, segment...)
+
+	result := append([]byte{}, data[:2]...)
+	result = append(result, app1...)
+	return append(result, data[2:]...)
+}
+
+func variant(t *testing.T, result Result, name string) Variant {
+	t.Helper()
+
+	for _, v := range result.Variants {
+		if v.Name == name {
+			return v
+		}
+	}
+	t.Fatalf("no %s variant", name)
+	return Variant{}
+}
+
+func TestProcessSizes(t *testing.T) {
+	result, err := Process(encodePNG(t, solidImage(3000, 1500, red)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ContentType != "image/jpeg" || result.Extension != "jpg" {
+		t.Fatalf("opaque image stored as %s (.%s), want image/jpeg (.jpg)", result.ContentType, result.Extension)
+	}
+
+	tests := []struct {
+		name          string
+		width, height int
+	}{
+		{VariantAvatar, avatarSize, avatarSize},
+		{VariantCard, cardSize, cardSize / 2},
+		{VariantFull, fullSize, fullSize / 2},
+	}
+	var total int64
+	for _, test := range tests {
+		v := variant(t, result, test.name)
+		if v.Width != test.width || v.Height != test.height {
+			t.Errorf("%s = %dx%d, want %dx%d", test.name, v.Width, v.Height, test.width, test.height)
+		}
+		decoded, err := jpeg.DecodeConfig(bytes.NewReader(v.Data))
+		if err != nil {
+			t.Fatalf("%s is not a JPEG: %v", test.name, err)
+		}
+		if decoded.Width != v.Width || decoded.Height != v.Height {
+			t.Errorf("%s encoded as %dx%d, reported %dx%d", test.name, decoded.Width, decoded.Height, v.Width, v.Height)
+		}
+		total += int64(len(v.Data))
+	}
+	if result.Size() != total {
+		t.Errorf("Size = %d, want %d", result.Size(), total)
+	}
+}
+
+func TestProcessSmallImageNotUpscaled(t *testing.T) {
+	result, err := Process(encodePNG(t, solidImage(100, 50, red)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string][2]int{
+		VariantAvatar: {50, 50},
+		VariantCard:   {100, 50},
+		VariantFull:   {100, 50},
+	} {
+		v := variant(t, result, name)
+		if v.Width != want[0] || v.Height != want[1] {
+			t.Errorf("%s = %dx%d, want %dx%d", name, v.Width, v.Height, want[0], want[1])
+		}
+	}
+}
+
+func TestProcessKeepsTransparency(t *testing.T) {
+	img := solidImage(10, 10, red)
+	img.SetNRGBA(0, 0, color.NRGBA{})
+
+	result, err := Process(encodePNG(t, img))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ContentType != "image/png" || result.Extension != "png" {
+		t.Fatalf("transparent image stored as %s (.%s), want image/png (.png)", result.ContentType, result.Extension)
+	}
+	if _, err := png.Decode(bytes.NewReader(variant(t, result, VariantFull).Data)); err != nil {
+		t.Fatalf("full size is not a PNG: %v", err)
+	}
+}
+
+func TestProcessRejects(t *testing.T) {
+	valid := encodePNG(t, solidImage(4, 4, red))
+
+	// A PNG header claiming more pixels than allowed, with its checksum fixed up so only the size is wrong
+	huge := append([]byte{}, valid...)
+	binary.BigEndian.PutUint32(huge[16:], 10_000)
+	binary.BigEndian.PutUint32(huge[20:], 10_000)
+	binary.BigEndian.PutUint32(huge[29:], crc32.ChecksumIEEE(huge[12:29]))
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"text", []byte("hello, this is not an image"), ErrUnsupportedType},
+		{"svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), ErrUnsupportedType},
+		{"pdf", []byte("%PDF-1.7\n"), ErrUnsupportedType},
+		{"truncated png", valid[:20], ErrInvalidImage},
+		{"too many pixels", huge, ErrTooManyPixels},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Process(test.data); !errors.Is(err, test.want) {
+				t.Fatalf("Process error = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestProcessAppliesOrientation(t *testing.T) {
+	source := encodeJPEG(t, solidImage(400, 200, red))
+
+	tests := []struct {
+		orientation   uint16
+		width, height int
+	}{
+		{1, 400, 200},
+		{3, 400, 200},
+		{6, 200, 400},
+		{8, 200, 400},
+	}
+	for _, test := range tests {
+		result, err := Process(withOrientation(source, binary.BigEndian, test.orientation))
+		if err != nil {
+			t.Fatal(err)
+		}
+		full := variant(t, result, VariantFull)
+		if full.Width != test.width || full.Height != test.height {
+			t.Errorf("orientation %d: full = %dx%d, want %dx%d", test.orientation, full.Width, full.Height, test.width, test.height)
+		}
+		if exifOrientation(full.Data) != 1 {
+			t.Errorf("orientation %d: EXIF kept after re-encoding", test.orientation)
+		}
+	}
+}
+
+func TestExifOrientation(t *testing.T) {
+	source := encodeJPEG(t, solidImage(8, 8, red))
+
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"no exif", source, 1},
+		{"big endian", withOrientation(source, binary.BigEndian, 6), 6},
+		{"little endian", withOrientation(source, binary.LittleEndian, 8), 8},
+		{"out of range", withOrientation(source, binary.BigEndian, 9), 1},
+		{"zero", withOrientation(source, binary.BigEndian, 0), 1},
+		{"not a jpeg", encodePNG(t, solidImage(2, 2, red)), 1},
+		{"empty", nil, 1},
+		{"truncated", withOrientation(source, binary.BigEndian, 6)[:20], 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := exifOrientation(test.data); got != test.want {
+				t.Fatalf("exifOrientation = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// Red on the left, blue on the right
+	source := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	source.SetNRGBA(0, 0, red)
+	source.SetNRGBA(1, 0, blue)
+
+	tests := []struct {
+		orientation int
+		// want lists the upright pixels row by row
+		want [][]color.NRGBA
+	}{
+		{1, [][]color.NRGBA{{red, blue}}},
+		{2, [][]color.NRGBA{{blue, red}}},
+		{3, [][]color.NRGBA{{blue, red}}},
+		{4, [][]color.NRGBA{{red, blue}}},
+		{5, [][]color.NRGBA{{red}, {blue}}},
+		{6, [][]color.NRGBA{{red}, {blue}}},
+		{7, [][]color.NRGBA{{blue}, {red}}},
+		{8, [][]color.NRGBA{{blue}, {red}}},
+	}
+	for _, test := range tests {
+		oriented := orient(source, test.orientation)
+		bounds := oriented.Bounds()
+		if bounds.Dy() != len(test.want) || bounds.Dx() != len(test.want[0]) {
+			t.Errorf("orientation %d: %dx%d, want %dx%d", test.orientation, bounds.Dx(), bounds.Dy(), len(test.want[0]), len(test.want))
+			continue
+		}
+		for y, row := range test.want {
+			for x, want := range row {
+				if got := color.NRGBAModel.Convert(oriented.At(bounds.Min.X+x, bounds.Min.Y+y)); got != want {
+					t.Errorf("orientation %d: pixel (%d, %d) = %v, want %v", test.orientation, x, y, got, want)
+				}
+			}
+		}
+	}
+}
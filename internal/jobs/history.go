@@ -0,0 +1,15 @@
+package jobs
+
+import (
+	"calenduh-backend/internal/database"
+	"context"
+	"time"
+)
+
+// RevisionRetention is how long event and calendar history is kept and can be restored.
+const RevisionRetention = 30 * 24 * time.Hour
+
+// PurgeRevisions deletes history that has outlived RevisionRetention.
+func PurgeRevisions(ctx context.Context) error {
+	return database.Db.Queries.PurgeRevisions(ctx, time.Now().Add(-RevisionRetention))
+}
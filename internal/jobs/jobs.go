@@ -0,0 +1,24 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+type JobFunc func(ctx context.Context) error
+
+// Schedule runs a job once immediately and then again every interval in the background.
+func Schedule(name string, interval time.Duration, job JobFunc) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := job(context.Background()); err != nil {
+				log.Printf("job %s failed: %s\n", name, err.Error())
+			}
+			<-ticker.C
+		}
+	}()
+}
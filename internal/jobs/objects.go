@@ -0,0 +1,126 @@
+package jobs
+
+import (
+	"calenduh-backend/internal/database"
+	"calenduh-backend/internal/storage"
+	"context"
+	"log"
+	"time"
+)
+
+// OrphanGracePeriod is how old an unreferenced object must be before it is collected, so files uploaded ahead of
+// the request that references them survive. Configured with ORPHAN_GRACE_HOURS.
+var OrphanGracePeriod = 24 * time.Hour
+
+// OrphanedObject is a stored object that no row references.
+type OrphanedObject struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// OrphanReport describes one pass of the orphaned object collector.
+type OrphanReport struct {
+	DryRun bool `json:"dry_run"`
+	// Scanned counts every stored object, and Recent the unreferenced ones still inside the grace period.
+	Scanned  int              `json:"scanned"`
+	Recent   int              `json:"recent"`
+	Orphaned []OrphanedObject `json:"orphaned"`
+	// Deleted and BytesFreed stay zero on a dry run.
+	Deleted    int      `json:"deleted"`
+	BytesFreed int64    `json:"bytes_freed"`
+	Failed     []string `json:"failed"`
+}
+
+// CollectOrphanedObjects deletes stored objects that nothing references anymore.
+func CollectOrphanedObjects(ctx context.Context) error {
+	report, err := FindOrphanedObjects(ctx, false)
+	if err != nil {
+		return err
+	}
+
+	if report.Deleted > 0 || len(report.Failed) > 0 {
+		log.Printf("collected %d orphaned objects (%d bytes), %d failed\n", report.Deleted, report.BytesFreed, len(report.Failed))
+	}
+	return nil
+}
+
+// FindOrphanedObjects lists every stored object and compares it against the keys rows reference, deleting the
+// unreferenced ones older than OrphanGracePeriod unless dryRun is set.
+func FindOrphanedObjects(ctx context.Context, dryRun bool) (OrphanReport, error) {
+	report := OrphanReport{
+		DryRun:   dryRun,
+		Orphaned: make([]OrphanedObject, 0),
+		Failed:   make([]string, 0),
+	}
+	cutoff := time.Now().Add(-OrphanGracePeriod)
+
+	// Objects are listed before references are read, so anything referenced while listing is still seen as referenced
+	objects := make([]storage.Object, 0)
+	if err := storage.Default.List(ctx, func(object storage.Object) error {
+		objects = append(objects, object)
+		return nil
+	}); err != nil {
+		return report, err
+	}
+	report.Scanned = len(objects)
+
+	keys, err := database.Db.Queries.GetReferencedObjectKeys(ctx)
+	if err != nil {
+		return report, err
+	}
+	referenced := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		referenced[key] = true
+	}
+
+	// Rows reference the full size of an upload, which keeps its other sizes
+	uploads, err := database.Db.Queries.GetUploads(ctx)
+	if err != nil {
+		return report, err
+	}
+	fullKeys := make(map[string]bool, len(uploads))
+	for _, upload := range uploads {
+		fullKeys[upload.FullKey] = true
+		if referenced[upload.FullKey] {
+			referenced[upload.AvatarKey] = true
+			referenced[upload.CardKey] = true
+		}
+	}
+
+	for _, object := range objects {
+		if referenced[object.Key] {
+			continue
+		}
+		if object.LastModified.After(cutoff) {
+			report.Recent++
+			continue
+		}
+
+		report.Orphaned = append(report.Orphaned, OrphanedObject{
+			Key:          object.Key,
+			Size:         object.Size,
+			LastModified: object.LastModified,
+		})
+		if dryRun {
+			continue
+		}
+
+		if err := storage.Default.Delete(ctx, object.Key); err != nil {
+			log.Printf("unable to delete orphaned object %s: %s\n", object.Key, err.Error())
+			report.Failed = append(report.Failed, object.Key)
+			continue
+		}
+		report.Deleted++
+		report.BytesFreed += object.Size
+
+		// Its other sizes are unreferenced too, so the upload row goes with the full size
+		if fullKeys[object.Key] {
+			if err := database.Db.Queries.DeleteUploadByKey(ctx, object.Key); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	return report, nil
+}
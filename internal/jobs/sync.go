@@ -0,0 +1,16 @@
+package jobs
+
+import (
+	"calenduh-backend/internal/database"
+	"context"
+	"time"
+)
+
+// TombstoneRetention is how long deletions are kept for sync clients.
+// Sync tokens older than this are rejected and the client must resync from scratch.
+const TombstoneRetention = 30 * 24 * time.Hour
+
+// PurgeTombstones deletes tombstones that have outlived TombstoneRetention.
+func PurgeTombstones(ctx context.Context) error {
+	return database.Db.Queries.PurgeTombstones(ctx, time.Now().Add(-TombstoneRetention))
+}
@@ -0,0 +1,27 @@
+package jobs
+
+import (
+	"calenduh-backend/internal/database"
+	"calenduh-backend/internal/sqlc"
+	"context"
+	"time"
+)
+
+// TrashRetention is how long trashed calendars, events and groups can be restored before they are purged.
+// Configured with TRASH_RETENTION_DAYS.
+var TrashRetention = 30 * 24 * time.Hour
+
+// PurgeTrash permanently deletes anything that has been in the trash longer than TrashRetention.
+func PurgeTrash(ctx context.Context) error {
+	before := time.Now().Add(-TrashRetention)
+	return database.Transaction(ctx, func(queries *sqlc.Queries) error {
+		// Groups first so their calendars and events go with them in a single cascade
+		if err := queries.PurgeTrashedGroups(ctx, before); err != nil {
+			return err
+		}
+		if err := queries.PurgeTrashedCalendars(ctx, before); err != nil {
+			return err
+		}
+		return queries.PurgeTrashedEvents(ctx, before)
+	})
+}
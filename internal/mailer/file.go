@@ -0,0 +1,26 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// File writes every message to its own .eml file in Dir instead of sending it, for local development.
+type File struct {
+	From string
+	Dir  string
+}
+
+func (m File) Send(ctx context.Context, message Message) error {
+	id, err := gonanoid.New()
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405"), id)
+	return os.WriteFile(filepath.Join(m.Dir, name), format(m.From, message), 0o644)
+}
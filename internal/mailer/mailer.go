@@ -0,0 +1,86 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// Message is a plain text email to a single recipient.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers email. Implementations must be safe to use from several goroutines.
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// Default is the mailer used by the controllers. It discards mail until main configures one.
+var Default Mailer = Discard{}
+
+// New creates the mailer for a MAIL_DRIVER value: "smtp" for real delivery, "console" to log messages, "file" to
+// write them to MAIL_DIR, or "" to discard them.
+func New(driver string) (Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "Calenduh <no-reply@calenduh.local>"
+	}
+
+	switch strings.ToLower(driver) {
+	case "", "none":
+		return Discard{}, nil
+	case "console":
+		return Console{From: from}, nil
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+		return File{From: from, Dir: dir}, nil
+	case "smtp":
+		return newSMTP(from)
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", driver)
+	}
+}
+
+// Discard drops every message.
+type Discard struct{}
+
+func (Discard) Send(ctx context.Context, message Message) error {
+	return nil
+}
+
+// Console logs every message instead of sending it, for local development.
+type Console struct {
+	From string
+}
+
+func (m Console) Send(ctx context.Context, message Message) error {
+	log.Printf("mail from %s to %s: %s\n%s\n", m.From, message.To, message.Subject, message.Body)
+	return nil
+}
+
+// headerValue keeps user supplied text such as group names from starting new headers.
+var headerValue = strings.NewReplacer("\r", " ", "\n", " ")
+
+// format renders a message as an RFC 5322 email.
+func format(from string, message Message) []byte {
+	var builder strings.Builder
+	builder.WriteString("From: " + headerValue.Replace(from) + "\r\n")
+	builder.WriteString("To: " + headerValue.Replace(message.To) + "\r\n")
+	builder.WriteString("Subject: " + headerValue.Replace(message.Subject) + "\r\n")
+	builder.WriteString("MIME-Version: 1.0\r\n")
+	builder.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	builder.WriteString("\r\n")
+	builder.WriteString(strings.ReplaceAll(message.Body, "\n", "\r\n"))
+	return []byte(builder.String())
+}
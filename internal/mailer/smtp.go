@@ -0,0 +1,51 @@
+package mailer
+
+import (
+	"calenduh-backend/internal/util"
+	"context"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strconv"
+)
+
+// SMTP sends messages through an SMTP server, authenticating when a username is set.
+type SMTP struct {
+	From     string
+	Address  string
+	Username string
+	Password string
+}
+
+func newSMTP(from string) (SMTP, error) {
+	host := util.GetEnv("SMTP_HOST")
+	port := util.GetEnvInt("SMTP_PORT", 587)
+
+	return SMTP{
+		From:     from,
+		Address:  net.JoinHostPort(host, strconv.Itoa(port)),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+	}, nil
+}
+
+func (m SMTP) Send(ctx context.Context, message Message) error {
+	sender, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, _ := net.SplitHostPort(m.Address)
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+
+	// net/smtp has no context support, so a cancelled context only stops messages that have not started sending
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return smtp.SendMail(m.Address, auth, sender.Address, []string{message.To}, format(m.From, message))
+}
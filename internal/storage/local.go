@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Local stores objects as files under a directory, for development and tests.
+type Local struct {
+	dir string
+	// publicURL is where the directory is served from, such as a static file server. Links made without it
+	// point straight at the file on disk.
+	publicURL string
+}
+
+func NewLocal(dir string, publicURL string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	absolute, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Local{dir: absolute, publicURL: strings.TrimSuffix(publicURL, "/")}, nil
+}
+
+func (l *Local) Put(ctx context.Context, key string, body io.ReadSeeker, contentType string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so readers never see a partial object
+	file, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := io.Copy(file, body); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
+
+func (l *Local) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return file, err
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// List walks the storage directory, skipping uploads that are still being written.
+func (l *Local) List(ctx context.Context, fn func(Object) error) error {
+	return filepath.WalkDir(l.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".upload-") {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		key, err := filepath.Rel(l.dir, path)
+		if err != nil {
+			return err
+		}
+
+		return fn(Object{
+			Key:          filepath.ToSlash(key),
+			Size:         info.Size(),
+			LastModified: info.ModTime(),
+		})
+	})
+}
+
+// URL links to the object under publicURL. Local storage cannot sign links, so Expiry and Filename are ignored.
+func (l *Local) URL(ctx context.Context, key string, options URLOptions) (string, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return "", err
+	}
+
+	if l.publicURL == "" {
+		return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String(), nil
+	}
+
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return l.publicURL + "/" + strings.Join(segments, "/"), nil
+}
+
+// path maps a key to a file inside the storage directory, rejecting keys that would escape it or name the directory
+// itself, which fs.ValidPath allows as ".".
+func (l *Local) path(key string) (string, error) {
+	if key == "" || key == "." || !fs.ValidPath(key) {
+		return "", errors.New("invalid object key")
+	}
+	return filepath.Join(l.dir, filepath.FromSlash(key)), nil
+}
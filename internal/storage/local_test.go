@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func newTestLocal(t *testing.T) *Local {
+	t.Helper()
+
+	local, err := NewLocal(filepath.Join(t.TempDir(), "storage"), "https://files.example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return local
+}
+
+func TestLocalRejectsInvalidKeys(t *testing.T) {
+	local := newTestLocal(t)
+	ctx := context.Background()
+
+	// A file next to the storage directory that traversal would reach
+	outside := filepath.Join(filepath.Dir(local.dir), "secret")
+	if err := os.WriteFile(outside, []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := []string{
+		"",
+		"../secret",
+		"uploads/../../secret",
+		"/etc/passwd",
+		"uploads/./a.png",
+		"uploads//a.png",
+		"uploads/",
+		".",
+		"..",
+	}
+	for _, key := range keys {
+		t.Run(key, func(t *testing.T) {
+			if err := local.Put(ctx, key, strings.NewReader("x"), "text/plain"); err == nil {
+				t.Errorf("Put(%q) succeeded", key)
+			}
+			if _, err := local.Get(ctx, key); err == nil || errors.Is(err, ErrNotFound) {
+				t.Errorf("Get(%q) error = %v, want an invalid key error", key, err)
+			}
+			if err := local.Delete(ctx, key); err == nil {
+				t.Errorf("Delete(%q) succeeded", key)
+			}
+			if _, err := local.URL(ctx, key, URLOptions{}); err == nil {
+				t.Errorf("URL(%q) succeeded", key)
+			}
+		})
+	}
+
+	if data, err := os.ReadFile(outside); err != nil || string(data) != "secret" {
+		t.Fatalf("file outside the storage directory changed: %q, %v", data, err)
+	}
+}
+
+func TestLocalPutGetDelete(t *testing.T) {
+	local := newTestLocal(t)
+	ctx := context.Background()
+
+	if err := local.Put(ctx, "uploads/a/full.png", strings.NewReader("image"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := local.Get(ctx, "uploads/a/full.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(reader)
+	_ = reader.Close()
+	if err != nil || string(data) != "image" {
+		t.Fatalf("Get = %q, %v, want %q", data, err, "image")
+	}
+
+	if err := local.Delete(ctx, "uploads/a/full.png"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := local.Get(ctx, "uploads/a/full.png"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after Delete error = %v, want %v", err, ErrNotFound)
+	}
+
+	// Deleting again is not an error
+	if err := local.Delete(ctx, "uploads/a/full.png"); err != nil {
+		t.Fatalf("second Delete error = %v", err)
+	}
+}
+
+func TestLocalList(t *testing.T) {
+	local := newTestLocal(t)
+	ctx := context.Background()
+
+	for _, key := range []string{"a.png", "uploads/b/full.png", "exports/user/c.zip"} {
+		if err := local.Put(ctx, key, strings.NewReader(key), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// An upload still being written is not listed
+	if err := os.WriteFile(filepath.Join(local.dir, "uploads", ".upload-123"), []byte("partial"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var keys []string
+	if err := local.List(ctx, func(object Object) error {
+		if object.Size != int64(len(object.Key)) {
+			t.Errorf("%s size = %d, want %d", object.Key, object.Size, len(object.Key))
+		}
+		keys = append(keys, object.Key)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	slices.Sort(keys)
+	want := []string{"a.png", "exports/user/c.zip", "uploads/b/full.png"}
+	if !slices.Equal(keys, want) {
+		t.Fatalf("List = %v, want %v", keys, want)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	if err := local.List(ctx, func(Object) error {
+		calls++
+		return stop
+	}); !errors.Is(err, stop) || calls != 1 {
+		t.Fatalf("List error = %v after %d calls, want %v after 1", err, calls, stop)
+	}
+}
+
+func TestLocalURL(t *testing.T) {
+	local := newTestLocal(t)
+
+	url, err := local.URL(context.Background(), "uploads/a b/full.png", URLOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "https://files.example.com/uploads/a%20b/full.png"; url != want {
+		t.Fatalf("URL = %q, want %q", url, want)
+	}
+}
+
+func TestS3StandardPrefixes(t *testing.T) {
+	s := &S3{config: S3Config{StorageClass: "GLACIER_IR", StandardPrefixes: standardPrefixes}}
+
+	tests := map[string]bool{
+		"exports/user/export.zip": true,
+		"uploads/a/full.png":      false,
+		"attachments/a.pdf":       false,
+		"legacy-id":               false,
+	}
+	for key, want := range tests {
+		if got := s.standard(key); got != want {
+			t.Errorf("standard(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"io"
+	"strings"
+)
+
+// S3Config configures an S3 bucket. Credentials and region come from the usual AWS environment variables.
+type S3Config struct {
+	Bucket string
+	// Endpoint points the client at an S3-compatible server such as MinIO instead of AWS.
+	Endpoint string
+	// ForcePathStyle addresses objects as endpoint/bucket/key, which most S3-compatible servers need.
+	ForcePathStyle bool
+	// StorageClass is set on every upload when not empty.
+	StorageClass string
+	// StandardPrefixes are key prefixes kept in the default STANDARD class instead, for objects that are short-lived
+	// or read back soon after they are written.
+	StandardPrefixes []string
+}
+
+// S3 stores objects in an S3 or S3-compatible bucket.
+type S3 struct {
+	client *s3.S3
+	config S3Config
+}
+
+func NewS3(config S3Config) (*S3, error) {
+	if config.Bucket == "" {
+		return nil, errors.New("AWS_BUCKET is required for S3 storage")
+	}
+
+	awsConfig := aws.NewConfig()
+	if config.Endpoint != "" {
+		awsConfig = awsConfig.WithEndpoint(config.Endpoint)
+	}
+	if config.ForcePathStyle {
+		awsConfig = awsConfig.WithS3ForcePathStyle(true)
+	}
+
+	sess, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3{client: s3.New(sess), config: config}, nil
+}
+
+func (s *S3) Put(ctx context.Context, key string, body io.ReadSeeker, contentType string) error {
+	input := &s3.PutObjectInput{
+		Body:   body,
+		Bucket: aws.String(s.config.Bucket),
+		Key:    aws.String(key),
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+	if s.config.StorageClass != "" && !s.standard(key) {
+		input.StorageClass = aws.String(s.config.StorageClass)
+	}
+
+	_, err := s.client.PutObjectWithContext(ctx, input)
+	return err
+}
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	object, err := s.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.config.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var awsErr awserr.Error
+		if errors.As(err, &awsErr) && awsErr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return object.Body, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.config.Bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+func (s *S3) List(ctx context.Context, fn func(Object) error) error {
+	var fnErr error
+	err := s.client.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.config.Bucket),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			fnErr = fn(Object{
+				Key:          aws.StringValue(object.Key),
+				Size:         aws.Int64Value(object.Size),
+				LastModified: aws.TimeValue(object.LastModified),
+			})
+			if fnErr != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if fnErr != nil {
+		return fnErr
+	}
+	return err
+}
+
+func (s *S3) URL(ctx context.Context, key string, options URLOptions) (string, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.config.Bucket),
+		Key:    aws.String(key),
+	}
+	if options.Filename != "" {
+		input.ResponseContentDisposition = aws.String(fmt.Sprintf("attachment; filename=%q", options.Filename))
+	}
+
+	request, _ := s.client.GetObjectRequest(input)
+	request.SetContext(ctx)
+	if options.Expiry > 0 {
+		return request.Presign(options.Expiry)
+	}
+
+	if err := request.Build(); err != nil {
+		return "", err
+	}
+	return request.HTTPRequest.URL.String(), nil
+}
+
+func (s *S3) standard(key string) bool {
+	for _, prefix := range s.config.StandardPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
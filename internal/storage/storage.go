@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned by Get when no object is stored under the key.
+var ErrNotFound = errors.New("object not found")
+
+// URLOptions controls the link URL returns for an object.
+type URLOptions struct {
+	// Expiry is how long a signed link stays valid. Zero returns the object's plain URL, which only works for
+	// objects the backend serves publicly.
+	Expiry time.Duration
+	// Filename makes browsers download the object under this name instead of displaying it.
+	Filename string
+}
+
+// Object describes a stored object as listed by List.
+type Object struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// Storage keeps uploaded files and generated archives under string keys, which may contain slashes.
+type Storage interface {
+	Put(ctx context.Context, key string, body io.ReadSeeker, contentType string) error
+	// Get opens an object for reading. The caller must close it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes an object. Deleting a key that does not exist is not an error.
+	Delete(ctx context.Context, key string) error
+	URL(ctx context.Context, key string, options URLOptions) (string, error)
+	// List calls fn for every stored object, stopping at the first error fn returns.
+	List(ctx context.Context, fn func(Object) error) error
+}
+
+// standardPrefixes keep data exports out of STORAGE_CLASS. They are downloaded within days and then deleted, which
+// infrequent access classes such as GLACIER_IR would charge extra retrieval fees and a minimum storage duration for.
+var standardPrefixes = []string{"exports/"}
+
+// Default is the storage used by the controllers, set by main from STORAGE_DRIVER.
+var Default Storage
+
+// New creates the storage for a STORAGE_DRIVER value: "s3" for AWS, "minio" for an S3-compatible server at
+// S3_ENDPOINT, or "local" for a directory on disk. An empty driver means "s3".
+func New(driver string) (Storage, error) {
+	switch strings.ToLower(driver) {
+	case "", "s3":
+		return NewS3(S3Config{
+			Bucket:           os.Getenv("AWS_BUCKET"),
+			StorageClass:     envOr("STORAGE_CLASS", "GLACIER_IR"),
+			StandardPrefixes: standardPrefixes,
+		})
+	case "minio":
+		return NewS3(S3Config{
+			Bucket:           os.Getenv("AWS_BUCKET"),
+			Endpoint:         os.Getenv("S3_ENDPOINT"),
+			ForcePathStyle:   true,
+			StorageClass:     os.Getenv("STORAGE_CLASS"),
+			StandardPrefixes: standardPrefixes,
+		})
+	case "local":
+		return NewLocal(envOr("STORAGE_DIR", "storage"), os.Getenv("STORAGE_PUBLIC_URL"))
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", driver)
+	}
+}
+
+func envOr(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -1,50 +1,49 @@
 package util
 
 import (
-	"bytes"
-	"encoding/gob"
-	"github.com/patrickmn/go-cache"
-	"log"
-	"os"
+	"calenduh-backend/internal/cache"
+	"context"
 	"time"
 )
 
-var CachePath = "/var/lib/cache/"
-var Nonces = CreateCache(5*time.Minute, time.Minute, "nonces")
-var DailyUsers = CreateCache(24*time.Hour, time.Minute, "daily")
-var ActiveUsers = CreateCache(15*time.Minute, time.Minute, "active")
-var WebCalendars = CreateCache(1*time.Hour, time.Minute, "web-calendars")
+// Caches shared by every instance when the cache backend is Redis. main opens them with OpenCaches.
+var (
+	Nonces       cache.Cache
+	DailyUsers   cache.Cache
+	ActiveUsers  cache.Cache
+	WebCalendars cache.Cache
+	// InvalidSessions holds the IP addresses that recently sent an unknown session, so each is audited once.
+	InvalidSessions cache.Cache
+)
 
-func CreateCache(defaultExpiration time.Duration, cleanupInterval time.Duration, name string) *cache.Cache {
-	file, err := os.ReadFile(CachePath + name)
-	if err != nil {
-		//log.Printf("Unable to read %s cache from file: \n%s", name, err.Error())
-		return cache.New(defaultExpiration, cleanupInterval)
-	}
+// OpenCaches opens the shared caches on a backend.
+func OpenCaches(backend cache.Backend) {
+	Nonces = backend.Open("nonces", 5*time.Minute)
+	DailyUsers = backend.Open("daily", 24*time.Hour)
+	ActiveUsers = backend.Open("active", 15*time.Minute)
+	WebCalendars = backend.Open("web-calendars", 1*time.Hour)
+	InvalidSessions = backend.Open("invalid-sessions", 15*time.Minute)
+}
 
-	values := make(map[string]cache.Item)
-	decoder := gob.NewDecoder(bytes.NewBuffer(file))
-	if err := decoder.Decode(&values); err != nil {
-		//log.Printf("Unable to decode %s cache: \n%s", name, err.Error())
-		return cache.New(defaultExpiration, cleanupInterval)
+// TrackUser records that a user was just seen, for presence and the active and daily user counts.
+func TrackUser(ctx context.Context, userId string) error {
+	now := time.Now().Format(time.RFC3339Nano)
+	if err := ActiveUsers.Set(ctx, userId, now); err != nil {
+		return err
 	}
-
-	return cache.NewFrom(defaultExpiration, cleanupInterval, values)
+	return DailyUsers.Set(ctx, userId, now)
 }
 
-func SaveCache(c *cache.Cache, name string) {
-	var buf bytes.Buffer
-	encoder := gob.NewEncoder(&buf)
-
-	if err := encoder.Encode(c.Items()); err != nil {
-		log.Printf("Unable to save %s cache: \n%s", name, err.Error())
+// LastSeen reports when a user was last seen, if within the last fifteen minutes.
+func LastSeen(ctx context.Context, userId string) (time.Time, bool, error) {
+	value, found, err := ActiveUsers.Get(ctx, userId)
+	if err != nil || !found {
+		return time.Time{}, false, err
 	}
 
-	if err := os.WriteFile(CachePath+name, buf.Bytes(), os.ModePerm); err != nil {
-		log.Printf("Unable to save %s cache: \n%s", name, err.Error())
+	seen, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, false, nil
 	}
-
-	log.Printf("Saved %s cache\n", name)
-
-	return
+	return seen, true, nil
 }
@@ -1,10 +1,9 @@
 package util
 
 import (
+	_ "embed"
 	"encoding/xml"
-	"io"
 	"log"
-	"os"
 	"strings"
 )
 
@@ -26,6 +25,12 @@ type MapZone struct {
 	Type      string `xml:"type,attr"`
 }
 
+// timezonesXML maps Windows timezone names to IANA ones. It is built in so the binary does not depend on the
+// directory it runs from.
+//
+//go:embed timezones.xml
+var timezonesXML []byte
+
 var Timezones map[string]string
 
 func GetTimezone(tz string) string {
@@ -33,24 +38,8 @@ func GetTimezone(tz string) string {
 }
 
 func init() {
-	xmlFile, err := os.Open("timezones.xml")
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer func(xmlFile *os.File) {
-		err := xmlFile.Close()
-		if err != nil {
-			log.Fatal(err)
-		}
-	}(xmlFile)
-
-	data, err := io.ReadAll(xmlFile)
-	if err != nil {
-		log.Fatal(err)
-	}
-
 	var supplementalData SupplementalData
-	if err = xml.Unmarshal(data, &supplementalData); err != nil {
+	if err := xml.Unmarshal(timezonesXML, &supplementalData); err != nil {
 		log.Fatal(err)
 	}
 
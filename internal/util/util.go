@@ -1,14 +1,15 @@
 package util
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"github.com/JGLTechnologies/gin-rate-limit"
 	"github.com/gin-gonic/gin"
-	"github.com/patrickmn/go-cache"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 )
 
@@ -20,6 +21,20 @@ func GetEnv(key string) string {
 	return value
 }
 
+// GetEnvInt reads an optional integer environment variable, using fallback when it is unset.
+func GetEnvInt(key string, fallback int) int {
+	value, found := os.LookupEnv(key)
+	if !found || value == "" {
+		return fallback
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatal("Invalid integer for environment variable: " + key)
+	}
+	return number
+}
+
 func GetHash(value string) string {
 	hash := sha256.New()
 	hash.Write([]byte(value))
@@ -27,19 +42,23 @@ func GetHash(value string) string {
 }
 
 // CreateNonce creates an ID and time-based nonce for login requests.
-func CreateNonce(state string, redirectUri string) string {
-	Nonces.Set(state, redirectUri, cache.DefaultExpiration)
-	return state
+func CreateNonce(ctx context.Context, state string, redirectUri string) (string, error) {
+	if err := Nonces.Set(ctx, state, redirectUri); err != nil {
+		return "", err
+	}
+	return state, nil
 }
 
-// ValidateNonce determines whether a provided nonce is valid for the login requests.
-func ValidateNonce(code string) (bool, *string) {
-	v, found := Nonces.Get(code)
+// ValidateNonce determines whether a provided nonce is valid for the login requests. Each nonce is only valid once.
+func ValidateNonce(ctx context.Context, code string) (bool, *string) {
+	redirectUri, found, err := Nonces.Take(ctx, code)
+	if err != nil {
+		log.Printf("unable to validate nonce: %s\n", err.Error())
+		return false, nil
+	}
 	if !found {
 		return false, nil
 	}
-	Nonces.Delete(code)
-	redirectUri := v.(string)
 	return true, &redirectUri
 }
 
@@ -52,8 +71,14 @@ func GetProtocol(c *gin.Context) string {
 	}
 }
 
+// HandleRateLimit answers a rate limited request, telling the client in Retry-After how many seconds to wait.
 func HandleRateLimit(c *gin.Context, info ratelimit.Info) {
-	c.String(http.StatusTooManyRequests, "Too many requests. Try again in "+time.Until(info.ResetTime).Round(time.Second).String())
+	wait := time.Until(info.ResetTime).Round(time.Second)
+	if wait < time.Second {
+		wait = time.Second
+	}
+	c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())))
+	c.String(http.StatusTooManyRequests, "Too many requests. Try again in "+wait.String())
 }
 
 func TimeToMidnightEST() time.Duration {
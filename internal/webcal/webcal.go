@@ -0,0 +1,171 @@
+package webcal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	ics "github.com/arran4/golang-ical"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// MaxBytes is the largest calendar Fetch downloads.
+	MaxBytes     = 10 << 20
+	maxRedirects = 5
+	fetchTimeout = 15 * time.Second
+	userAgent    = "Calenduh/1.0 (calendar subscription fetcher)"
+)
+
+var (
+	ErrInvalidURL       = errors.New("calendar url must be an http, https or webcal url with a host")
+	ErrBlockedAddress   = errors.New("calendar url points to an address that is not publicly reachable")
+	ErrTooLarge         = fmt.Errorf("calendar is larger than %d MB", MaxBytes>>20)
+	ErrTooManyRedirects = fmt.Errorf("calendar url redirected more than %d times", maxRedirects)
+)
+
+// blockedPrefixes are ranges that are not reachable on the public internet, beyond the loopback, private,
+// link-local and multicast ranges netip already knows about.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("2001:db8::/32"),
+	netip.MustParsePrefix("2002::/16"),
+}
+
+// reachable decides which addresses client may connect to. Tests widen it to reach a local server.
+var reachable = isPublic
+
+// client checks every address after DNS resolution, right before connecting, so a hostname cannot resolve to a
+// public address when checked and an internal one when used. Proxies from the environment are ignored since the
+// check would then apply to the proxy instead of the calendar's host.
+var client = &http.Client{
+	Timeout: fetchTimeout,
+	Transport: &http.Transport{
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout: fetchTimeout,
+			Control: func(network string, address string, conn syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				ip, err := netip.ParseAddr(host)
+				if err != nil || !reachable(ip) {
+					return ErrBlockedAddress
+				}
+				return nil
+			},
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   fetchTimeout,
+		ResponseHeaderTimeout: fetchTimeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+	},
+	CheckRedirect: func(request *http.Request, via []*http.Request) error {
+		if len(via) > maxRedirects {
+			return ErrTooManyRedirects
+		}
+		if request.URL.Scheme != "http" && request.URL.Scheme != "https" {
+			return ErrInvalidURL
+		}
+		request.Header.Set("User-Agent", userAgent)
+		return nil
+	},
+}
+
+// Fetch downloads and parses a remote calendar. webcal urls are fetched over https.
+func Fetch(ctx context.Context, rawURL string) (*ics.Calendar, error) {
+	target, err := normalize(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, ErrInvalidURL
+	}
+	request.Header.Set("User-Agent", userAgent)
+	request.Header.Set("Accept", "text/calendar, */*;q=0.5")
+
+	response, err := client.Do(request)
+	if err != nil {
+		// The client wraps errors from redirects and dialing, which callers want to tell apart
+		for _, known := range []error{ErrBlockedAddress, ErrInvalidURL, ErrTooManyRedirects} {
+			if errors.Is(err, known) {
+				return nil, known
+			}
+		}
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("calendar url responded with %s", response.Status)
+	}
+	if response.ContentLength > MaxBytes {
+		return nil, ErrTooLarge
+	}
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, MaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > MaxBytes {
+		return nil, ErrTooLarge
+	}
+
+	return ics.ParseCalendar(bytes.NewReader(body))
+}
+
+// normalize checks a calendar url and rewrites webcal to https.
+func normalize(rawURL string) (string, error) {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || parsed.Hostname() == "" {
+		return "", ErrInvalidURL
+	}
+
+	switch strings.ToLower(parsed.Scheme) {
+	case "http", "https":
+	case "webcal", "webcals":
+		parsed.Scheme = "https"
+	default:
+		return "", ErrInvalidURL
+	}
+
+	// Literal addresses are rejected up front for a clearer error; hostnames are checked once resolved
+	if ip, err := netip.ParseAddr(parsed.Hostname()); err == nil && !isPublic(ip) {
+		return "", ErrBlockedAddress
+	}
+
+	return parsed.String(), nil
+}
+
+func isPublic(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
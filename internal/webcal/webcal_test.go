@@ -0,0 +1,174 @@
+package webcal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestIsPublic(t *testing.T) {
+	tests := []struct {
+		name string
+		ip   string
+		want bool
+	}{
+		{"public IPv4", "93.184.216.34", true},
+		{"public IPv6", "2606:4700:4700::1111", true},
+		{"IPv4 loopback", "127.0.0.1", false},
+		{"IPv4 loopback range", "127.255.0.1", false},
+		{"IPv6 loopback", "::1", false},
+		{"unspecified", "0.0.0.0", false},
+		{"this network", "0.1.2.3", false},
+		{"RFC1918 10/8", "10.0.0.1", false},
+		{"RFC1918 172.16/12", "172.16.5.4", false},
+		{"RFC1918 172.31 edge", "172.31.255.255", false},
+		{"outside 172.16/12", "172.32.0.1", true},
+		{"RFC1918 192.168/16", "192.168.1.1", false},
+		{"CGNAT", "100.64.0.1", false},
+		{"CGNAT edge", "100.127.255.254", false},
+		{"outside CGNAT", "100.128.0.1", true},
+		{"link-local metadata", "169.254.169.254", false},
+		{"IPv4 documentation", "192.0.2.10", false},
+		{"benchmarking", "198.18.0.1", false},
+		{"reserved", "240.0.0.1", false},
+		{"broadcast", "255.255.255.255", false},
+		{"multicast", "224.0.0.1", false},
+		{"ULA", "fd00::1", false},
+		{"ULA fc00::/7", "fc12:3456::1", false},
+		{"IPv6 link-local", "fe80::1", false},
+		{"IPv6 multicast", "ff02::1", false},
+		{"IPv6 documentation", "2001:db8::1", false},
+		{"NAT64", "64:ff9b::7f00:1", false},
+		{"6to4", "2002:7f00:1::", false},
+		{"IPv4-mapped loopback", "::ffff:127.0.0.1", false},
+		{"IPv4-mapped private", "::ffff:10.0.0.1", false},
+		{"IPv4-mapped CGNAT", "::ffff:100.64.0.1", false},
+		{"IPv4-mapped public", "::ffff:93.184.216.34", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := isPublic(netip.MustParseAddr(test.ip)); got != test.want {
+				t.Errorf("isPublic(%s) = %v, want %v", test.ip, got, test.want)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		want    string
+		wantErr error
+	}{
+		{"https kept", "https://example.com/cal.ics", "https://example.com/cal.ics", nil},
+		{"http kept", "http://example.com/cal.ics", "http://example.com/cal.ics", nil},
+		{"webcal to https", "webcal://example.com/cal.ics", "https://example.com/cal.ics", nil},
+		{"webcals to https", "webcals://example.com/cal.ics", "https://example.com/cal.ics", nil},
+		{"uppercase scheme", "WEBCAL://example.com/cal.ics?x=1", "https://example.com/cal.ics?x=1", nil},
+		{"surrounding spaces", "  webcal://example.com/a.ics  ", "https://example.com/a.ics", nil},
+		{"port kept", "webcal://example.com:8443/a.ics", "https://example.com:8443/a.ics", nil},
+		{"public literal", "https://93.184.216.34/a.ics", "https://93.184.216.34/a.ics", nil},
+		{"ftp", "ftp://example.com/cal.ics", "", ErrInvalidURL},
+		{"file", "file:///etc/passwd", "", ErrInvalidURL},
+		{"no host", "https:///cal.ics", "", ErrInvalidURL},
+		{"relative", "/cal.ics", "", ErrInvalidURL},
+		{"unparseable", "http://[::1", "", ErrInvalidURL},
+		{"loopback literal", "http://127.0.0.1/cal.ics", "", ErrBlockedAddress},
+		{"webcal loopback", "webcal://127.0.0.1:8080/cal.ics", "", ErrBlockedAddress},
+		{"IPv6 loopback", "http://[::1]/cal.ics", "", ErrBlockedAddress},
+		{"private literal", "http://192.168.0.10/cal.ics", "", ErrBlockedAddress},
+		{"CGNAT literal", "http://100.64.1.1/cal.ics", "", ErrBlockedAddress},
+		{"ULA literal", "http://[fd12::1]/cal.ics", "", ErrBlockedAddress},
+		{"IPv4-mapped literal", "http://[::ffff:10.0.0.1]/cal.ics", "", ErrBlockedAddress},
+		{"metadata literal", "http://169.254.169.254/latest/meta-data", "", ErrBlockedAddress},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := normalize(test.url)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("normalize(%q) error = %v, want %v", test.url, err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("normalize(%q) = %q, want %q", test.url, got, test.want)
+			}
+		})
+	}
+}
+
+func TestFetchRejectsLoopback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("blocked server was reached")
+	}))
+	defer server.Close()
+
+	if _, err := Fetch(context.Background(), server.URL); !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("Fetch(%s) error = %v, want %v", server.URL, err, ErrBlockedAddress)
+	}
+}
+
+func TestFetchRedirects(t *testing.T) {
+	tests := []struct {
+		name     string
+		location string
+		wantErr  error
+	}{
+		{"loopback", "http://127.0.0.2/cal.ics", ErrBlockedAddress},
+		{"IPv6 loopback", "http://[::1]/cal.ics", ErrBlockedAddress},
+		{"private", "http://10.0.0.1/cal.ics", ErrBlockedAddress},
+		{"CGNAT", "http://100.64.0.1/cal.ics", ErrBlockedAddress},
+		{"metadata", "http://169.254.169.254/latest/meta-data", ErrBlockedAddress},
+		{"ULA", "http://[fd00::1]/cal.ics", ErrBlockedAddress},
+		{"IPv4-mapped", "http://[::ffff:192.168.1.1]/cal.ics", ErrBlockedAddress},
+		{"non-http scheme", "file:///etc/passwd", ErrInvalidURL},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.RedirectHandler(test.location, http.StatusFound))
+			defer server.Close()
+			allowOnly(t, server)
+
+			if _, err := Fetch(context.Background(), localURL(server)); !errors.Is(err, test.wantErr) {
+				t.Fatalf("redirect to %s: error = %v, want %v", test.location, err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestFetchTooManyRedirects(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, server.URL+"/again", http.StatusFound)
+	}))
+	defer server.Close()
+	allowOnly(t, server)
+
+	if _, err := Fetch(context.Background(), localURL(server)); !errors.Is(err, ErrTooManyRedirects) {
+		t.Fatalf("error = %v, want %v", err, ErrTooManyRedirects)
+	}
+}
+
+// allowOnly lets the client reach the test server's address on top of public ones for the rest of the test.
+func allowOnly(t *testing.T, server *httptest.Server) {
+	t.Helper()
+
+	local := netip.MustParseAddrPort(server.Listener.Addr().String()).Addr()
+	previous := reachable
+	reachable = func(ip netip.Addr) bool {
+		return ip == local || isPublic(ip)
+	}
+	t.Cleanup(func() { reachable = previous })
+}
+
+// localURL addresses a test server by name, since Fetch rejects literal loopback URLs before connecting.
+func localURL(server *httptest.Server) string {
+	port := netip.MustParseAddrPort(server.Listener.Addr().String()).Port()
+	return fmt.Sprintf("http://localhost:%d/cal.ics", port)
+}
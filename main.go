@@ -1,8 +1,12 @@
 package main
 
 import (
+	"calenduh-backend/internal/cache"
 	"calenduh-backend/internal/controllers"
 	"calenduh-backend/internal/database"
+	"calenduh-backend/internal/jobs"
+	"calenduh-backend/internal/mailer"
+	"calenduh-backend/internal/storage"
 	"calenduh-backend/internal/util"
 	"fmt"
 	"github.com/gin-contrib/cors"
@@ -11,6 +15,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -53,25 +58,83 @@ func main() {
 	// config.AllowOrigins = []string{"http://google.com", "http://facebook.com"}
 	// config.AllowAllOrigins = true
 
+	// Cache
+	backend, err := cache.New(os.Getenv("CACHE_DRIVER"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	cache.Default = backend
+	util.OpenCaches(backend)
+
 	// Router setup
 	router := gin.Default()
+	// Only trust X-Forwarded-For from these proxies, and from none without TRUSTED_PROXIES, so clients cannot choose
+	// the IP address their requests are rate limited under
+	var trustedProxies []string
+	if proxies := os.Getenv("TRUSTED_PROXIES"); proxies != "" {
+		trustedProxies = strings.Split(proxies, ",")
+	}
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatal(err)
+	}
 	router.Use(CORSMiddleware())
 	router.Use(gin.Recovery())
+	// The per IP limit runs before Authorize so floods with made-up session cookies are cut off before the lookup
+	router.Use(controllers.RateLimit(controllers.RateLimitIP))
 	router.Use(controllers.Authorize)
+	router.Use(controllers.RateLimit(controllers.RateLimitWrite))
 	router.GET("/health", func(c *gin.Context) {
 		uptime := time.Since(timeStarted).Truncate(time.Second)
+		activeUsers, err := util.ActiveUsers.Count(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "cache unavailable: " + err.Error()})
+			return
+		}
+		dailyUsers, err := util.DailyUsers.Count(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "cache unavailable: " + err.Error()})
+			return
+		}
 		message := gin.H{
 			"uptime":       fmt.Sprintf("%v", uptime),
-			"active_users": util.ActiveUsers.ItemCount(),
-			"daily_users":  util.DailyUsers.ItemCount(),
+			"active_users": activeUsers,
+			"daily_users":  dailyUsers,
 		}
 		c.PureJSON(http.StatusOK, message)
 		return
 	})
 
+	// Mail
+	mail, err := mailer.New(os.Getenv("MAIL_DRIVER"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	mailer.Default = mail
+
+	// Storage
+	store, err := storage.New(os.Getenv("STORAGE_DRIVER"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	storage.Default = store
+	controllers.UploadQuota = int64(util.GetEnvInt("UPLOAD_QUOTA_MB", 200)) << 20
+	controllers.ImageURLExpiry = time.Duration(util.GetEnvInt("IMAGE_URL_EXPIRY_MINUTES", 15)) * time.Minute
+
 	// Setup Routes
 	setupRoutes(router)
 
+	// Background Jobs
+	jobs.TrashRetention = time.Duration(util.GetEnvInt("TRASH_RETENTION_DAYS", 30)) * 24 * time.Hour
+	jobs.Schedule("purge-tombstones", 24*time.Hour, jobs.PurgeTombstones)
+	jobs.Schedule("purge-revisions", 24*time.Hour, jobs.PurgeRevisions)
+	jobs.Schedule("purge-trash", time.Hour, jobs.PurgeTrash)
+	jobs.Schedule("process-exports", time.Minute, controllers.ProcessExports)
+	jobs.Schedule("purge-exports", time.Hour, controllers.PurgeExports)
+	controllers.AccountDeletionGrace = time.Duration(util.GetEnvInt("ACCOUNT_DELETION_GRACE_DAYS", 14)) * 24 * time.Hour
+	jobs.Schedule("delete-accounts", time.Hour, controllers.ProcessAccountDeletions)
+	jobs.OrphanGracePeriod = time.Duration(util.GetEnvInt("ORPHAN_GRACE_HOURS", 24)) * time.Hour
+	jobs.Schedule("collect-orphaned-objects", 24*time.Hour, jobs.CollectOrphanedObjects)
+
 	// Signal handling
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
@@ -93,14 +156,18 @@ func main() {
 }
 
 func setupRoutes(router *gin.Engine) {
-	authentication := router.Group("/auth")
+	authentication := router.Group("/auth", controllers.RateLimit(controllers.RateLimitAuth))
 	files := router.Group("/files")
 	users := router.Group("/users")
 	events := router.Group("/events")
 	groups := router.Group("/groups")
 	calendars := router.Group("/calendars")
 	subscriptions := router.Group("/subscriptions")
-	_ = router.Group("/groups/:group_id/members")
+	sync := router.Group("/sync")
+	trash := router.Group("/trash")
+	audit := router.Group("/audit")
+	invites := router.Group("/invites")
+	groupMembers := router.Group("/groups/:group_id/members")
 	{ // Auth
 		authentication.POST("/apple/login", controllers.AppleLogin)
 		authentication.GET("/google/login", controllers.GoogleLogin)
@@ -108,76 +175,136 @@ func setupRoutes(router *gin.Engine) {
 		authentication.GET("/discord/login", controllers.DiscordLogin)
 		authentication.GET("/discord", controllers.DiscordAuth)
 		authentication.GET("/logout", controllers.Logout)
-		authentication.GET("/sessions", controllers.GetAllSessions)
+		authentication.GET("/sessions", controllers.Admin, controllers.GetAllSessions)
 	}
 	{ // Files
 		// files.POST("/:key", controllers.LoggedIn, controllers.UploadFile)   // Upload Profile Picture
 		// files.DELETE("/:key", controllers.LoggedIn, controllers.DeleteFile) // Delete Profile Picture
-		files.POST("/upload", controllers.LoggedIn, controllers.UploadFile)
-		files.POST("/uploadFile", controllers.LoggedIn, controllers.UploadFileNotAProfilePicture)
+		files.POST("/upload", controllers.LoggedIn, controllers.RateLimit(controllers.RateLimitUpload), controllers.UploadFile)
+		files.POST("/uploadFile", controllers.LoggedIn, controllers.RateLimit(controllers.RateLimitUpload), controllers.UploadFileNotAProfilePicture)
 		files.PUT("/profile", controllers.LoggedIn, controllers.UpdateProfilePicture) // note: unused I think
 		files.DELETE("/profile", controllers.LoggedIn, controllers.DeleteProfilePicture)
 		files.GET("/profile/url", controllers.LoggedIn, controllers.GetProfilePictureURL)
-		files.POST("/uploadEventImage/:calendar_id/:event_id", controllers.LoggedIn, controllers.CreateEventImage)
+		files.GET("/usage", controllers.LoggedIn, controllers.GetUploadUsage)
+		files.PUT("/group/:group_id", controllers.LoggedIn, controllers.RateLimit(controllers.RateLimitUpload), controllers.UploadGroupAvatar)
+		files.DELETE("/group/:group_id", controllers.LoggedIn, controllers.DeleteGroupAvatar)
+		files.POST("/uploadEventImage/:calendar_id/:event_id", controllers.LoggedIn, controllers.RateLimit(controllers.RateLimitUpload), controllers.CreateEventImage)
 		// files.PUT("/updateEventImage/:calendar_id/:event_id", controllers.LoggedIn, controllers.UpdateEventImage)
 		files.DELETE("/deleteEventImage/:calendar_id/:event_id", controllers.LoggedIn, controllers.DeleteEventImage)
+		files.GET("/event/:calendar_id/:event_id/url", controllers.LoggedIn, controllers.GetEventImageURL)
+		files.GET("/orphans", controllers.Admin, controllers.GetOrphanedFiles)
+		files.DELETE("/orphans", controllers.Admin, controllers.DeleteOrphanedFiles)
 	}
 	{ // Users
-		users.GET("/", controllers.GetAllUsers)                                       // Get all users
-		users.GET("/@me", controllers.LoggedIn, controllers.GetMe)                    // Get self user
-		users.GET("/:user_id", controllers.LoggedIn, controllers.GetUser)             // Get a specific user
-		users.PUT("/:user_id", controllers.LoggedIn, controllers.UpdateUser)          // Update user details
-		users.POST("/@local", controllers.LoggedIn, controllers.UploadLocalCalendars) // Upload local user calendars and events
-		users.DELETE("/@me", controllers.LoggedIn, controllers.DeleteMe)              // Delete self user
-		users.DELETE("/@all", controllers.DeleteAllUsers)                             // Delete all users
-		users.DELETE("/:user_id", controllers.DeleteUser)                             // Delete user by id
+		users.GET("/", controllers.Admin, controllers.GetAllUsers)                        // Get all users
+		users.GET("/@me", controllers.LoggedIn, controllers.GetMe)                        // Get self user
+		users.GET("/@me/audit", controllers.LoggedIn, controllers.GetMyAuditLog)          // Get audit log of the self user's account
+		users.GET("/@me/export", controllers.LoggedIn, controllers.GetExports)            // Get data exports of the self user
+		users.POST("/@me/export", controllers.LoggedIn, controllers.RequestExport)        // Request an export of the self user's data
+		users.GET("/@me/export/:export_id", controllers.LoggedIn, controllers.GetExport)  // Get a data export and its download link
+		users.GET("/:user_id", controllers.LoggedIn, controllers.GetUser)                 // Get a specific user
+		users.PUT("/:user_id", controllers.LoggedIn, controllers.UpdateUser)              // Update user details
+		users.PATCH("/@me", controllers.LoggedIn, controllers.PatchMe)                    // Partially update self user
+		users.POST("/@local", controllers.LoggedIn, controllers.UploadLocalCalendars)     // Upload local user calendars and events
+		users.DELETE("/@me", controllers.LoggedIn, controllers.DeleteMe)                  // Schedule deletion of self user
+		users.GET("/@me/deletion", controllers.LoggedIn, controllers.GetMyDeletion)       // Get pending deletion of self user
+		users.DELETE("/@me/deletion", controllers.LoggedIn, controllers.CancelMyDeletion) // Cancel pending deletion of self user
+		users.DELETE("/@all", controllers.Admin, controllers.DeleteAllUsers)              // Delete all users
+		users.DELETE("/:user_id", controllers.Admin, controllers.DeleteUser)              // Delete user by id
 	}
 	{ // Events
-		events.GET("/", controllers.WithRange, controllers.GetAllEvents)                                         // List all events
-		events.GET("/@me", controllers.WithRange, controllers.LoggedIn, controllers.GetUserEvents)               // Get all events for a user that start today
-		events.GET("/:calendar_id", controllers.WithRange, controllers.LoggedIn, controllers.GetCalendarEvents)  // Get Calendar events
-		events.GET("/:calendar_id/:event_id", controllers.WithRange, controllers.LoggedIn, controllers.GetEvent) // Get a specific event
-		events.POST("/:calendar_id", controllers.LoggedIn, controllers.CreateEvent)                              // Create a new event
-		events.PUT("/:calendar_id/:event_id", controllers.LoggedIn, controllers.UpdateEvent)                     // Update an event
-		events.DELETE("/@all", controllers.DeleteAllEvents)                                                      // Delete all events
-		events.DELETE("/@prune", controllers.LoggedIn, controllers.PruneEvents)                                  // Prune events that are no longer occurring
-		events.DELETE("/:calendar_id/:event_id", controllers.LoggedIn, controllers.DeleteEvent)                  // Delete an event
+		events.GET("/", controllers.WithRange, controllers.GetAllEvents)                                                                                                // List all events
+		events.GET("/@me", controllers.WithRange, controllers.LoggedIn, controllers.GetUserEvents)                                                                      // Get all events for a user that start today
+		events.GET("/search", controllers.WithRange, controllers.LoggedIn, controllers.SearchEvents)                                                                    // Search events visible to the user
+		events.GET("/:calendar_id", controllers.WithRange, controllers.LoggedIn, controllers.GetCalendarEvents)                                                         // Get Calendar events
+		events.GET("/:calendar_id/:event_id", controllers.WithRange, controllers.LoggedIn, controllers.GetEvent)                                                        // Get a specific event
+		events.GET("/:calendar_id/:event_id/history", controllers.LoggedIn, controllers.GetEventHistory)                                                                // Get the revision history of an event
+		events.POST("/:calendar_id", controllers.LoggedIn, controllers.CreateEvent)                                                                                     // Create a new event
+		events.POST("/restore/:revision_id", controllers.LoggedIn, controllers.RestoreEventRevision)                                                                    // Restore an event revision
+		events.PUT("/:calendar_id/:event_id", controllers.LoggedIn, controllers.UpdateEvent)                                                                            // Update an event
+		events.PATCH("/:calendar_id/:event_id", controllers.LoggedIn, controllers.PatchEvent)                                                                           // Partially update an event
+		events.DELETE("/@all", controllers.Admin, controllers.DeleteAllEvents)                                                                                          // Delete all events
+		events.DELETE("/@prune", controllers.LoggedIn, controllers.PruneEvents)                                                                                         // Prune events that are no longer occurring
+		events.DELETE("/:calendar_id/:event_id", controllers.LoggedIn, controllers.DeleteEvent)                                                                         // Delete an event
+		events.GET("/:calendar_id/:event_id/attachments", controllers.LoggedIn, controllers.GetEventAttachments)                                                        // List an event's attachments
+		events.POST("/:calendar_id/:event_id/attachments", controllers.LoggedIn, controllers.RateLimit(controllers.RateLimitUpload), controllers.CreateEventAttachment) // Attach a file to an event
+		events.DELETE("/:calendar_id/:event_id/attachments/:attachment_id", controllers.LoggedIn, controllers.DeleteEventAttachment)                                    // Remove an attachment from an event
 	}
 	{ // Groups
-		groups.GET("/", controllers.GetAllGroups)                                      // List all groups
-		groups.GET("/@me", controllers.LoggedIn, controllers.GetMyGroups)              // List all user groups
-		groups.GET("/:group_id", controllers.LoggedIn, controllers.GetGroup)           // Get a specific group
-		groups.POST("/join/:invite_code", controllers.LoggedIn, controllers.JoinGroup) // Join a group by code
-		groups.POST("/leave/:group_id", controllers.LoggedIn, controllers.LeaveGroup)  // Leave a group
-		groups.POST("/", controllers.LoggedIn, controllers.CreateGroup)                // Create a new group
-		groups.PUT("/:group_id", controllers.LoggedIn, controllers.UpdateGroup)        // Update a group
-		groups.DELETE("/:group_id", controllers.LoggedIn, controllers.DeleteGroup)     // Delete a group
+		groups.GET("/", controllers.Admin, controllers.GetAllGroups)                                                 // List all groups
+		groups.GET("/@me", controllers.LoggedIn, controllers.GetMyGroups)                                            // List all user groups
+		groups.GET("/:group_id", controllers.LoggedIn, controllers.GetGroup)                                         // Get a specific group
+		groups.GET("/@invites", controllers.LoggedIn, controllers.GetMyInvitations)                                  // List the user's pending group invitations
+		groups.POST("/@invites/redeem", controllers.LoggedIn, controllers.RedeemInvitation)                          // Accept an email invitation with its token
+		groups.POST("/@invites/:invitation_id/accept", controllers.LoggedIn, controllers.AcceptInvitation)           // Accept a group invitation
+		groups.POST("/@invites/:invitation_id/decline", controllers.LoggedIn, controllers.DeclineInvitation)         // Decline a group invitation
+		groups.GET("/:group_id/invites", controllers.LoggedIn, controllers.GetGroupInvitations)                      // List pending invitations to a group
+		groups.POST("/:group_id/invites", controllers.LoggedIn, controllers.CreateGroupInvitation)                   // Invite a user to a group by username or email
+		groups.DELETE("/:group_id/invites/:invitation_id", controllers.LoggedIn, controllers.CancelGroupInvitation)  // Cancel an invitation to a group
+		groups.GET("/@me/requests", controllers.LoggedIn, controllers.GetMyJoinRequests)                             // List the user's join requests
+		groups.DELETE("/@me/requests/:request_id", controllers.LoggedIn, controllers.CancelMyJoinRequest)            // Cancel a pending join request
+		groups.GET("/:group_id/requests", controllers.LoggedIn, controllers.GetGroupJoinRequests)                    // List requests to join a group
+		groups.POST("/:group_id/requests/:request_id/approve", controllers.LoggedIn, controllers.ApproveJoinRequest) // Approve a join request
+		groups.POST("/:group_id/requests/:request_id/deny", controllers.LoggedIn, controllers.DenyJoinRequest)       // Deny a join request
+		groups.POST("/join/:invite_code", controllers.LoggedIn, controllers.JoinGroup)                               // Join a group by code
+		groups.POST("/leave/:group_id", controllers.LoggedIn, controllers.LeaveGroup)                                // Leave a group
+		groups.POST("/", controllers.LoggedIn, controllers.CreateGroup)                                              // Create a new group
+		groups.PUT("/:group_id", controllers.LoggedIn, controllers.UpdateGroup)                                      // Update a group
+		groups.PATCH("/:group_id", controllers.LoggedIn, controllers.PatchGroup)                                     // Partially update a group
+		groups.DELETE("/:group_id", controllers.LoggedIn, controllers.DeleteGroup)                                   // Delete a group
 	}
 	{ // Calendars
-		calendars.GET("/", controllers.GetAllCalendars)                                          // List all calendars
-		calendars.GET("/@me", controllers.LoggedIn, controllers.GetUserCalendars)                // List all calendars owned by user
-		calendars.GET("/@groups", controllers.LoggedIn, controllers.GetAllGroupCalendars)        // List all calendars owned by user groups
-		calendars.GET("/@public", controllers.LoggedIn, controllers.GetAllPublicCalendars)       // List all public calendars
-		calendars.GET("/@groups/:group_id", controllers.LoggedIn, controllers.GetGroupCalendars) // List all calendars owned by a single user group
-		calendars.GET("/@subscribed", controllers.LoggedIn, controllers.GetSubscribedCalendars)  // List all the calendars subscribed to by user
-		calendars.GET("/:calendar_id", controllers.GetCalendar)                                  // Get a specific calendar
-		calendars.POST("/", controllers.LoggedIn, controllers.CreateUserCalendar)                // Create a new user calendar
-		calendars.POST("/:group_id", controllers.LoggedIn, controllers.CreateGroupCalendar)      // Create a new group calendar
-		calendars.POST("/import", controllers.LoggedIn, controllers.ImportICal)                  // Import Calendar from iCal
-		calendars.POST("/import/web", controllers.LoggedIn, controllers.SubscribeICal)           // Subscribe to remote iCal
-		calendars.PUT("/:calendar_id", controllers.LoggedIn, controllers.UpdateCalendar)         // Update a calendar
-		calendars.DELETE("/@all", controllers.DeleteAllCalendars)                                // Delete all calendars
-		calendars.DELETE("/:calendar_id", controllers.LoggedIn, controllers.DeleteCalendar)      // Delete a calendar
+		calendars.GET("/", controllers.GetAllCalendars)                                                                                    // List all calendars
+		calendars.GET("/@me", controllers.LoggedIn, controllers.GetUserCalendars)                                                          // List all calendars owned by user
+		calendars.GET("/@groups", controllers.LoggedIn, controllers.GetAllGroupCalendars)                                                  // List all calendars owned by user groups
+		calendars.GET("/@public", controllers.LoggedIn, controllers.GetAllPublicCalendars)                                                 // Browse the public calendar directory
+		calendars.GET("/@public/tags", controllers.LoggedIn, controllers.GetPublicCalendarTags)                                            // List tags used in the public calendar directory
+		calendars.GET("/@public/:calendar_id", controllers.LoggedIn, controllers.GetPublicCalendarPreview)                                 // Preview a public calendar and its upcoming events
+		calendars.GET("/@groups/:group_id", controllers.LoggedIn, controllers.GetGroupCalendars)                                           // List all calendars owned by a single user group
+		calendars.GET("/@subscribed", controllers.LoggedIn, controllers.GetSubscribedCalendars)                                            // List all the calendars subscribed to by user
+		calendars.GET("/:calendar_id", controllers.GetCalendar)                                                                            // Get a specific calendar
+		calendars.GET("/:calendar_id/history", controllers.LoggedIn, controllers.GetCalendarHistory)                                       // Get the revision history of a calendar
+		calendars.POST("/", controllers.LoggedIn, controllers.CreateUserCalendar)                                                          // Create a new user calendar
+		calendars.POST("/:group_id", controllers.LoggedIn, controllers.CreateGroupCalendar)                                                // Create a new group calendar
+		calendars.POST("/import", controllers.LoggedIn, controllers.RateLimit(controllers.RateLimitImport), controllers.ImportICal)        // Import Calendar from iCal
+		calendars.POST("/import/web", controllers.LoggedIn, controllers.RateLimit(controllers.RateLimitImport), controllers.SubscribeICal) // Subscribe to remote iCal
+		calendars.POST("/restore/:revision_id", controllers.LoggedIn, controllers.RestoreCalendarRevision)                                 // Restore a calendar revision
+		calendars.PUT("/:calendar_id", controllers.LoggedIn, controllers.UpdateCalendar)                                                   // Update a calendar
+		calendars.PATCH("/:calendar_id", controllers.LoggedIn, controllers.PatchCalendar)                                                  // Partially update a calendar
+		calendars.DELETE("/@all", controllers.Admin, controllers.DeleteAllCalendars)                                                       // Delete all calendars
+		calendars.DELETE("/:calendar_id", controllers.LoggedIn, controllers.DeleteCalendar)                                                // Delete a calendar
 	}
 	{ // Subscriptions
 		subscriptions.GET("/", controllers.GetAllSubscriptions)                       // List all subscriptions
 		subscriptions.POST("/", controllers.LoggedIn, controllers.CreateSubscription) // Create a new subscription
 		//subscriptions.GET("/:user_id/:calendar_id", controllers.GetSubscription) // Get a specific subscription
-		subscriptions.DELETE("/:calendar_id", controllers.LoggedIn, controllers.DeleteMySubscription) // Delete a subscription
-		subscriptions.DELETE("/:calendar_id/:user_id", controllers.DeleteSubscription)                // Delete a subscription
+		subscriptions.DELETE("/:calendar_id", controllers.LoggedIn, controllers.DeleteMySubscription)     // Delete a subscription
+		subscriptions.DELETE("/:calendar_id/:user_id", controllers.Admin, controllers.DeleteSubscription) // Delete a subscription
+	}
+	{ // Sync
+		sync.GET("/", controllers.LoggedIn, controllers.Sync) // Get changes since a sync token
+	}
+	{ // Trash
+		trash.GET("/", controllers.LoggedIn, controllers.GetTrash)                                      // List recently deleted items
+		trash.POST("/events/:event_id", controllers.LoggedIn, controllers.RestoreTrashedEvent)          // Restore a deleted event
+		trash.POST("/calendars/:calendar_id", controllers.LoggedIn, controllers.RestoreTrashedCalendar) // Restore a deleted calendar
+		trash.POST("/groups/:group_id", controllers.LoggedIn, controllers.RestoreTrashedGroup)          // Restore a deleted group
+	}
+	{ // Invites
+		invites.GET("/groups/:group_id", controllers.LoggedIn, controllers.GetGroupInvites)                        // List invite links of a group
+		invites.POST("/groups/:group_id", controllers.LoggedIn, controllers.CreateGroupInvite)                     // Create an invite link to a group
+		invites.POST("/groups/:group_id/rotate", controllers.LoggedIn, controllers.RotateGroupInviteCode)          // Regenerate a group's invite code
+		invites.GET("/calendars/:calendar_id", controllers.LoggedIn, controllers.GetCalendarInvites)               // List invite links of a calendar
+		invites.POST("/calendars/:calendar_id", controllers.LoggedIn, controllers.CreateCalendarInvite)            // Create an invite link to a calendar
+		invites.POST("/calendars/:calendar_id/rotate", controllers.LoggedIn, controllers.RotateCalendarInviteCode) // Regenerate a calendar's invite code
+		invites.GET("/:invite_id/uses", controllers.LoggedIn, controllers.GetInviteUses)                           // List who used an invite link
+		invites.DELETE("/:invite_id", controllers.LoggedIn, controllers.RevokeInvite)                              // Revoke an invite link
+	}
+	{ // Audit
+		audit.GET("/", controllers.Admin, controllers.GetAuditLog) // Search the audit log
 	}
 	{ // GroupMembers
-		//groupMembers.GET("/", controllers.GetGroupMembers)              // List members of a group
+		groupMembers.GET("/", controllers.LoggedIn, controllers.GetGroupMembers) // List members of a group
 		//groupMembers.POST("/", controllers.AddGroupMember)              // Add a member to a group
 		//groupMembers.DELETE("/:user_id", controllers.RemoveGroupMember) // Remove a member from a group
 	}
@@ -186,9 +313,9 @@ func setupRoutes(router *gin.Engine) {
 func cleanup(server *http.Server) {
 	log.Println("shutdown signal received, cleaning up resources...")
 
-	util.SaveCache(util.Nonces, "nonces")
-	util.SaveCache(util.DailyUsers, "daily")
-	util.SaveCache(util.ActiveUsers, "active")
+	if err := cache.Default.Close(); err != nil {
+		log.Println("cache shutdown failed:", err)
+	}
 
 	if err := server.Close(); err != nil {
 		log.Println("server shutdown failed:", err)
@@ -207,8 +334,9 @@ func CORSMiddleware() gin.HandlerFunc {
 		}
 
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, If-Match, If-None-Match, X-API-Key")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "ETag, X-Next-Cursor, X-Total-Count, X-Truncated")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -0,0 +1,24 @@
+begin;
+
+drop trigger subscriptions_tombstone on subscriptions;
+drop trigger group_members_tombstone on group_members;
+drop trigger calendars_tombstone on calendars;
+drop trigger events_tombstone on events;
+drop function record_tombstone;
+
+drop table tombstones;
+
+drop trigger groups_change_seq on groups;
+drop trigger events_change_seq on events;
+drop trigger calendars_change_seq on calendars;
+drop function bump_change_seq;
+
+alter table subscriptions drop column change_seq;
+alter table group_members drop column change_seq;
+alter table groups drop column change_seq;
+alter table events drop column change_seq;
+alter table calendars drop column change_seq;
+
+drop sequence change_seq;
+
+commit;
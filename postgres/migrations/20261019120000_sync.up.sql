@@ -0,0 +1,82 @@
+begin;
+
+-- Every insert or update takes the next value of this sequence, giving sync
+-- clients a total order of changes to compare their token against.
+create sequence change_seq;
+
+alter table calendars
+    add column change_seq bigint not null default nextval('change_seq');
+
+alter table events
+    add column change_seq bigint not null default nextval('change_seq');
+
+alter table groups
+    add column change_seq bigint not null default nextval('change_seq');
+
+alter table group_members
+    add column change_seq bigint not null default nextval('change_seq');
+
+alter table subscriptions
+    add column change_seq bigint not null default nextval('change_seq');
+
+create function bump_change_seq() returns trigger as $$
+begin
+    new.change_seq := nextval('change_seq');
+    return new;
+end;
+$$ language plpgsql;
+
+create trigger calendars_change_seq before update on calendars
+    for each row execute function bump_change_seq();
+
+create trigger events_change_seq before update on events
+    for each row execute function bump_change_seq();
+
+create trigger groups_change_seq before update on groups
+    for each row execute function bump_change_seq();
+
+-- Deleted rows leave a tombstone behind so clients can remove them locally.
+create table tombstones (
+    change_seq bigint primary key default nextval('change_seq'),
+    entity_type text not null,
+    entity_id text not null,
+    calendar_id text,
+    group_id text,
+    user_id text,
+    deleted_at timestamp(3) not null default now()
+);
+
+create index tombstones_deleted_at on tombstones (deleted_at);
+
+create function record_tombstone() returns trigger as $$
+begin
+    if tg_table_name = 'events' then
+        insert into tombstones (entity_type, entity_id, calendar_id)
+        values ('event', old.event_id, old.calendar_id);
+    elsif tg_table_name = 'calendars' then
+        insert into tombstones (entity_type, entity_id, calendar_id, group_id, user_id)
+        values ('calendar', old.calendar_id, old.calendar_id, old.group_id, old.user_id);
+    elsif tg_table_name = 'group_members' then
+        insert into tombstones (entity_type, entity_id, group_id, user_id)
+        values ('group_member', old.group_id, old.group_id, old.user_id);
+    elsif tg_table_name = 'subscriptions' then
+        insert into tombstones (entity_type, entity_id, calendar_id, user_id)
+        values ('subscription', old.calendar_id, old.calendar_id, old.user_id);
+    end if;
+    return old;
+end;
+$$ language plpgsql;
+
+create trigger events_tombstone after delete on events
+    for each row execute function record_tombstone();
+
+create trigger calendars_tombstone after delete on calendars
+    for each row execute function record_tombstone();
+
+create trigger group_members_tombstone after delete on group_members
+    for each row execute function record_tombstone();
+
+create trigger subscriptions_tombstone after delete on subscriptions
+    for each row execute function record_tombstone();
+
+commit;
@@ -0,0 +1,8 @@
+begin;
+
+drop table client_ids;
+
+alter table calendars
+    drop column last_edited;
+
+commit;
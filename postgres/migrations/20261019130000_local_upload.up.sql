@@ -0,0 +1,15 @@
+begin;
+
+alter table calendars
+    add column last_edited timestamp(3) not null default now();
+
+-- Maps the IDs an offline client generated locally to the IDs the server assigned
+create table client_ids (
+    user_id text not null references users(user_id) on delete cascade on update cascade,
+    entity_type text not null,
+    client_id text not null,
+    server_id text not null,
+    primary key (user_id, entity_type, client_id)
+);
+
+commit;
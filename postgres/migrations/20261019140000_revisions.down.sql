@@ -0,0 +1,11 @@
+begin;
+
+drop trigger calendars_revision on calendars;
+drop trigger events_revision on events;
+drop trigger calendars_skip_revisions on calendars;
+drop function record_revision;
+drop function skip_web_calendar_revisions;
+
+drop table revisions;
+
+commit;
@@ -0,0 +1,94 @@
+begin;
+
+-- Append-only history of events and calendars. Snapshots hold the row after the change,
+-- or the row as it was for deletions, so any revision can be restored.
+create table revisions (
+    revision_id bigserial primary key,
+    entity_type text not null,
+    entity_id text not null,
+    calendar_id text not null,
+    user_id text,
+    group_id text,
+    action text not null,
+    actor_id text,
+    snapshot jsonb not null,
+    changes jsonb,
+    created_at timestamp(3) not null default now()
+);
+
+create index revisions_entity on revisions (entity_type, entity_id, revision_id);
+create index revisions_calendar on revisions (calendar_id, created_at);
+create index revisions_created_at on revisions (created_at);
+
+create function skip_web_calendar_revisions() returns trigger as $$
+begin
+    -- Web calendars are deleted and recreated on every refresh, so their cascaded
+    -- event deletions are not worth keeping either
+    if old.is_web_based then
+        perform set_config('calenduh.skip_revisions_for', old.calendar_id, true);
+    end if;
+    return old;
+end;
+$$ language plpgsql;
+
+create function record_revision() returns trigger as $$
+declare
+    row_data jsonb;
+    row_changes jsonb;
+begin
+    if tg_op = 'DELETE' then
+        row_data := to_jsonb(old);
+    else
+        row_data := to_jsonb(new);
+    end if;
+
+    if tg_table_name = 'calendars' and (row_data->>'is_web_based')::boolean then
+        return null;
+    end if;
+
+    if tg_table_name = 'events' and (
+        row_data->>'calendar_id' = current_setting('calenduh.skip_revisions_for', true)
+        or exists (select 1 from calendars where calendar_id = row_data->>'calendar_id' and is_web_based)
+    ) then
+        return null;
+    end if;
+
+    if tg_op = 'UPDATE' then
+        select jsonb_object_agg(n.key, jsonb_build_object('old', o.value, 'new', n.value))
+        into row_changes
+        from jsonb_each(row_data) n
+        inner join jsonb_each(to_jsonb(old)) o on n.key = o.key
+        where n.value is distinct from o.value and n.key not in ('change_seq', 'last_edited');
+
+        if row_changes is null then
+            return null;
+        end if;
+    end if;
+
+    insert into revisions (entity_type, entity_id, calendar_id, user_id, group_id, action, actor_id, snapshot, changes)
+    values (
+        case tg_table_name when 'events' then 'event' else 'calendar' end,
+        coalesce(row_data->>'event_id', row_data->>'calendar_id'),
+        row_data->>'calendar_id',
+        row_data->>'user_id',
+        row_data->>'group_id',
+        case tg_op when 'INSERT' then 'create' when 'UPDATE' then 'update' else 'delete' end,
+        nullif(current_setting('calenduh.actor_id', true), ''),
+        row_data,
+        row_changes
+    );
+
+    return null;
+end;
+$$ language plpgsql;
+
+create trigger calendars_skip_revisions before delete on calendars
+    for each row execute function skip_web_calendar_revisions();
+
+create trigger events_revision after insert or update or delete on events
+    for each row execute function record_revision();
+
+create trigger calendars_revision after insert or update or delete on calendars
+    for each row execute function record_revision();
+
+commit;
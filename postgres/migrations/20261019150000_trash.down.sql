@@ -0,0 +1,33 @@
+begin;
+
+drop trigger groups_trash_tombstone on groups;
+drop trigger calendars_trash_tombstone on calendars;
+drop trigger events_trash_tombstone on events;
+drop trigger calendars_tombstone on calendars;
+drop trigger events_tombstone on events;
+
+create trigger events_tombstone after delete on events
+    for each row execute function record_tombstone();
+
+create trigger calendars_tombstone after delete on calendars
+    for each row execute function record_tombstone();
+
+-- Anything still in the trash would otherwise reappear
+delete from groups where deleted_at is not null;
+delete from calendars where deleted_at is not null;
+delete from events where deleted_at is not null;
+
+drop index groups_deleted_at;
+drop index events_deleted_at;
+drop index calendars_deleted_at;
+
+alter table groups
+    drop column deleted_at;
+
+alter table events
+    drop column deleted_at;
+
+alter table calendars
+    drop column deleted_at;
+
+commit;
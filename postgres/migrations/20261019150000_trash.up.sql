@@ -0,0 +1,59 @@
+begin;
+
+-- Deleted calendars, events and groups are kept in the trash until they are purged.
+-- Children trashed along with their parent share its deleted_at so they can be restored together.
+alter table calendars
+    add column deleted_at timestamp(3);
+
+alter table events
+    add column deleted_at timestamp(3);
+
+alter table groups
+    add column deleted_at timestamp(3);
+
+create index calendars_deleted_at on calendars (deleted_at) where deleted_at is not null;
+create index events_deleted_at on events (deleted_at) where deleted_at is not null;
+create index groups_deleted_at on groups (deleted_at) where deleted_at is not null;
+
+create or replace function record_tombstone() returns trigger as $$
+begin
+    if tg_table_name = 'events' then
+        insert into tombstones (entity_type, entity_id, calendar_id)
+        values ('event', old.event_id, old.calendar_id);
+    elsif tg_table_name = 'calendars' then
+        insert into tombstones (entity_type, entity_id, calendar_id, group_id, user_id)
+        values ('calendar', old.calendar_id, old.calendar_id, old.group_id, old.user_id);
+    elsif tg_table_name = 'groups' then
+        insert into tombstones (entity_type, entity_id, group_id)
+        values ('group', old.group_id, old.group_id);
+    elsif tg_table_name = 'group_members' then
+        insert into tombstones (entity_type, entity_id, group_id, user_id)
+        values ('group_member', old.group_id, old.group_id, old.user_id);
+    elsif tg_table_name = 'subscriptions' then
+        insert into tombstones (entity_type, entity_id, calendar_id, user_id)
+        values ('subscription', old.calendar_id, old.calendar_id, old.user_id);
+    end if;
+    return old;
+end;
+$$ language plpgsql;
+
+-- Clients already removed trashed rows, so purging them must not leave a second tombstone
+drop trigger events_tombstone on events;
+drop trigger calendars_tombstone on calendars;
+
+create trigger events_tombstone after delete on events
+    for each row when (old.deleted_at is null) execute function record_tombstone();
+
+create trigger calendars_tombstone after delete on calendars
+    for each row when (old.deleted_at is null) execute function record_tombstone();
+
+create trigger events_trash_tombstone after update of deleted_at on events
+    for each row when (old.deleted_at is null and new.deleted_at is not null) execute function record_tombstone();
+
+create trigger calendars_trash_tombstone after update of deleted_at on calendars
+    for each row when (old.deleted_at is null and new.deleted_at is not null) execute function record_tombstone();
+
+create trigger groups_trash_tombstone after update of deleted_at on groups
+    for each row when (old.deleted_at is null and new.deleted_at is not null) execute function record_tombstone();
+
+commit;
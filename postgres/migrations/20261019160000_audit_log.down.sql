@@ -0,0 +1,5 @@
+begin;
+
+drop table audit_log;
+
+commit;
@@ -0,0 +1,21 @@
+begin;
+
+-- Security-relevant and destructive actions. Actor and target are plain text rather than
+-- foreign keys so entries outlive the users and rows they describe.
+create table audit_log (
+    audit_id bigserial primary key,
+    actor_id text,
+    action text not null,
+    target_type text,
+    target_id text,
+    ip text not null,
+    user_agent text not null,
+    metadata jsonb,
+    created_at timestamp(3) not null default now()
+);
+
+create index audit_log_actor on audit_log (actor_id, audit_id);
+create index audit_log_target on audit_log (target_type, target_id, audit_id);
+create index audit_log_action on audit_log (action, audit_id);
+
+commit;
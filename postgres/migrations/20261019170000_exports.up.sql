@@ -0,0 +1,20 @@
+begin;
+
+-- Account data exports, built in the background and uploaded to storage until they expire.
+create table exports (
+    export_id text primary key,
+    user_id text not null references users(user_id) on delete cascade on update cascade,
+    status text not null default 'pending',
+    object_key text,
+    size_bytes bigint,
+    error text,
+    created_at timestamp(3) not null default now(),
+    started_at timestamp(3),
+    completed_at timestamp(3),
+    expires_at timestamp(3)
+);
+
+create index exports_user_id on exports (user_id, created_at);
+create index exports_status on exports (status, created_at);
+
+commit;
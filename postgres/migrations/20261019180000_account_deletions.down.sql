@@ -0,0 +1,5 @@
+begin;
+
+drop table account_deletions;
+
+commit;
@@ -0,0 +1,12 @@
+begin;
+
+-- Accounts waiting out the grace period before they are deleted. Removing the row cancels the deletion.
+create table account_deletions (
+    user_id text primary key references users(user_id) on delete cascade on update cascade,
+    requested_at timestamp(3) not null default now(),
+    delete_after timestamp(3) not null
+);
+
+create index account_deletions_delete_after on account_deletions (delete_after);
+
+commit;
@@ -0,0 +1,6 @@
+begin;
+
+drop index events_search;
+drop function event_search_vector(text, text, text);
+
+commit;
@@ -0,0 +1,12 @@
+begin;
+
+-- Weighted full-text document for an event. Queries must call this same function for the index to be used.
+create function event_search_vector(name text, location text, description text) returns tsvector as $$
+    select setweight(to_tsvector('english', coalesce(name, '')), 'A')
+        || setweight(to_tsvector('english', coalesce(location, '')), 'B')
+        || setweight(to_tsvector('english', coalesce(description, '')), 'C');
+$$ language sql immutable;
+
+create index events_search on events using gin (event_search_vector(name, location, description));
+
+commit;
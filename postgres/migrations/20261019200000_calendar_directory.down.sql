@@ -0,0 +1,13 @@
+begin;
+
+drop index subscriptions_calendar_id;
+drop index calendars_tags;
+drop index calendars_search;
+drop function calendar_search_vector(text, text, text[]);
+
+alter table calendars
+    drop column created_at,
+    drop column tags,
+    drop column description;
+
+commit;
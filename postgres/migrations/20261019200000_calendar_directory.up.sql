@@ -0,0 +1,21 @@
+begin;
+
+-- Details shown in the public calendar directory
+alter table calendars
+    add column description text,
+    add column tags text[] not null default '{}',
+    add column created_at timestamp(3) not null default now();
+
+-- Weighted full-text document for a calendar. Queries must call this same function for the index to be used.
+create function calendar_search_vector(title text, description text, tags text[]) returns tsvector as $$
+    select setweight(to_tsvector('english', coalesce(title, '')), 'A')
+        || setweight(array_to_tsvector(tags), 'B')
+        || setweight(to_tsvector('english', coalesce(description, '')), 'C');
+$$ language sql immutable;
+
+create index calendars_search on calendars using gin (calendar_search_vector(title, description, tags))
+    where is_public and deleted_at is null;
+create index calendars_tags on calendars using gin (tags) where is_public and deleted_at is null;
+create index subscriptions_calendar_id on subscriptions (calendar_id);
+
+commit;
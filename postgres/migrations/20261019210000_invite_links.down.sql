@@ -0,0 +1,12 @@
+begin;
+
+drop table invite_link_uses;
+drop table invite_links;
+
+alter table calendars
+    alter column invite_code set default substring(md5(random()::text), 1, 6);
+
+alter table groups
+    alter column invite_code set default substring(md5(random()::text), 1, 6);
+
+commit;
@@ -0,0 +1,39 @@
+begin;
+
+-- md5(random()) codes were short and predictable; new codes come from the server with collision retry,
+-- and this default only covers rows inserted without one
+alter table groups
+    alter column invite_code set default substring(replace(gen_random_uuid()::text, '-', ''), 1, 10);
+
+alter table calendars
+    alter column invite_code set default substring(replace(gen_random_uuid()::text, '-', ''), 1, 10);
+
+-- Named invite links for a group or a calendar, each with its own code, expiry and usage limit.
+-- Revoking a calendar link also revokes the subscriptions made with it.
+create table invite_links (
+    invite_id text primary key,
+    code text unique not null,
+    group_id text references groups(group_id) on delete cascade on update cascade,
+    calendar_id text references calendars(calendar_id) on delete cascade on update cascade,
+    name text not null,
+    created_by text references users(user_id) on delete set null on update cascade,
+    expires_at timestamp(3),
+    max_uses int,
+    uses int not null default 0,
+    revoked_at timestamp(3),
+    created_at timestamp(3) not null default now(),
+
+    constraint invite_target check ((group_id is null) <> (calendar_id is null))
+);
+
+create index invite_links_group_id on invite_links (group_id) where group_id is not null;
+create index invite_links_calendar_id on invite_links (calendar_id) where calendar_id is not null;
+
+create table invite_link_uses (
+    invite_id text not null references invite_links(invite_id) on delete cascade on update cascade,
+    user_id text not null references users(user_id) on delete cascade on update cascade,
+    used_at timestamp(3) not null default now(),
+    primary key (invite_id, user_id)
+);
+
+commit;
@@ -0,0 +1,8 @@
+begin;
+
+drop table group_join_requests;
+
+alter table groups
+    drop column approval_required;
+
+commit;
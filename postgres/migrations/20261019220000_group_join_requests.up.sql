@@ -0,0 +1,23 @@
+begin;
+
+-- Groups that require approval turn joins into requests that a member has to approve or deny
+alter table groups
+    add column approval_required boolean not null default false;
+
+create table group_join_requests (
+    request_id text primary key,
+    group_id text not null references groups(group_id) on delete cascade on update cascade,
+    user_id text not null references users(user_id) on delete cascade on update cascade,
+    invite_id text references invite_links(invite_id) on delete set null on update cascade,
+    message text,
+    status text not null default 'pending' check (status in ('pending', 'approved', 'denied', 'cancelled')),
+    decided_by text references users(user_id) on delete set null on update cascade,
+    created_at timestamp(3) not null default now(),
+    decided_at timestamp(3)
+);
+
+-- A user can only have one pending request per group
+create unique index group_join_requests_pending on group_join_requests (group_id, user_id) where status = 'pending';
+create index group_join_requests_user_id on group_join_requests (user_id);
+
+commit;
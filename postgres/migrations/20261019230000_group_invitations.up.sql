@@ -0,0 +1,22 @@
+begin;
+
+-- Invitations to a group addressed to a user, or to an email address that may not have an account yet
+create table group_invitations (
+    invitation_id text primary key,
+    group_id text not null references groups(group_id) on delete cascade on update cascade,
+    invitee_id text references users(user_id) on delete cascade on update cascade,
+    email text,
+    invited_by text references users(user_id) on delete set null on update cascade,
+    status text not null default 'pending' check (status in ('pending', 'accepted', 'declined', 'cancelled')),
+    created_at timestamp(3) not null default now(),
+    responded_at timestamp(3),
+
+    constraint invitation_target check (invitee_id is not null or email is not null)
+);
+
+create unique index group_invitations_pending_user on group_invitations (group_id, invitee_id) where status = 'pending';
+create unique index group_invitations_pending_email on group_invitations (group_id, lower(email)) where status = 'pending';
+create index group_invitations_invitee_id on group_invitations (invitee_id);
+create index group_invitations_email on group_invitations (lower(email));
+
+commit;
@@ -0,0 +1,10 @@
+begin;
+
+alter table users
+    drop column hide_email;
+
+alter table group_members
+    drop column joined_at,
+    drop column role;
+
+commit;
@@ -0,0 +1,11 @@
+begin;
+
+-- Existing members keep the default role and count as joining when this migration ran
+alter table group_members
+    add column role text not null default 'member' check (role in ('owner', 'member')),
+    add column joined_at timestamp(3) not null default now();
+
+alter table users
+    add column hide_email boolean not null default false;
+
+commit;
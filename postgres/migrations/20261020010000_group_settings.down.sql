@@ -0,0 +1,11 @@
+begin;
+
+alter table groups
+    drop column members_can_invite,
+    drop column members_can_create_calendars,
+    drop column default_calendar_id,
+    drop column avatar,
+    drop column color,
+    drop column description;
+
+commit;
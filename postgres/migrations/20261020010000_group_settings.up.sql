@@ -0,0 +1,17 @@
+begin;
+
+alter table groups
+    add column description text,
+    add column color text,
+    add column avatar text,
+    add column default_calendar_id text references calendars(calendar_id) on delete set null on update cascade,
+    add column members_can_create_calendars boolean not null default true,
+    add column members_can_invite boolean not null default true;
+
+-- Every member could manage a group before roles existed, so groups without an owner keep that by making all of
+-- their members owners
+update group_members gm
+set role = 'owner'
+where not exists (select 1 from group_members o where o.group_id = gm.group_id and o.role = 'owner');
+
+commit;
@@ -0,0 +1,21 @@
+begin;
+
+-- Images that went through the upload pipeline. full_key is the key stored on users, events and groups, and the
+-- other variants are looked up through it. Uploads outlive the uploader so group images stay in place.
+create table uploads (
+    upload_id text primary key,
+    user_id text references users(user_id) on delete set null on update cascade,
+    purpose text not null,
+    content_type text not null,
+    width int not null,
+    height int not null,
+    size_bytes bigint not null,
+    full_key text unique not null,
+    card_key text not null,
+    avatar_key text not null,
+    created_at timestamp(3) not null default now()
+);
+
+create index uploads_user_id on uploads (user_id);
+
+commit;
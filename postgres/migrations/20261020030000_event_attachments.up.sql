@@ -0,0 +1,19 @@
+begin;
+
+-- Files attached to events. The uploader is kept for quotas and is cleared when their account goes, while the
+-- attachment stays with the event.
+create table event_attachments (
+    attachment_id text primary key,
+    event_id text not null references events(event_id) on delete cascade on update cascade,
+    user_id text references users(user_id) on delete set null on update cascade,
+    filename text not null,
+    content_type text not null,
+    size_bytes bigint not null,
+    object_key text unique not null,
+    created_at timestamp(3) not null default now()
+);
+
+create index event_attachments_event_id on event_attachments (event_id);
+create index event_attachments_user_id on event_attachments (user_id);
+
+commit;
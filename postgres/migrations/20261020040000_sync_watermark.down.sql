@@ -0,0 +1,70 @@
+begin;
+
+create or replace function record_revision() returns trigger as $$
+declare
+    row_data jsonb;
+    row_changes jsonb;
+begin
+    if tg_op = 'DELETE' then
+        row_data := to_jsonb(old);
+    else
+        row_data := to_jsonb(new);
+    end if;
+
+    if tg_table_name = 'calendars' and (row_data->>'is_web_based')::boolean then
+        return null;
+    end if;
+
+    if tg_table_name = 'events' and (
+        row_data->>'calendar_id' = current_setting('calenduh.skip_revisions_for', true)
+        or exists (select 1 from calendars where calendar_id = row_data->>'calendar_id' and is_web_based)
+    ) then
+        return null;
+    end if;
+
+    if tg_op = 'UPDATE' then
+        select jsonb_object_agg(n.key, jsonb_build_object('old', o.value, 'new', n.value))
+        into row_changes
+        from jsonb_each(row_data) n
+        inner join jsonb_each(to_jsonb(old)) o on n.key = o.key
+        where n.value is distinct from o.value and n.key not in ('change_seq', 'last_edited');
+
+        if row_changes is null then
+            return null;
+        end if;
+    end if;
+
+    insert into revisions (entity_type, entity_id, calendar_id, user_id, group_id, action, actor_id, snapshot, changes)
+    values (
+        case tg_table_name when 'events' then 'event' else 'calendar' end,
+        coalesce(row_data->>'event_id', row_data->>'calendar_id'),
+        row_data->>'calendar_id',
+        row_data->>'user_id',
+        row_data->>'group_id',
+        case tg_op when 'INSERT' then 'create' when 'UPDATE' then 'update' else 'delete' end,
+        nullif(current_setting('calenduh.actor_id', true), ''),
+        row_data,
+        row_changes
+    );
+
+    return null;
+end;
+$$ language plpgsql;
+
+create or replace function bump_change_seq() returns trigger as $$
+begin
+    new.change_seq := nextval('change_seq');
+    return new;
+end;
+$$ language plpgsql;
+
+drop index tombstones_change_xid;
+
+alter table tombstones drop column change_xid;
+alter table subscriptions drop column change_xid;
+alter table group_members drop column change_xid;
+alter table groups drop column change_xid;
+alter table events drop column change_xid;
+alter table calendars drop column change_xid;
+
+commit;
@@ -0,0 +1,86 @@
+begin;
+
+-- Sequence values are taken before a transaction commits, so a sync token built from the last value could skip
+-- rows that commit later with a lower value. Rows also record the transaction that last changed them, and tokens
+-- hold the oldest transaction still running when they were issued.
+alter table calendars
+    add column change_xid bigint not null default pg_current_xact_id()::text::bigint;
+
+alter table events
+    add column change_xid bigint not null default pg_current_xact_id()::text::bigint;
+
+alter table groups
+    add column change_xid bigint not null default pg_current_xact_id()::text::bigint;
+
+alter table group_members
+    add column change_xid bigint not null default pg_current_xact_id()::text::bigint;
+
+alter table subscriptions
+    add column change_xid bigint not null default pg_current_xact_id()::text::bigint;
+
+alter table tombstones
+    add column change_xid bigint not null default pg_current_xact_id()::text::bigint;
+
+create index tombstones_change_xid on tombstones (change_xid);
+
+create or replace function bump_change_seq() returns trigger as $$
+begin
+    new.change_seq := nextval('change_seq');
+    new.change_xid := pg_current_xact_id()::text::bigint;
+    return new;
+end;
+$$ language plpgsql;
+
+-- change_xid moves with change_seq on every write, so it is left out of revisions the same way
+create or replace function record_revision() returns trigger as $$
+declare
+    row_data jsonb;
+    row_changes jsonb;
+begin
+    if tg_op = 'DELETE' then
+        row_data := to_jsonb(old);
+    else
+        row_data := to_jsonb(new);
+    end if;
+
+    if tg_table_name = 'calendars' and (row_data->>'is_web_based')::boolean then
+        return null;
+    end if;
+
+    if tg_table_name = 'events' and (
+        row_data->>'calendar_id' = current_setting('calenduh.skip_revisions_for', true)
+        or exists (select 1 from calendars where calendar_id = row_data->>'calendar_id' and is_web_based)
+    ) then
+        return null;
+    end if;
+
+    if tg_op = 'UPDATE' then
+        select jsonb_object_agg(n.key, jsonb_build_object('old', o.value, 'new', n.value))
+        into row_changes
+        from jsonb_each(row_data) n
+        inner join jsonb_each(to_jsonb(old)) o on n.key = o.key
+        where n.value is distinct from o.value and n.key not in ('change_seq', 'change_xid', 'last_edited');
+
+        if row_changes is null then
+            return null;
+        end if;
+    end if;
+
+    insert into revisions (entity_type, entity_id, calendar_id, user_id, group_id, action, actor_id, snapshot, changes)
+    values (
+        case tg_table_name when 'events' then 'event' else 'calendar' end,
+        coalesce(row_data->>'event_id', row_data->>'calendar_id'),
+        row_data->>'calendar_id',
+        row_data->>'user_id',
+        row_data->>'group_id',
+        case tg_op when 'INSERT' then 'create' when 'UPDATE' then 'update' else 'delete' end,
+        nullif(current_setting('calenduh.actor_id', true), ''),
+        row_data,
+        row_changes
+    );
+
+    return null;
+end;
+$$ language plpgsql;
+
+commit;
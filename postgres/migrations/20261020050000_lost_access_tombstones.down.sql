@@ -0,0 +1,7 @@
+begin;
+
+drop trigger invite_links_lost_access on invite_links;
+drop trigger calendars_lost_access on calendars;
+drop function record_lost_access;
+
+commit;
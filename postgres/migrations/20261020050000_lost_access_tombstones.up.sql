@@ -0,0 +1,40 @@
+begin;
+
+-- Subscribers keep their subscription row when they lose access to a calendar, and members of a group keep their
+-- membership when a calendar moves out of it, so neither leaves a tombstone on its own. These record one for sync
+-- clients to remove the calendar.
+create function record_lost_access() returns trigger as $$
+begin
+    if tg_table_name = 'calendars' then
+        insert into tombstones (entity_type, entity_id, calendar_id, user_id)
+        select 'subscription', s.calendar_id, s.calendar_id, s.user_id
+        from subscriptions s
+        where s.calendar_id = new.calendar_id
+          and (old.is_public or s.invite_code = old.invite_code)
+          and not new.is_public and s.invite_code is distinct from new.invite_code
+          and not exists (select 1 from invite_links l where l.code = s.invite_code and l.calendar_id = new.calendar_id and l.revoked_at is null);
+
+        if old.group_id is not null and old.group_id is distinct from new.group_id then
+            insert into tombstones (entity_type, entity_id, calendar_id, group_id)
+            values ('calendar', old.calendar_id, old.calendar_id, old.group_id);
+        end if;
+    elsif tg_table_name = 'invite_links' then
+        insert into tombstones (entity_type, entity_id, calendar_id, user_id)
+        select 'subscription', s.calendar_id, s.calendar_id, s.user_id
+        from subscriptions s
+        inner join calendars c on c.calendar_id = s.calendar_id
+        where s.calendar_id = new.calendar_id and s.invite_code = new.code
+          and not c.is_public and s.invite_code is distinct from c.invite_code;
+    end if;
+    return new;
+end;
+$$ language plpgsql;
+
+create trigger calendars_lost_access after update of invite_code, is_public, group_id on calendars
+    for each row execute function record_lost_access();
+
+create trigger invite_links_lost_access after update of revoked_at on invite_links
+    for each row when (old.revoked_at is null and new.revoked_at is not null and new.calendar_id is not null)
+    execute function record_lost_access();
+
+commit;
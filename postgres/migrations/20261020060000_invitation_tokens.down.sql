@@ -0,0 +1,6 @@
+begin;
+
+alter table group_invitations
+    drop column token_hash;
+
+commit;
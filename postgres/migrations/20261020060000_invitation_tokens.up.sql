@@ -0,0 +1,13 @@
+begin;
+
+-- Email invitations are accepted with a single-use token sent in the email rather than by matching the user's
+-- email address, which users can change without verifying it. Only a hash of the token is kept.
+alter table group_invitations
+    add column token_hash text unique;
+
+-- Pending email invitations have no token to accept them with, so the group has to send them again
+update group_invitations
+set status = 'cancelled', responded_at = now()
+where status = 'pending' and invitee_id is null;
+
+commit;
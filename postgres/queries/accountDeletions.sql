@@ -0,0 +1,17 @@
+-- name: ScheduleAccountDeletion :one
+insert into account_deletions (user_id, delete_after)
+values ($1, $2)
+returning *;
+
+-- name: GetAccountDeletion :one
+select * from account_deletions
+where user_id = $1;
+
+-- name: CancelAccountDeletion :execrows
+delete from account_deletions
+where user_id = $1;
+
+-- name: GetDueAccountDeletions :many
+select * from account_deletions
+where delete_after <= now()
+order by delete_after;
@@ -0,0 +1,20 @@
+-- name: CreateAuditEntry :exec
+insert into audit_log (actor_id, action, target_type, target_id, ip, user_agent, metadata)
+values ($1, $2, $3, $4, $5, $6, $7);
+
+-- name: GetAuditLog :many
+select * from audit_log
+where (sqlc.narg(actor_id)::text is null or actor_id = sqlc.narg(actor_id)::text)
+  and (sqlc.narg(action)::text is null or action = sqlc.narg(action)::text)
+  and (sqlc.narg(target_type)::text is null or target_type = sqlc.narg(target_type)::text)
+  and (sqlc.narg(target_id)::text is null or target_id = sqlc.narg(target_id)::text)
+  and (sqlc.narg(before)::bigint is null or audit_id < sqlc.narg(before)::bigint)
+order by audit_id desc
+limit sqlc.arg(max_results)::int;
+
+-- name: GetUserAuditLog :many
+select * from audit_log
+where (actor_id = sqlc.arg(user_id)::text or (target_type = 'user' and target_id = sqlc.arg(user_id)::text))
+  and (sqlc.narg(before)::bigint is null or audit_id < sqlc.narg(before)::bigint)
+order by audit_id desc
+limit sqlc.arg(max_results)::int;
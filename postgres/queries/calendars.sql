@@ -1,51 +1,153 @@
 -- name: GetAllCalendars :many
-select * from calendars;
+select * from calendars
+where deleted_at is null;
 
 -- name: GetAllPublicCalendars :many
 select * from calendars
-where is_public = true and group_id is null;
+where is_public = true and group_id is null and deleted_at is null;
 
 -- name: GetCalendarById :one
 select * from calendars
-where calendar_id = $1;
+where calendar_id = $1 and deleted_at is null;
 
 -- name: GetCalendarsByUserId :many
 select * from calendars
-where user_id = $1;
+where user_id = $1 and deleted_at is null;
 
 -- name: GetCalendarsByGroupId :many
 select * from calendars
-where group_id = $1;
+where group_id = $1 and deleted_at is null;
 
 -- name: GetCalendarByInviteCode :one
 select * from calendars
-where invite_code = $1;
+where invite_code = $1 and deleted_at is null;
 
 -- name: GetSubscribedCalendars :many
 select distinct c.* from users u
 inner join subscriptions s on u.user_id = s.user_id
 inner join calendars c on s.calendar_id = c.calendar_id
-where u.user_id = $1 and (c.is_public or c.invite_code = s.invite_code);
+where u.user_id = $1 and (c.is_public or c.invite_code = s.invite_code
+    or exists (select 1 from invite_links l where l.code = s.invite_code and l.calendar_id = c.calendar_id and l.revoked_at is null)) and c.deleted_at is null;
 
 -- name: CreateCalendar :one
-insert into calendars (calendar_id, user_id, group_id, title, color, is_public, is_imported, is_web_based, url)
-values ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+insert into calendars (calendar_id, user_id, group_id, title, color, is_public, is_imported, is_web_based, url, description, tags)
+values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 returning *;
 
 -- name: DeleteCalendar :exec
 DELETE FROM calendars
 WHERE calendar_id = $1;
 
+-- name: TrashCalendar :exec
+update calendars
+set deleted_at = now()
+where calendar_id = $1 and deleted_at is null;
+
+-- name: TrashGroupCalendars :exec
+update calendars
+set deleted_at = now()
+where group_id = sqlc.arg(group_id)::text and deleted_at is null;
+
+-- name: GetTrashedCalendarById :one
+select * from calendars
+where calendar_id = $1 and deleted_at is not null;
+
+-- name: GetTrashedCalendars :many
+select c.* from calendars c
+left join groups g on c.group_id = g.group_id
+left join group_members gm on c.group_id = gm.group_id and gm.user_id = sqlc.arg(user_id)::text
+where c.deleted_at is not null and g.deleted_at is null
+  and (c.user_id = sqlc.arg(user_id)::text or gm.user_id is not null)
+order by c.deleted_at desc;
+
+-- name: RestoreTrashedCalendar :one
+update calendars
+set deleted_at = null
+where calendar_id = $1 and deleted_at is not null
+returning *;
+
+-- name: RestoreTrashedGroupCalendars :exec
+update calendars
+set deleted_at = null
+where group_id = sqlc.arg(group_id)::text and deleted_at = sqlc.arg(deleted_at)::timestamp;
+
+-- name: PurgeTrashedCalendars :exec
+delete from calendars
+where deleted_at < sqlc.arg(before)::timestamp;
+
 -- name: DeleteAllUserCalendars :exec
 DELETE FROM calendars
 WHERE user_id = $1;
 
 -- name: UpdateCalendar :one
 update calendars
-set title = $1, is_public = $2, user_id = $3, group_id = $4, color = $5
-where calendar_id = $6
+set title = sqlc.arg(title), is_public = sqlc.arg(is_public), user_id = sqlc.arg(user_id), group_id = sqlc.arg(group_id), color = sqlc.arg(color), last_edited = now()
+where calendar_id = sqlc.arg(calendar_id)
+  and (sqlc.narg(version)::bigint is null or change_seq = sqlc.narg(version)::bigint)
+returning *;
+
+-- name: PatchCalendar :one
+update calendars
+set title = coalesce(sqlc.narg(title)::text, title),
+    color = coalesce(sqlc.narg(color)::text, color),
+    is_public = coalesce(sqlc.narg(is_public)::boolean, is_public),
+    description = case when sqlc.arg(set_description)::boolean then sqlc.narg(description)::text else description end,
+    tags = coalesce(sqlc.narg(tags)::text[], tags),
+    last_edited = now()
+where calendar_id = sqlc.arg(calendar_id)
+  and (sqlc.narg(version)::bigint is null or change_seq = sqlc.narg(version)::bigint)
+returning *;
+
+-- name: ImportCalendar :one
+insert into calendars (calendar_id, user_id, title, color, is_public, last_edited)
+values ($1, $2, $3, $4, $5, $6)
+returning *;
+
+-- name: OverwriteCalendar :one
+update calendars
+set title = $2, color = $3, is_public = $4, last_edited = $5
+where calendar_id = $1
 returning *;
 
 -- name: DeleteAllCalendars :exec
 delete from calendars
-where true;
\ No newline at end of file
+where true;
+
+-- name: HandOffGroupCalendars :execrows
+update calendars
+set user_id = null
+where user_id = $1 and group_id is not null;
+
+-- name: GetPublicDirectory :many
+select sqlc.embed(c), u.username as owner_username, u.name as owner_name,
+    (select count(*) from subscriptions s where s.calendar_id = c.calendar_id) as subscriber_count
+from calendars c
+inner join users u on u.user_id = c.user_id
+where c.is_public and c.group_id is null and c.deleted_at is null
+  and (sqlc.narg(query)::text is null
+    or calendar_search_vector(c.title, c.description, c.tags) @@ websearch_to_tsquery('english', sqlc.narg(query)::text))
+  and (sqlc.narg(tag)::text is null or c.tags @> array[sqlc.narg(tag)::text])
+order by ts_rank(calendar_search_vector(c.title, c.description, c.tags), websearch_to_tsquery('english', coalesce(sqlc.narg(query)::text, ''))) desc,
+    c.calendar_id
+limit sqlc.arg(max_results)::int;
+
+-- name: GetPublicDirectoryCalendar :one
+select sqlc.embed(c), u.username as owner_username, u.name as owner_name,
+    (select count(*) from subscriptions s where s.calendar_id = c.calendar_id) as subscriber_count
+from calendars c
+inner join users u on u.user_id = c.user_id
+where c.calendar_id = $1 and c.is_public and c.group_id is null and c.deleted_at is null;
+
+-- name: GetPublicDirectoryTags :many
+select tag::text, count(*) as calendar_count
+from calendars c, unnest(c.tags) as tag
+where c.is_public and c.group_id is null and c.deleted_at is null
+group by tag
+order by calendar_count desc, tag
+limit sqlc.arg(max_results)::int;
+
+-- name: SetCalendarInviteCode :one
+update calendars
+set invite_code = $2
+where calendar_id = $1 and deleted_at is null
+returning *;
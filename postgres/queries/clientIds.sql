@@ -0,0 +1,8 @@
+-- name: GetServerId :one
+select server_id from client_ids
+where user_id = $1 and entity_type = $2 and client_id = $3;
+
+-- name: CreateClientId :exec
+insert into client_ids (user_id, entity_type, client_id, server_id)
+values ($1, $2, $3, $4)
+on conflict (user_id, entity_type, client_id) do update set server_id = excluded.server_id;
@@ -0,0 +1,39 @@
+-- name: CreateEventAttachment :one
+insert into event_attachments (attachment_id, event_id, user_id, filename, content_type, size_bytes, object_key)
+values ($1, $2, $3, $4, $5, $6, $7)
+returning *;
+
+-- name: GetEventAttachments :many
+select * from event_attachments
+where event_id = $1
+order by created_at, attachment_id;
+
+-- name: GetCalendarEventAttachments :many
+select a.* from event_attachments a
+inner join events e on e.event_id = a.event_id
+where e.calendar_id = $1 and e.deleted_at is null
+order by a.created_at, a.attachment_id;
+
+-- name: GetEventAttachment :one
+select * from event_attachments
+where attachment_id = $1 and event_id = $2;
+
+-- name: CountEventAttachments :one
+select count(*) from event_attachments
+where event_id = $1;
+
+-- name: DeleteEventAttachment :exec
+delete from event_attachments
+where attachment_id = $1;
+
+-- name: GetUserEventAttachmentKeys :many
+select a.object_key from event_attachments a
+inner join events e on e.event_id = a.event_id
+inner join calendars c on c.calendar_id = e.calendar_id
+where c.user_id = $1 and c.group_id is null;
+
+-- name: GetGroupEventAttachmentKeys :many
+select a.object_key from event_attachments a
+inner join events e on e.event_id = a.event_id
+inner join calendars c on c.calendar_id = e.calendar_id
+where c.group_id = $1;
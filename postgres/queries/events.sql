@@ -1,33 +1,38 @@
 -- name: GetAllEvents :many
 select *
 from events
-where start_time < sqlc.arg(end_time);
+where start_time < sqlc.arg(end_time) and deleted_at is null;
 
 -- name: GetEventById :one
 select *
 from events
-where event_id = $1;
+where event_id = $1 and deleted_at is null;
 
 -- name: GetEventsByUserId :many
 select e.*
-from users u
-left join group_members gm on u.user_id = gm.user_id
-left join subscriptions s on u.user_id = s.user_id
-left join calendars c on (u.user_id = c.user_id or s.calendar_id = c.calendar_id or gm.group_id = c.calendar_id)
-inner join events e on c.calendar_id = e.calendar_id
-where u.user_id = $1  and start_time < sqlc.arg(end_time);
+from events e
+inner join calendars c on c.calendar_id = e.calendar_id
+where e.start_time < sqlc.arg(end_time) and c.deleted_at is null and e.deleted_at is null and (
+    c.user_id = sqlc.arg(user_id)::text
+    or c.group_id in (select gm.group_id from group_members gm where gm.user_id = sqlc.arg(user_id)::text)
+    or exists (
+        select 1 from subscriptions s
+        where s.user_id = sqlc.arg(user_id)::text and s.calendar_id = c.calendar_id and (c.is_public or c.invite_code = s.invite_code
+            or exists (select 1 from invite_links l where l.code = s.invite_code and l.calendar_id = c.calendar_id and l.revoked_at is null))
+    )
+  );
 
 -- name: GetEventsByGroupId :many
 select e.*
 from groups g
     inner join calendars c on g.group_id = c.group_id
     inner join events e on c.calendar_id = e.calendar_id
-where g.group_id = $1  and start_time < sqlc.arg(end_time);
+where g.group_id = $1  and start_time < sqlc.arg(end_time) and g.deleted_at is null and c.deleted_at is null and e.deleted_at is null;
 
 -- name: GetEventsByCalendarId :many
 select *
 from events
-where calendar_id = $1 and start_time < sqlc.arg(end_time);
+where calendar_id = $1 and start_time < sqlc.arg(end_time) and deleted_at is null;
 
 -- name: CreateEvent :one
 insert into events (event_id, calendar_id, name, location, description, notification, frequency, priority, start_time, end_time, all_day, first_notification, second_notification, img)
@@ -36,14 +41,96 @@ returning *;
 
 -- name: UpdateEvent :one
 update events
-set name = $3, location = $4, description = $5, notification = $6, frequency = $7, priority = $8, start_time = $9, end_time = $10, all_day = $11, first_notification = $12, second_notification = $13, img = $14,last_edited = now()
-where event_id = $1 and calendar_id = $2
+set name = sqlc.arg(name), location = sqlc.arg(location), description = sqlc.arg(description), notification = sqlc.arg(notification), frequency = sqlc.arg(frequency), priority = sqlc.arg(priority), start_time = sqlc.arg(start_time), end_time = sqlc.arg(end_time), all_day = sqlc.arg(all_day), first_notification = sqlc.arg(first_notification), second_notification = sqlc.arg(second_notification), img = sqlc.arg(img), last_edited = now()
+where event_id = sqlc.arg(event_id) and calendar_id = sqlc.arg(calendar_id)
+  and (sqlc.narg(version)::bigint is null or change_seq = sqlc.narg(version)::bigint)
+returning *;
+
+-- name: ImportEvent :one
+insert into events (event_id, calendar_id, name, location, description, notification, frequency, priority, start_time, end_time, all_day, first_notification, second_notification, img, last_edited)
+values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+returning *;
+
+-- name: OverwriteEvent :one
+update events
+set calendar_id = $2, name = $3, location = $4, description = $5, notification = $6, frequency = $7, priority = $8, start_time = $9, end_time = $10, all_day = $11, first_notification = $12, second_notification = $13, img = $14, last_edited = $15
+where event_id = $1
+returning *;
+
+-- name: PatchEvent :one
+update events
+set name = coalesce(sqlc.narg(name)::text, name),
+    location = case when sqlc.arg(set_location)::boolean then sqlc.narg(location)::text else location end,
+    description = case when sqlc.arg(set_description)::boolean then sqlc.narg(description)::text else description end,
+    notification = case when sqlc.arg(set_notification)::boolean then sqlc.narg(notification)::text else notification end,
+    frequency = case when sqlc.arg(set_frequency)::boolean then sqlc.narg(frequency)::text else frequency end,
+    priority = case when sqlc.arg(set_priority)::boolean then sqlc.narg(priority)::int else priority end,
+    start_time = case when sqlc.arg(set_start_time)::boolean then sqlc.arg(start_time)::timestamp else start_time end,
+    end_time = case when sqlc.arg(set_end_time)::boolean then sqlc.arg(end_time)::timestamp else end_time end,
+    all_day = coalesce(sqlc.narg(all_day)::boolean, all_day),
+    first_notification = case when sqlc.arg(set_first_notification)::boolean then sqlc.narg(first_notification)::int else first_notification end,
+    second_notification = case when sqlc.arg(set_second_notification)::boolean then sqlc.narg(second_notification)::int else second_notification end,
+    img = case when sqlc.arg(set_img)::boolean then sqlc.narg(img)::text else img end,
+    last_edited = now()
+where event_id = sqlc.arg(event_id) and calendar_id = sqlc.arg(calendar_id)
+  and (sqlc.narg(version)::bigint is null or change_seq = sqlc.narg(version)::bigint)
 returning *;
 
 -- name: DeleteEvent :exec
 delete from events
 where event_id = $1;
 
+-- name: TrashEvent :exec
+update events
+set deleted_at = now()
+where event_id = $1 and deleted_at is null;
+
+-- name: TrashCalendarEvents :exec
+update events
+set deleted_at = now()
+where calendar_id = $1 and deleted_at is null;
+
+-- name: TrashGroupEvents :exec
+update events
+set deleted_at = now()
+where deleted_at is null and calendar_id in (
+    select calendar_id from calendars where group_id = sqlc.arg(group_id)::text
+);
+
+-- name: GetTrashedEventById :one
+select * from events
+where event_id = $1 and deleted_at is not null;
+
+-- name: GetTrashedEvents :many
+select e.* from events e
+inner join calendars c on e.calendar_id = c.calendar_id
+left join group_members gm on c.group_id = gm.group_id and gm.user_id = sqlc.arg(user_id)::text
+where e.deleted_at is not null and c.deleted_at is null
+  and (c.user_id = sqlc.arg(user_id)::text or gm.user_id is not null)
+order by e.deleted_at desc;
+
+-- name: RestoreTrashedEvent :one
+update events
+set deleted_at = null
+where event_id = $1 and deleted_at is not null
+returning *;
+
+-- name: RestoreTrashedCalendarEvents :exec
+update events
+set deleted_at = null
+where calendar_id = sqlc.arg(calendar_id) and deleted_at = sqlc.arg(deleted_at)::timestamp;
+
+-- name: RestoreTrashedGroupEvents :exec
+update events
+set deleted_at = null
+where deleted_at = sqlc.arg(deleted_at)::timestamp and calendar_id in (
+    select calendar_id from calendars where group_id = sqlc.arg(group_id)::text
+);
+
+-- name: PurgeTrashedEvents :exec
+delete from events
+where deleted_at < sqlc.arg(before)::timestamp;
+
 -- name: DeleteAllEvents :exec
 delete from events
 where true;
@@ -52,4 +139,39 @@ where true;
 update events
 set img = $3
 where event_id = $1 and calendar_id = $2
-returning *;
\ No newline at end of file
+returning *;
+
+-- name: GetUserEventImages :many
+select distinct e.img::text from events e
+inner join calendars c on c.calendar_id = e.calendar_id
+where c.user_id = $1 and c.group_id is null and e.img is not null and e.img <> '';
+
+-- name: GetGroupEventImages :many
+select distinct e.img::text from events e
+inner join calendars c on c.calendar_id = e.calendar_id
+where c.group_id = $1 and e.img is not null and e.img <> '';
+
+-- name: SearchEvents :many
+-- Recurring series are returned whenever they start before end_time; their occurrences are expanded by the caller.
+select e.*
+from events e
+inner join calendars c on c.calendar_id = e.calendar_id
+where e.deleted_at is null and c.deleted_at is null
+  and (c.user_id = sqlc.arg(user_id)::text
+    or c.group_id in (select gm.group_id from group_members gm where gm.user_id = sqlc.arg(user_id)::text)
+    or exists (select 1 from subscriptions s
+      where s.user_id = sqlc.arg(user_id)::text and s.calendar_id = c.calendar_id
+        and (c.is_public or c.invite_code = s.invite_code
+          or exists (select 1 from invite_links l where l.code = s.invite_code and l.calendar_id = c.calendar_id and l.revoked_at is null))))
+  and (sqlc.narg(query)::text is null
+    or event_search_vector(e.name, e.location, e.description) @@ websearch_to_tsquery('english', sqlc.narg(query)::text))
+  and (sqlc.narg(calendar_id)::text is null or e.calendar_id = sqlc.narg(calendar_id)::text)
+  and (sqlc.narg(group_id)::text is null or c.group_id = sqlc.narg(group_id)::text)
+  and (sqlc.narg(priority)::int is null or e.priority = sqlc.narg(priority)::int)
+  and (sqlc.narg(all_day)::boolean is null or e.all_day = sqlc.narg(all_day)::boolean)
+  and (sqlc.narg(has_image)::boolean is null or (coalesce(e.img, '') <> '') = sqlc.narg(has_image)::boolean)
+  and e.start_time < sqlc.arg(end_time)::timestamp
+  and (e.end_time > sqlc.arg(start_time)::timestamp or coalesce(e.frequency, '') <> '')
+order by ts_rank(event_search_vector(e.name, e.location, e.description), websearch_to_tsquery('english', coalesce(sqlc.narg(query)::text, ''))) desc,
+    e.start_time, e.event_id
+limit sqlc.arg(max_results)::int;
@@ -0,0 +1,50 @@
+-- name: CreateExport :one
+insert into exports (export_id, user_id)
+values ($1, $2)
+returning *;
+
+-- name: GetExportById :one
+select * from exports
+where export_id = $1 and user_id = $2;
+
+-- name: GetExportsByUserId :many
+select * from exports
+where user_id = $1
+order by created_at desc;
+
+-- name: GetActiveExport :one
+select * from exports
+where user_id = $1 and status in ('pending', 'running')
+order by created_at desc
+limit 1;
+
+-- name: ClaimExport :one
+update exports
+set status = 'running', started_at = now()
+where export_id = (
+    select export_id from exports
+    where status = 'pending' or (status = 'running' and started_at < sqlc.arg(stale_before)::timestamp)
+    order by created_at
+    limit 1
+    for update skip locked
+)
+returning *;
+
+-- name: CompleteExport :exec
+update exports
+set status = 'ready', object_key = sqlc.arg(object_key)::text, size_bytes = sqlc.arg(size_bytes)::bigint,
+    completed_at = now(), expires_at = sqlc.arg(expires_at)::timestamp
+where export_id = sqlc.arg(export_id);
+
+-- name: FailExport :exec
+update exports
+set status = 'failed', error = sqlc.arg(error)::text, completed_at = now(), expires_at = sqlc.arg(expires_at)::timestamp
+where export_id = sqlc.arg(export_id);
+
+-- name: GetExpiredExports :many
+select * from exports
+where expires_at < now();
+
+-- name: DeleteExport :exec
+delete from exports
+where export_id = $1;
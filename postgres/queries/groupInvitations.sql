@@ -0,0 +1,39 @@
+-- name: CreateGroupInvitation :one
+insert into group_invitations (invitation_id, group_id, invitee_id, email, invited_by, token_hash)
+values ($1, $2, $3, $4, $5, $6)
+returning *;
+
+-- name: GetGroupInvitationById :one
+select * from group_invitations
+where invitation_id = $1;
+
+-- name: GetGroupInvitationByToken :one
+select * from group_invitations
+where token_hash = $1;
+
+-- name: GetGroupInvitations :many
+select i.*, u.username, u.name
+from group_invitations i
+left join users u on u.user_id = i.invitee_id
+where i.group_id = $1 and i.status = 'pending'
+order by i.created_at desc;
+
+-- name: GetPendingInvitationsForUser :many
+select i.*, g.name as group_name, u.username as invited_by_username
+from group_invitations i
+inner join groups g on g.group_id = i.group_id
+left join users u on u.user_id = i.invited_by
+where i.invitee_id = sqlc.arg(user_id)::text and i.status = 'pending' and g.deleted_at is null
+order by i.created_at desc;
+
+-- name: RespondToGroupInvitation :one
+update group_invitations
+set status = sqlc.arg(status), invitee_id = sqlc.arg(user_id), responded_at = now()
+where invitation_id = sqlc.arg(invitation_id) and status = 'pending'
+returning *;
+
+-- name: CancelGroupInvitation :one
+update group_invitations
+set status = 'cancelled', responded_at = now()
+where invitation_id = $1 and group_id = $2 and status = 'pending'
+returning *;
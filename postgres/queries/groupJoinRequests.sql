@@ -0,0 +1,38 @@
+-- name: CreateJoinRequest :one
+insert into group_join_requests (request_id, group_id, user_id, invite_id, message)
+values ($1, $2, $3, $4, $5)
+returning *;
+
+-- name: GetJoinRequestById :one
+select * from group_join_requests
+where request_id = $1;
+
+-- name: GetPendingJoinRequest :one
+select * from group_join_requests
+where group_id = $1 and user_id = $2 and status = 'pending';
+
+-- name: GetGroupJoinRequests :many
+select r.*, u.username, u.name
+from group_join_requests r
+inner join users u on u.user_id = r.user_id
+where r.group_id = $1 and r.status = $2
+order by r.created_at;
+
+-- name: GetJoinRequestsByUserId :many
+select r.*, g.name as group_name
+from group_join_requests r
+inner join groups g on g.group_id = r.group_id
+where r.user_id = $1 and g.deleted_at is null
+order by r.created_at desc;
+
+-- name: DecideJoinRequest :one
+update group_join_requests
+set status = $2, decided_by = $3, decided_at = now()
+where request_id = $1 and status = 'pending'
+returning *;
+
+-- name: CancelJoinRequest :one
+update group_join_requests
+set status = 'cancelled', decided_at = now()
+where request_id = $1 and user_id = $2 and status = 'pending'
+returning *;
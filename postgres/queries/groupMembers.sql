@@ -2,10 +2,30 @@
 select * from group_members
 where group_id = $1;
 
+-- name: GetGroupMember :one
+select * from group_members
+where group_id = $1 and user_id = $2;
+
 -- name: CreateGroupMember :exec
 insert into group_members (user_id, group_id)
 values ($1, $2);
 
 -- name: DeleteGroupMember :exec
 delete from group_members
-where user_id = $1 and group_id = $2;
\ No newline at end of file
+where user_id = $1 and group_id = $2;
+
+-- name: SetGroupMemberRole :exec
+update group_members
+set role = $3
+where user_id = $1 and group_id = $2;
+
+-- name: GetGroupMemberProfiles :many
+select u.user_id, u.username, u.name, u.email, u.hide_email, u.profile_picture, gm.role, gm.joined_at
+from group_members gm
+inner join users u on u.user_id = gm.user_id
+where gm.group_id = $1
+order by gm.joined_at, u.user_id;
+
+-- name: GetOwnedGroupIds :many
+select group_id from group_members
+where user_id = $1 and role = 'owner';
@@ -1,23 +1,24 @@
 -- name: GetAllGroups :many
-select * from groups;
+select * from groups
+where deleted_at is null;
 
 -- name: GetGroupById :one
 select * from groups
-where group_id = $1;
+where group_id = $1 and deleted_at is null;
 
 -- name: GetGroupByInviteCode :one
 select * from groups
-where invite_code = $1;
+where invite_code = $1 and deleted_at is null;
 
 -- name: GetGroupsByUserId :many
 select g.* from users u
 inner join group_members gm on u.user_id = gm.user_id
 inner join groups g on gm.group_id = g.group_id
-where u.user_id = $1;
+where u.user_id = $1 and g.deleted_at is null;
 
 -- name: CreateGroup :one
-insert into groups (group_id, name)
-values ($1,$2)
+insert into groups (group_id, name, description, color)
+values ($1, $2, $3, $4)
 returning *;
 
 -- name: UpdateGroup :one
@@ -26,6 +27,55 @@ set name = $1
 where group_id = $2
 returning *;
 
+-- name: PatchGroup :one
+update groups
+set name = coalesce(sqlc.narg(name)::text, name),
+    approval_required = coalesce(sqlc.narg(approval_required)::boolean, approval_required),
+    description = case when sqlc.arg(set_description)::boolean then sqlc.narg(description)::text else description end,
+    color = case when sqlc.arg(set_color)::boolean then sqlc.narg(color)::text else color end,
+    default_calendar_id = case when sqlc.arg(set_default_calendar_id)::boolean then sqlc.narg(default_calendar_id)::text else default_calendar_id end,
+    members_can_create_calendars = coalesce(sqlc.narg(members_can_create_calendars)::boolean, members_can_create_calendars),
+    members_can_invite = coalesce(sqlc.narg(members_can_invite)::boolean, members_can_invite)
+where group_id = sqlc.arg(group_id)
+returning *;
+
+-- name: TrashGroup :exec
+update groups
+set deleted_at = now()
+where group_id = $1 and deleted_at is null;
+
+-- name: GetTrashedGroupById :one
+select * from groups
+where group_id = $1 and deleted_at is not null;
+
+-- name: GetTrashedGroups :many
+select g.* from groups g
+inner join group_members gm on g.group_id = gm.group_id
+where gm.user_id = $1 and g.deleted_at is not null
+order by g.deleted_at desc;
+
+-- name: RestoreTrashedGroup :one
+update groups
+set deleted_at = null
+where group_id = $1 and deleted_at is not null
+returning *;
+
+-- name: PurgeTrashedGroups :exec
+delete from groups
+where deleted_at < sqlc.arg(before)::timestamp;
+
 -- name: DeleteGroup :exec
 delete from groups
-where group_id = $1;
\ No newline at end of file
+where group_id = $1;
+
+-- name: SetGroupInviteCode :one
+update groups
+set invite_code = $2
+where group_id = $1 and deleted_at is null
+returning *;
+
+-- name: SetGroupAvatar :one
+update groups
+set avatar = $2
+where group_id = $1 and deleted_at is null
+returning *;
@@ -0,0 +1,48 @@
+-- name: CreateInviteLink :one
+insert into invite_links (invite_id, code, group_id, calendar_id, name, created_by, expires_at, max_uses)
+values ($1, $2, $3, $4, $5, $6, $7, $8)
+returning *;
+
+-- name: GetInviteLinkById :one
+select * from invite_links
+where invite_id = $1;
+
+-- name: GetInviteLinkByCode :one
+select * from invite_links
+where code = $1;
+
+-- name: GetGroupInviteLinks :many
+select * from invite_links
+where group_id = $1
+order by created_at desc;
+
+-- name: GetCalendarInviteLinks :many
+select * from invite_links
+where calendar_id = $1
+order by created_at desc;
+
+-- name: ClaimInviteLink :one
+update invite_links
+set uses = uses + 1
+where invite_id = $1 and revoked_at is null
+  and (expires_at is null or expires_at > now())
+  and (max_uses is null or uses < max_uses)
+returning *;
+
+-- name: RevokeInviteLink :one
+update invite_links
+set revoked_at = now()
+where invite_id = $1 and revoked_at is null
+returning *;
+
+-- name: CreateInviteLinkUse :exec
+insert into invite_link_uses (invite_id, user_id)
+values ($1, $2)
+on conflict do nothing;
+
+-- name: GetInviteLinkUses :many
+select iu.user_id, u.username, u.name, iu.used_at
+from invite_link_uses iu
+inner join users u on u.user_id = iu.user_id
+where iu.invite_id = $1
+order by iu.used_at desc;
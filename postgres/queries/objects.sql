@@ -0,0 +1,22 @@
+-- name: GetReferencedObjectKeys :many
+-- Every stored object still referenced by a row, counting trashed rows and history that can still be restored.
+select k.object_key::text from (
+    select profile_picture as object_key from users
+    union select img from events
+    union select avatar from groups
+    union select object_key from event_attachments
+    union select object_key from exports
+    union select snapshot->>'img' from revisions where entity_type = 'event'
+) k
+where k.object_key is not null and k.object_key <> '';
+
+-- name: IsObjectReferenced :one
+-- Whether any row counted by GetReferencedObjectKeys still references a stored object.
+select exists (
+    select 1 from users where profile_picture = sqlc.arg(object_key)::text
+    union all select 1 from events where img = sqlc.arg(object_key)::text
+    union all select 1 from groups where avatar = sqlc.arg(object_key)::text
+    union all select 1 from event_attachments where object_key = sqlc.arg(object_key)::text
+    union all select 1 from exports where object_key = sqlc.arg(object_key)::text
+    union all select 1 from revisions where entity_type = 'event' and snapshot->>'img' = sqlc.arg(object_key)::text
+);
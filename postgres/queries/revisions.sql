@@ -0,0 +1,93 @@
+-- name: SetActor :exec
+select set_config('calenduh.actor_id', sqlc.arg(actor_id)::text, true);
+
+-- name: GetRevisionById :one
+select * from revisions
+where revision_id = $1;
+
+-- name: GetEventRevisions :many
+select * from revisions
+where entity_type = 'event' and entity_id = $1 and calendar_id = $2
+order by revision_id desc;
+
+-- name: GetCalendarRevisions :many
+select * from revisions
+where entity_type = 'calendar' and entity_id = $1
+order by revision_id desc;
+
+-- name: RestoreEvent :one
+insert into events (event_id, calendar_id, name, location, description, notification, frequency, priority, start_time, end_time, all_day, first_notification, second_notification, img, last_edited)
+select r.entity_id,
+       r.snapshot->>'calendar_id',
+       r.snapshot->>'name',
+       r.snapshot->>'location',
+       r.snapshot->>'description',
+       r.snapshot->>'notification',
+       r.snapshot->>'frequency',
+       (r.snapshot->>'priority')::int,
+       (r.snapshot->>'start_time')::timestamp,
+       (r.snapshot->>'end_time')::timestamp,
+       (r.snapshot->>'all_day')::boolean,
+       (r.snapshot->>'first_notification')::int,
+       (r.snapshot->>'second_notification')::int,
+       case when sqlc.arg(keep_img)::boolean then r.snapshot->>'img' end,
+       now()
+from revisions r
+where r.revision_id = sqlc.arg(revision_id) and r.entity_type = 'event'
+on conflict (event_id) do update
+set calendar_id = excluded.calendar_id, name = excluded.name, location = excluded.location, description = excluded.description,
+    notification = excluded.notification, frequency = excluded.frequency, priority = excluded.priority,
+    start_time = excluded.start_time, end_time = excluded.end_time, all_day = excluded.all_day,
+    first_notification = excluded.first_notification, second_notification = excluded.second_notification,
+    img = excluded.img, last_edited = now(), deleted_at = null
+returning *;
+
+-- name: RestoreCalendar :one
+insert into calendars (calendar_id, user_id, group_id, title, is_public, color, invite_code, is_imported, is_web_based, url, description, tags, last_edited)
+select r.entity_id,
+       r.snapshot->>'user_id',
+       r.snapshot->>'group_id',
+       r.snapshot->>'title',
+       (r.snapshot->>'is_public')::boolean,
+       r.snapshot->>'color',
+       r.snapshot->>'invite_code',
+       (r.snapshot->>'is_imported')::boolean,
+       (r.snapshot->>'is_web_based')::boolean,
+       r.snapshot->>'url',
+       r.snapshot->>'description',
+       array(select jsonb_array_elements_text(coalesce(r.snapshot->'tags', '[]'::jsonb))),
+       now()
+from revisions r
+where r.revision_id = $1 and r.entity_type = 'calendar'
+on conflict (calendar_id) do update
+set title = excluded.title, is_public = excluded.is_public, color = excluded.color,
+    description = excluded.description, tags = excluded.tags, last_edited = now()
+returning *;
+
+-- name: RestoreDeletedCalendarEvents :exec
+insert into events (event_id, calendar_id, name, location, description, notification, frequency, priority, start_time, end_time, all_day, first_notification, second_notification, img, last_edited)
+select distinct on (r.entity_id)
+       r.entity_id,
+       r.calendar_id,
+       r.snapshot->>'name',
+       r.snapshot->>'location',
+       r.snapshot->>'description',
+       r.snapshot->>'notification',
+       r.snapshot->>'frequency',
+       (r.snapshot->>'priority')::int,
+       (r.snapshot->>'start_time')::timestamp,
+       (r.snapshot->>'end_time')::timestamp,
+       (r.snapshot->>'all_day')::boolean,
+       (r.snapshot->>'first_notification')::int,
+       (r.snapshot->>'second_notification')::int,
+       r.snapshot->>'img',
+       now()
+from revisions r
+where r.entity_type = 'event' and r.action = 'delete'
+  and r.calendar_id = sqlc.arg(calendar_id) and r.created_at = sqlc.arg(deleted_at)
+order by r.entity_id, r.revision_id desc
+on conflict (event_id) do nothing;
+
+-- name: PurgeRevisions :exec
+delete from revisions
+where created_at < $1;
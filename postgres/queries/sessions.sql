@@ -1,6 +1,10 @@
 -- name: GetAllSessions :many
 select * from sessions;
 
+-- name: GetSessionsByUserId :many
+select * from sessions
+where user_id = $1;
+
 -- name: GetSessionById :one
 select * from sessions
 where session_id = $1;
@@ -17,4 +21,8 @@ $6
 
 -- name: DeleteSession :exec
 delete from sessions session
-where session_id = $1;
\ No newline at end of file
+where session_id = $1;
+
+-- name: RevokeOtherSessions :exec
+delete from sessions
+where user_id = sqlc.arg(user_id) and session_id <> sqlc.arg(keep_session_id);
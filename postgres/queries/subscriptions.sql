@@ -7,4 +7,12 @@ values ($1, $2, $3);
 
 -- name: DeleteSubscription :exec
 delete from subscriptions
-where user_id = $1 and calendar_id = $2;
\ No newline at end of file
+where user_id = $1 and calendar_id = $2;
+
+-- name: HasValidSubscription :one
+select exists (
+    select 1 from subscriptions s
+    inner join calendars c on s.calendar_id = c.calendar_id
+    where s.user_id = $1 and s.calendar_id = $2 and (c.invite_code = s.invite_code
+        or exists (select 1 from invite_links l where l.code = s.invite_code and l.calendar_id = c.calendar_id and l.revoked_at is null))
+);
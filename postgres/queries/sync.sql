@@ -0,0 +1,59 @@
+-- name: GetSyncWatermark :one
+select pg_snapshot_xmin(pg_current_snapshot())::text::bigint as change_xid;
+
+-- name: GetChangedCalendars :many
+select distinct c.*
+from calendars c
+left join group_members gm on gm.group_id = c.group_id and gm.user_id = sqlc.arg(user_id)::text
+left join subscriptions s on s.calendar_id = c.calendar_id and s.user_id = sqlc.arg(user_id)::text
+where c.deleted_at is null and (
+    (c.user_id = sqlc.arg(user_id)::text and c.change_xid >= sqlc.arg(since)::bigint)
+    or (gm.user_id is not null and (c.change_xid >= sqlc.arg(since)::bigint or gm.change_xid >= sqlc.arg(since)::bigint))
+    or (s.user_id is not null and (c.is_public or c.invite_code = s.invite_code
+        or exists (select 1 from invite_links l where l.code = s.invite_code and l.calendar_id = c.calendar_id and l.revoked_at is null)) and (c.change_xid >= sqlc.arg(since)::bigint or s.change_xid >= sqlc.arg(since)::bigint))
+  );
+
+-- name: GetChangedEvents :many
+select distinct e.*
+from events e
+inner join calendars c on e.calendar_id = c.calendar_id
+left join group_members gm on gm.group_id = c.group_id and gm.user_id = sqlc.arg(user_id)::text
+left join subscriptions s on s.calendar_id = c.calendar_id and s.user_id = sqlc.arg(user_id)::text
+where e.deleted_at is null and c.deleted_at is null and (
+    (c.user_id = sqlc.arg(user_id)::text and e.change_xid >= sqlc.arg(since)::bigint)
+    or (gm.user_id is not null and (e.change_xid >= sqlc.arg(since)::bigint or gm.change_xid >= sqlc.arg(since)::bigint))
+    or (s.user_id is not null and (c.is_public or c.invite_code = s.invite_code
+        or exists (select 1 from invite_links l where l.code = s.invite_code and l.calendar_id = c.calendar_id and l.revoked_at is null)) and (e.change_xid >= sqlc.arg(since)::bigint or s.change_xid >= sqlc.arg(since)::bigint))
+  );
+
+-- name: GetChangedGroups :many
+select g.*
+from groups g
+inner join group_members gm on g.group_id = gm.group_id
+where gm.user_id = sqlc.arg(user_id)::text and g.deleted_at is null
+  and (g.change_xid >= sqlc.arg(since)::bigint or gm.change_xid >= sqlc.arg(since)::bigint);
+
+-- name: GetTombstones :many
+select *
+from tombstones t
+where t.change_xid >= sqlc.arg(since)::bigint
+  and (
+    (t.entity_type in ('group_member', 'subscription') and t.user_id = sqlc.arg(user_id)::text)
+    or (t.entity_type = 'group' and t.group_id in (select group_id from group_members where user_id = sqlc.arg(user_id)::text))
+    or (t.entity_type = 'calendar' and (
+        t.user_id = sqlc.arg(user_id)::text
+        or t.group_id in (select group_id from group_members where user_id = sqlc.arg(user_id)::text)
+    ))
+    or (t.entity_type = 'event' and t.calendar_id in (
+        select c.calendar_id
+        from calendars c
+        left join group_members gm on gm.group_id = c.group_id
+        left join subscriptions s on s.calendar_id = c.calendar_id
+        where c.user_id = sqlc.arg(user_id)::text or gm.user_id = sqlc.arg(user_id)::text or s.user_id = sqlc.arg(user_id)::text
+    ))
+  )
+order by t.change_seq;
+
+-- name: PurgeTombstones :exec
+delete from tombstones
+where deleted_at < $1;
@@ -0,0 +1,32 @@
+-- name: CreateUpload :one
+insert into uploads (upload_id, user_id, purpose, content_type, width, height, size_bytes, full_key, card_key, avatar_key)
+values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+returning *;
+
+-- name: GetUploadByKey :one
+select * from uploads
+where full_key = $1;
+
+-- name: GetUploadUsage :one
+select (coalesce((select sum(size_bytes) from uploads u where u.user_id = $1), 0)
+    + coalesce((select sum(size_bytes) from event_attachments a where a.user_id = $1), 0))::bigint;
+
+-- name: LockUploadQuota :one
+select user_id from users
+where user_id = $1
+for update;
+
+-- name: DeleteUpload :exec
+delete from uploads
+where upload_id = $1;
+
+-- name: GetUploads :many
+select * from uploads;
+
+-- name: DeleteUploadByKey :exec
+delete from uploads
+where full_key = $1;
+
+-- name: GetUserUploadKeys :many
+select full_key from uploads
+where user_id = $1;
@@ -16,6 +16,19 @@ set email = $2, username = $3, birthday = $4, name = $5, default_calendar_id = $
 where user_id = $1
 returning *;
 
+-- name: PatchUser :one
+update users
+set email = coalesce(sqlc.narg(email)::text, email),
+    username = coalesce(sqlc.narg(username)::text, username),
+    name = case when sqlc.arg(set_name)::boolean then sqlc.narg(name)::text else name end,
+    birthday = case when sqlc.arg(set_birthday)::boolean then sqlc.narg(birthday)::date else birthday end,
+    default_calendar_id = case when sqlc.arg(set_default_calendar_id)::boolean then sqlc.narg(default_calendar_id)::text else default_calendar_id end,
+    default_calendar_enabled = coalesce(sqlc.narg(default_calendar_enabled)::boolean, default_calendar_enabled),
+    is_24_hour = coalesce(sqlc.narg(is_24_hour)::boolean, is_24_hour),
+    hide_email = coalesce(sqlc.narg(hide_email)::boolean, hide_email)
+where user_id = sqlc.arg(user_id)
+returning *;
+
 -- name: DeleteUserProfilePicture :exec
 update users
 set profile_picture = null
@@ -33,4 +46,9 @@ where true;
 update users
 set profile_picture = $2
 where user_id = $1
-returning *;
\ No newline at end of file
+returning *;
+
+-- name: GetUsersByUsername :many
+select * from users
+where lower(username) = lower($1)
+limit 2;